@@ -0,0 +1,153 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/chromedp"
+	"github.com/chromedp/chromedp/kb"
+	"github.com/efixler/headless/request"
+)
+
+var (
+	keys = map[string]string{
+		"Backspace":  kb.Backspace,
+		"Tab":        kb.Tab,
+		"Enter":      kb.Enter,
+		"Escape":     kb.Escape,
+		"Delete":     kb.Delete,
+		"Space":      " ",
+		"ArrowDown":  kb.ArrowDown,
+		"ArrowLeft":  kb.ArrowLeft,
+		"ArrowRight": kb.ArrowRight,
+		"ArrowUp":    kb.ArrowUp,
+		"End":        kb.End,
+		"Home":       kb.Home,
+		"PageDown":   kb.PageDown,
+		"PageUp":     kb.PageUp,
+	}
+)
+
+const (
+	scrollToBottomJS = `window.scrollTo(0, document.scrollingElement.scrollHeight)`
+	// Sets the value of a select element and fires the events a user's
+	// selection would. Returns false if the selector (%s) didn't match.
+	selectOptionJS = `(() => {
+	const e = document.querySelector(%s);
+	if (!e) {
+		return false;
+	}
+	e.value = %s;
+	e.dispatchEvent(new Event('input', {bubbles: true}));
+	e.dispatchEvent(new Event('change', {bubbles: true}));
+	return true;
+})()`
+	// The center of the first element matching the selector (%s), in viewport coordinates.
+	elementCenterJS = `(() => {
+	const e = document.querySelector(%s);
+	if (!e) {
+		return null;
+	}
+	const r = e.getBoundingClientRect();
+	return {x: r.left + r.width / 2, y: r.top + r.height / 2};
+})()`
+)
+
+// Perform the actions in order, stopping at the first one that fails.
+func performActions(actions []request.Action) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		for i, action := range actions {
+			if err := performAction(ctx, action.WithDefaults()); err != nil {
+				return fmt.Errorf("action %d (%s): %w", i, action.Type, err)
+			}
+		}
+		return nil
+	})
+}
+
+func performAction(ctx context.Context, a request.Action) error {
+	actionCtx, cancel := context.WithTimeout(ctx, a.Timeout.Duration())
+	defer cancel()
+	switch a.Type {
+	case request.ActionClick:
+		return chromedp.Click(a.Selector, chromedp.NodeVisible).Do(actionCtx)
+	case request.ActionTypeText:
+		return chromedp.SendKeys(a.Selector, a.Text, chromedp.NodeVisible).Do(actionCtx)
+	case request.ActionPress:
+		key, ok := keys[a.Key]
+		if !ok {
+			key = a.Key
+		}
+		if a.Selector != "" {
+			if err := chromedp.Focus(a.Selector, chromedp.NodeVisible).Do(actionCtx); err != nil {
+				return err
+			}
+		}
+		return chromedp.KeyEvent(key).Do(actionCtx)
+	case request.ActionScroll:
+		for i := 0; i < a.Times; i++ {
+			if err := chromedp.Evaluate(scrollToBottomJS, nil).Do(ctx); err != nil {
+				return err
+			}
+			if err := sleep(ctx, a.Delay.Duration()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case request.ActionWait:
+		if a.Selector == "" {
+			return sleep(ctx, a.Delay.Duration())
+		}
+		if a.Visible {
+			return chromedp.WaitVisible(a.Selector).Do(actionCtx)
+		}
+		return chromedp.WaitReady(a.Selector).Do(actionCtx)
+	case request.ActionSelect:
+		if err := chromedp.WaitReady(a.Selector).Do(actionCtx); err != nil {
+			return err
+		}
+		var found bool
+		if err := chromedp.Evaluate(jsCall(selectOptionJS, a.Selector, a.Value), &found).Do(actionCtx); err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("selector %q did not match any elements", a.Selector)
+		}
+		return nil
+	case request.ActionHover:
+		if err := chromedp.ScrollIntoView(a.Selector, chromedp.NodeVisible).Do(actionCtx); err != nil {
+			return err
+		}
+		var center *struct{ X, Y float64 }
+		if err := chromedp.Evaluate(jsCall(elementCenterJS, a.Selector), &center).Do(actionCtx); err != nil {
+			return err
+		}
+		if center == nil {
+			return fmt.Errorf("selector %q did not match any elements", a.Selector)
+		}
+		return chromedp.MouseEvent(input.MouseMoved, center.X, center.Y).Do(actionCtx)
+	}
+	return fmt.Errorf("%w: %q", request.ErrInvalidActionType, a.Type)
+}
+
+// Fill in the JavaScript template with the args, encoded as JS string literals.
+func jsCall(template string, args ...string) string {
+	encoded := make([]any, len(args))
+	for i, arg := range args {
+		literal, _ := json.Marshal(arg)
+		encoded[i] = string(literal)
+	}
+	return fmt.Sprintf(template, encoded...)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
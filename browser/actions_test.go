@@ -0,0 +1,11 @@
+package browser
+
+import "testing"
+
+func TestJSCall(t *testing.T) {
+	got := jsCall(`f(%s, %s)`, `a"b`, "c\nd")
+	expected := `f("a\"b", "c\nd")`
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
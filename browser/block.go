@@ -0,0 +1,221 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/efixler/headless/request"
+)
+
+var (
+	// Keyed by the names in request.BlockableResourceTypes
+	blockableResourceTypes = map[string]network.ResourceType{
+		"image":      network.ResourceTypeImage,
+		"media":      network.ResourceTypeMedia,
+		"font":       network.ResourceTypeFont,
+		"stylesheet": network.ResourceTypeStylesheet,
+		"script":     network.ResourceTypeScript,
+	}
+)
+
+// blocker intercepts the requests made by a tab and fails the ones that
+// match its resource types or URL patterns, counting them by resource type.
+// Requests that fail the URL check are failed too, including the page itself
+// and its redirects. The requests it lets through get the credentials, if
+// they're to the credentials' origin.
+type blocker struct {
+	resourceTypes map[network.ResourceType]bool
+	// blocked without being counted, since the caller didn't ask for it
+	quiet       map[network.ResourceType]bool
+	patterns    []*regexp.Regexp
+	checkURL    URLCheck
+	credentials *credentials
+	mu          sync.Mutex
+	counts      map[string]int
+	deniedPage  error
+}
+
+// Returns nil if opts doesn't block anything and there's no URL check.
+func newBlocker(opts request.BlockOptions, checkURL URLCheck) (*blocker, error) {
+	if opts.IsEmpty() && (checkURL == nil) {
+		return nil, nil
+	}
+	b := emptyBlocker()
+	b.checkURL = checkURL
+	for _, rt := range opts.ResourceTypes {
+		resourceType, ok := blockableResourceTypes[strings.ToLower(rt)]
+		if !ok {
+			return nil, fmt.Errorf("can't block resource type %q", rt)
+		}
+		b.resourceTypes[resourceType] = true
+	}
+	for _, pattern := range opts.URLPatterns {
+		re, err := request.CompileURLPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		b.patterns = append(b.patterns, re)
+	}
+	return b, nil
+}
+
+func emptyBlocker() *blocker {
+	return &blocker{
+		resourceTypes: make(map[network.ResourceType]bool),
+		quiet:         make(map[network.ResourceType]bool),
+		counts:        make(map[string]int),
+	}
+}
+
+// Add resourceType to the requests that are blocked, without counting them
+// as blocked requests, creating a blocker if b is nil.
+func (b *blocker) blockQuietly(resourceType network.ResourceType) *blocker {
+	if b == nil {
+		b = emptyBlocker()
+	}
+	b.quiet[resourceType] = true
+	return b
+}
+
+// Add c to the requests that are let through, creating a blocker that
+// doesn't block anything if b is nil. Returns b unchanged if c is nil.
+func (b *blocker) sendCredentials(c *credentials) *blocker {
+	if c == nil {
+		return b
+	}
+	if b == nil {
+		b = emptyBlocker()
+	}
+	b.credentials = c
+	return b
+}
+
+// Whether to block a request, and whether to count it as blocked.
+func (b *blocker) blocks(resourceType network.ResourceType, url string) (blocked, counted bool) {
+	if b.resourceTypes[resourceType] {
+		return true, true
+	}
+	for _, re := range b.patterns {
+		if re.MatchString(url) {
+			return true, true
+		}
+	}
+	return b.quiet[resourceType], false
+}
+
+// Whether the blocker reports blocked requests: it does unless it only
+// blocks quietly.
+func (b *blocker) reports() bool {
+	return (b != nil) && ((len(b.resourceTypes) > 0) || (len(b.patterns) > 0) || (b.checkURL != nil))
+}
+
+// Blocked request counts, keyed by lower case resource type.
+func (b *blocker) blocked() map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counts := make(map[string]int, len(b.counts))
+	for k, v := range b.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// The URL check error for the page (or one of its redirects), if it was stopped.
+func (b *blocker) pageDenied() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.deniedPage
+}
+
+// Register the interception handler on the tab; call before running enable().
+// A nil blocker doesn't intercept anything.
+func (b *blocker) listen(ctx context.Context) {
+	if b == nil {
+		return
+	}
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		// CDP calls can't be made from inside the listener
+		go b.handle(ctx, paused)
+	})
+}
+
+func (b *blocker) handle(ctx context.Context, ev *fetch.EventRequestPaused) {
+	c := chromedp.FromContext(ctx)
+	execCtx := cdp.WithExecutor(ctx, c.Target)
+	mainDocument := (ev.ResourceType == network.ResourceTypeDocument) &&
+		(string(ev.FrameID) == string(c.Target.TargetID))
+	var err error
+	var denied error
+	if b.checkURL != nil {
+		denied = b.checkURL(ctx, ev.Request.URL)
+	}
+	blocked, counted := b.blocks(ev.ResourceType, ev.Request.URL)
+	switch {
+	case (denied != nil) && mainDocument:
+		b.mu.Lock()
+		b.deniedPage = denied
+		b.mu.Unlock()
+		slog.Info("Page URL not allowed", "url", ev.Request.URL, "err", denied)
+		err = fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(execCtx)
+	case (denied != nil) || (!mainDocument && blocked):
+		if (denied != nil) || counted {
+			b.mu.Lock()
+			b.counts[strings.ToLower(string(ev.ResourceType))]++
+			b.mu.Unlock()
+		}
+		slog.Debug("Blocking request", "url", ev.Request.URL, "type", ev.ResourceType, "err", denied)
+		err = fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(execCtx)
+	default:
+		params := fetch.ContinueRequest(ev.RequestID)
+		if headers := b.credentials.apply(ev.Request); headers != nil {
+			params = params.WithHeaders(headers)
+		}
+		err = params.Do(execCtx)
+	}
+	if (err != nil) && (ctx.Err() == nil) {
+		slog.Debug("Error handling intercepted request", "url", ev.Request.URL, "err", err)
+	}
+}
+
+// Turn on interception. Each intercepted request waits for the blocker to
+// let it through, so when only resource types are blocked, only requests of
+// those types are intercepted.
+func (b *blocker) enable() chromedp.Action {
+	if b == nil {
+		return chromedp.Tasks{}
+	}
+	if (b.checkURL != nil) || (b.credentials != nil) || (len(b.patterns) > 0) {
+		return fetch.Enable()
+	}
+	return fetch.Enable().WithPatterns(b.interceptPatterns())
+}
+
+// Patterns for the resource types the blocker blocks, in a stable order.
+func (b *blocker) interceptPatterns() []*fetch.RequestPattern {
+	var patterns []*fetch.RequestPattern
+	for _, resourceType := range blockableResourceTypes {
+		if b.resourceTypes[resourceType] || b.quiet[resourceType] {
+			patterns = append(patterns, &fetch.RequestPattern{URLPattern: "*", ResourceType: resourceType})
+		}
+	}
+	slices.SortFunc(patterns, func(a, b *fetch.RequestPattern) int {
+		return strings.Compare(string(a.ResourceType), string(b.ResourceType))
+	})
+	return patterns
+}
@@ -0,0 +1,66 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/efixler/headless/request"
+)
+
+func TestNewBlockerEmpty(t *testing.T) {
+	b, err := newBlocker(request.BlockOptions{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if b != nil {
+		t.Errorf("expected nil blocker for empty options")
+	}
+}
+
+func TestBlockerBlocks(t *testing.T) {
+	b, err := newBlocker(request.BlockOptions{
+		ResourceTypes: []string{"Image", "font"},
+		URLPatterns:   []string{"*://*.tracker.com/*"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	tests := []struct {
+		name         string
+		resourceType network.ResourceType
+		url          string
+		expect       bool
+	}{
+		{"image", network.ResourceTypeImage, "https://example.com/a.png", true},
+		{"font", network.ResourceTypeFont, "https://example.com/a.woff", true},
+		{"script", network.ResourceTypeScript, "https://example.com/a.js", false},
+		{"tracker script", network.ResourceTypeScript, "https://cdn.tracker.com/t.js", true},
+	}
+	for _, test := range tests {
+		if blocked, counted := b.blocks(test.resourceType, test.url); (blocked != test.expect) || (counted != test.expect) {
+			t.Errorf("[%s] expected blocked %t", test.name, test.expect)
+		}
+	}
+}
+
+func TestNewBlockerWithURLCheck(t *testing.T) {
+	denied := errors.New("denied")
+	b, err := newBlocker(request.BlockOptions{}, func(ctx context.Context, url string) error {
+		return denied
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if b == nil {
+		t.Fatal("expected a blocker when there's a URL check")
+	}
+	if b.pageDenied() != nil {
+		t.Errorf("expected no denied page before any requests")
+	}
+	var nilBlocker *blocker
+	if nilBlocker.pageDenied() != nil {
+		t.Errorf("expected no denied page for nil blocker")
+	}
+}
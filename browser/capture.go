@@ -0,0 +1,168 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/efixler/headless/request"
+)
+
+// capture holds the content produced for a request once the page is ready.
+// An empty contentType means the target's Content-Type should be kept.
+type capture struct {
+	body        []byte
+	contentType string
+	har         *harRecorder
+	// the page title, captured for FormatJSON, FormatArticle and FormatMeta
+	title string
+}
+
+// Start recording what's needed for the capture; call before navigating.
+func (c *capture) listen(ctx context.Context, opts fetchOptions) {
+	if opts.format == request.FormatHAR {
+		c.har = newHARRecorder()
+		chromedp.ListenTarget(ctx, c.har.handleEvent)
+	}
+}
+
+func (c *capture) action(opts fetchOptions) chromedp.Action {
+	switch opts.format {
+	case request.FormatScreenshot:
+		c.contentType = opts.screenshot.ContentType()
+		return screenshot(opts.screenshot, &c.body)
+	case request.FormatPDF:
+		c.contentType = "application/pdf"
+		return printToPDF(opts.pdf, &c.body)
+	case request.FormatHAR:
+		c.contentType = "application/json"
+		return chromedp.ActionFunc(func(ctx context.Context) error {
+			var title string
+			if err := chromedp.Title(&title).Do(ctx); err != nil {
+				return err
+			}
+			var err error
+			c.body, err = c.har.marshal(title, "")
+			return err
+		})
+	case request.FormatJSON, request.FormatArticle, request.FormatMeta:
+		// the body is replaced with the envelope, article or metadata once the
+		// request is done
+		c.contentType = "application/json"
+		return chromedp.ActionFunc(func(ctx context.Context) error {
+			var html string
+			if err := chromedp.OuterHTML("html", &html).Do(ctx); err != nil {
+				return err
+			}
+			c.body = []byte(html)
+			return chromedp.Title(&c.title).Do(ctx)
+		})
+	default:
+		return chromedp.ActionFunc(func(ctx context.Context) error {
+			var html string
+			if err := chromedp.OuterHTML("html", &html).Do(ctx); err != nil {
+				return err
+			}
+			c.body = []byte(html)
+			return nil
+		})
+	}
+}
+
+// The bounding box of the first element matching the selector (%s), relative
+// to the document.
+const elementClipJS = `(() => {
+	const e = document.querySelector(%s);
+	if (!e) {
+		return null;
+	}
+	const r = e.getBoundingClientRect();
+	return {x: r.left + window.scrollX, y: r.top + window.scrollY, width: r.width, height: r.height};
+})()`
+
+func screenshot(opts request.ScreenshotOptions, buf *[]byte) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		params := page.CaptureScreenshot().WithFromSurface(true)
+		switch opts.Type {
+		case request.ImageJPEG:
+			params = params.WithFormat(page.CaptureScreenshotFormatJpeg).WithQuality(int64(opts.Quality))
+		default:
+			params = params.WithFormat(page.CaptureScreenshotFormatPng)
+		}
+		switch {
+		case opts.FullPage:
+			_, _, _, _, _, contentSize, err := page.GetLayoutMetrics().Do(ctx)
+			if err != nil {
+				return err
+			}
+			params = params.WithCaptureBeyondViewport(true).WithClip(&page.Viewport{
+				Width:  math.Ceil(contentSize.Width),
+				Height: math.Ceil(contentSize.Height),
+				Scale:  1,
+			})
+		case opts.Selector != "":
+			clip, err := elementClip(ctx, opts.Selector)
+			if err != nil {
+				return err
+			}
+			params = params.WithCaptureBeyondViewport(true).WithClip(clip)
+		}
+		var err error
+		*buf, err = params.Do(ctx)
+		return err
+	})
+}
+
+func elementClip(ctx context.Context, selector string) (*page.Viewport, error) {
+	var clip *page.Viewport
+	if err := chromedp.Evaluate(jsCall(elementClipJS, selector), &clip).Do(ctx); err != nil {
+		return nil, err
+	}
+	if clip == nil {
+		return nil, fmt.Errorf("selector %q did not match any elements", selector)
+	}
+	// Align to whole pixels, like chromedp.ScreenshotNodes
+	x, y := math.Round(clip.X), math.Round(clip.Y)
+	clip.Width, clip.Height = math.Round(clip.Width+clip.X-x), math.Round(clip.Height+clip.Y-y)
+	clip.X, clip.Y = x, y
+	clip.Scale = 1
+	return clip, nil
+}
+
+func printToPDF(opts request.PDFOptions, buf *[]byte) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		params := page.PrintToPDF().
+			WithLandscape(opts.Landscape).
+			WithPrintBackground(opts.PrintBackground)
+		if width, height := opts.Dimensions(); width > 0 {
+			params = params.WithPaperWidth(width).WithPaperHeight(height)
+		}
+		if m := opts.Margins; m != nil {
+			params = params.
+				WithMarginTop(m.Top).
+				WithMarginRight(m.Right).
+				WithMarginBottom(m.Bottom).
+				WithMarginLeft(m.Left)
+		}
+		if opts.HeaderTemplate != "" || opts.FooterTemplate != "" {
+			// Chrome fills in a default for whichever template is empty,
+			// so an empty element is used to leave it blank.
+			params = params.
+				WithDisplayHeaderFooter(true).
+				WithHeaderTemplate(orBlank(opts.HeaderTemplate)).
+				WithFooterTemplate(orBlank(opts.FooterTemplate))
+		}
+		var err error
+		*buf, _, err = params.Do(ctx)
+		return err
+	})
+}
+
+func orBlank(template string) string {
+	if template == "" {
+		return "<span></span>"
+	}
+	return template
+}
@@ -0,0 +1,252 @@
+package browser
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/storage"
+	"github.com/chromedp/chromedp"
+	"github.com/efixler/headless/request"
+)
+
+// Set the cookies in the tab before it navigates to pageURL. Cookies without
+// a domain are host-only cookies for pageURL.
+func setCookies(pageURL string, cookies []request.Cookie) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if len(cookies) == 0 {
+			return nil
+		}
+		params := make([]*network.CookieParam, 0, len(cookies))
+		for _, c := range cookies {
+			params = append(params, cookieParam(pageURL, c))
+		}
+		return network.SetCookies(params).Do(ctx)
+	})
+}
+
+func cookieParam(pageURL string, c request.Cookie) *network.CookieParam {
+	p := &network.CookieParam{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		Secure:   c.Secure,
+		HTTPOnly: c.HTTPOnly,
+		SameSite: network.CookieSameSite(c.SameSite),
+	}
+	switch {
+	case c.Domain == "":
+		p.URL = pageURL
+	case strings.HasPrefix(c.Domain, "."):
+		p.Domain = c.Domain
+	default:
+		// setting the domain would make a domain cookie; a URL keeps it host-only
+		scheme := "http://"
+		if c.Secure {
+			scheme = "https://"
+		}
+		p.URL = scheme + c.Domain + c.Path
+	}
+	if c.Expires > 0 {
+		expires := cdp.TimeSinceEpoch(time.Unix(c.Expires, 0))
+		p.Expires = &expires
+	}
+	return p
+}
+
+// Collect all of the cookies in the tab's browser context, for the cookie jar
+// or session, and the ones the browser would send to the page's current URL,
+// which are the only ones returned to the caller.
+func getCookies(cookies, pageCookies *[]request.Cookie) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		c := chromedp.FromContext(ctx)
+		got, err := storage.GetCookies().
+			WithBrowserContextID(c.BrowserContextID).
+			Do(cdp.WithExecutor(ctx, c.Browser))
+		if err != nil {
+			return err
+		}
+		*cookies = fromNetworkCookies(got)
+		var location string
+		if err := chromedp.Location(&location).Do(ctx); err != nil {
+			return err
+		}
+		if got, err = network.GetCookies().WithUrls([]string{location}).Do(ctx); err != nil {
+			return err
+		}
+		*pageCookies = fromNetworkCookies(got)
+		return nil
+	})
+}
+
+func fromNetworkCookies(ncs []*network.Cookie) []request.Cookie {
+	cookies := make([]request.Cookie, 0, len(ncs))
+	for _, nc := range ncs {
+		cookies = append(cookies, fromNetworkCookie(nc))
+	}
+	return cookies
+}
+
+func fromNetworkCookie(nc *network.Cookie) request.Cookie {
+	c := request.Cookie{
+		Name:     nc.Name,
+		Value:    nc.Value,
+		Domain:   nc.Domain,
+		Path:     nc.Path,
+		HTTPOnly: nc.HTTPOnly,
+		Secure:   nc.Secure,
+		SameSite: nc.SameSite.String(),
+	}
+	if !nc.Session && (nc.Expires > 0) {
+		c.Expires = int64(nc.Expires)
+	}
+	return c
+}
+
+type cookieKey struct {
+	name, domain, path string
+}
+
+func keyOf(c request.Cookie) cookieKey {
+	return cookieKey{c.Name, c.Domain, c.Path}
+}
+
+// cookieJar keeps the cookies shared by all tabs in a file, so that they
+// outlast the browser and the process.
+type cookieJar struct {
+	path    string
+	mu      sync.Mutex
+	cookies map[cookieKey]request.Cookie
+}
+
+// Load the jar from the file at path, which is created when the jar is
+// first saved if it doesn't exist.
+func loadCookieJar(path string) (*cookieJar, error) {
+	j := &cookieJar{path: path, cookies: make(map[cookieKey]request.Cookie)}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return j, nil
+	case err != nil:
+		return nil, err
+	}
+	var cookies []request.Cookie
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, c := range cookies {
+		if !c.Expired(now) {
+			j.cookies[keyOf(c)] = c
+		}
+	}
+	return j, nil
+}
+
+// The unexpired cookies in the jar. A nil jar is empty.
+func (j *cookieJar) all() []request.Cookie {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	cookies := make([]request.Cookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		if !c.Expired(now) {
+			cookies = append(cookies, c)
+		}
+	}
+	return cookies
+}
+
+// Update the jar with the cookies a tab ended up with after it was given
+// sent, saving it if anything changed. Cookies that were sent but are gone
+// were deleted or expired by the page, so they're dropped from the jar.
+// Cookies with the name and value of one of own, the request's own cookies,
+// aren't saved, so that one caller's cookies aren't sent with everyone
+// else's requests; only cookies the page set or changed are.
+func (j *cookieJar) update(sent, got, own []request.Cookie) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	changed := false
+	remove := func(key cookieKey) {
+		if _, ok := j.cookies[key]; ok {
+			delete(j.cookies, key)
+			changed = true
+		}
+	}
+	kept := make(map[cookieKey]bool, len(got))
+	for _, c := range got {
+		kept[keyOf(c)] = true
+	}
+	for _, c := range sent {
+		if !kept[keyOf(c)] {
+			remove(keyOf(c))
+		}
+	}
+	now := time.Now()
+	for _, c := range got {
+		isOwn := slices.ContainsFunc(own, func(o request.Cookie) bool {
+			return (o.Name == c.Name) && (o.Value == c.Value)
+		})
+		switch {
+		case isOwn:
+			continue
+		case c.Expired(now):
+			remove(keyOf(c))
+		case j.cookies[keyOf(c)] != c:
+			j.cookies[keyOf(c)] = c
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return j.save()
+}
+
+// Write the jar's file, replacing it atomically. Call with the lock held.
+func (j *cookieJar) save() error {
+	cookies := make([]request.Cookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		cookies = append(cookies, c)
+	}
+	slices.SortFunc(cookies, func(a, b request.Cookie) int {
+		return cmp.Or(
+			strings.Compare(a.Domain, b.Domain),
+			strings.Compare(a.Path, b.Path),
+			strings.Compare(a.Name, b.Name),
+		)
+	})
+	data, err := json.MarshalIndent(cookies, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), j.path)
+}
@@ -0,0 +1,152 @@
+package browser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/efixler/headless/request"
+)
+
+func TestCookieParam(t *testing.T) {
+	tests := []struct {
+		name         string
+		cookie       request.Cookie
+		expectURL    string
+		expectDomain string
+	}{
+		{"no domain", request.Cookie{Name: "a"}, "https://foo.com/page", ""},
+		{"domain cookie", request.Cookie{Name: "a", Domain: ".foo.com"}, "", ".foo.com"},
+		{"host only", request.Cookie{Name: "a", Domain: "www.foo.com", Path: "/app"}, "http://www.foo.com/app", ""},
+		{"secure host only", request.Cookie{Name: "a", Domain: "www.foo.com", Secure: true}, "https://www.foo.com", ""},
+	}
+	for _, test := range tests {
+		p := cookieParam("https://foo.com/page", test.cookie)
+		if p.URL != test.expectURL || p.Domain != test.expectDomain {
+			t.Errorf("[%s] expected url %q and domain %q, got %q and %q", test.name, test.expectURL, test.expectDomain, p.URL, p.Domain)
+		}
+	}
+	expires := time.Unix(1900000000, 0)
+	p := cookieParam("https://foo.com/", request.Cookie{Name: "a", Expires: expires.Unix(), SameSite: "Lax"})
+	if p.Expires == nil || !p.Expires.Time().Equal(expires) {
+		t.Errorf("expected expiry %v, got %v", expires, p.Expires)
+	}
+	if p.SameSite != network.CookieSameSiteLax {
+		t.Errorf("expected same site Lax, got %q", p.SameSite)
+	}
+}
+
+func TestFromNetworkCookie(t *testing.T) {
+	session := fromNetworkCookie(&network.Cookie{Name: "a", Domain: "foo.com", Expires: -1, Session: true})
+	if session.Expires != 0 {
+		t.Errorf("expected no expiry for a session cookie, got %d", session.Expires)
+	}
+	persistent := fromNetworkCookie(&network.Cookie{Name: "b", Domain: ".foo.com", Expires: 1900000000.5, SameSite: network.CookieSameSiteStrict})
+	if persistent.Expires != 1900000000 || persistent.SameSite != "Strict" {
+		t.Errorf("unexpected cookie %+v", persistent)
+	}
+}
+
+func TestCookieJarMissingFile(t *testing.T) {
+	jar, err := loadCookieJar(filepath.Join(t.TempDir(), "cookies.json"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(jar.all()) != 0 {
+		t.Errorf("expected an empty jar, got %v", jar.all())
+	}
+	var nilJar *cookieJar
+	if nilJar.all() != nil || nilJar.update(nil, []request.Cookie{{Name: "a"}}, nil) != nil {
+		t.Error("expected a nil jar to be empty and ignore updates")
+	}
+}
+
+func TestCookieJarUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	jar, err := loadCookieJar(path)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	login := request.Cookie{Name: "session", Value: "abc", Domain: ".foo.com", Path: "/"}
+	prefs := request.Cookie{Name: "prefs", Value: "dark", Domain: "www.foo.com", Path: "/"}
+	if err := jar.update(nil, []request.Cookie{login, prefs}, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(jar.all()) != 2 {
+		t.Fatalf("expected 2 cookies, got %v", jar.all())
+	}
+
+	// the page logs out: the session cookie is gone and prefs is expired
+	expired := prefs
+	expired.Expires = time.Now().Add(-time.Hour).Unix()
+	if err := jar.update(jar.all(), []request.Cookie{expired}, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(jar.all()) != 0 {
+		t.Errorf("expected the jar to be empty, got %v", jar.all())
+	}
+
+	renewed := login
+	renewed.Value = "def"
+	if err := jar.update(nil, []request.Cookie{renewed}, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	reloaded, err := loadCookieJar(path)
+	if err != nil {
+		t.Fatalf("unexpected error reloading jar %v", err)
+	}
+	cookies := reloaded.all()
+	if len(cookies) != 1 || cookies[0] != renewed {
+		t.Errorf("expected %v after reloading, got %v", renewed, cookies)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the jar file to be private, got %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestCookieJarLeavesOutRequestCookies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	jar, err := loadCookieJar(path)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	shared := request.Cookie{Name: "prefs", Value: "dark", Domain: "www.foo.com", Path: "/"}
+	if err := jar.update(nil, []request.Cookie{shared}, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the caller's login, as it comes back from the browser with its domain set
+	own := []request.Cookie{{Name: "session", Value: "secret-login"}, {Name: "prefs", Value: "light"}}
+	sent := append(jar.all(), own...)
+	got := []request.Cookie{
+		{Name: "session", Value: "secret-login", Domain: "www.foo.com", Path: "/"},
+		{Name: "prefs", Value: "light", Domain: "www.foo.com", Path: "/"},
+		{Name: "visit", Value: "1", Domain: "www.foo.com", Path: "/"},
+	}
+	if err := jar.update(sent, got, own); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-login") || strings.Contains(string(data), "light") {
+		t.Errorf("expected the request's cookies to be left out of the jar, got %s", data)
+	}
+	if !strings.Contains(string(data), `"dark"`) || !strings.Contains(string(data), `"visit"`) {
+		t.Errorf("expected the jar's cookie and the one the page set to be kept, got %s", data)
+	}
+}
+
+func TestCookieJarOption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	if err := os.WriteFile(path, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b := &Chrome{}
+	if err := b.applyOptions([]ChromeOption{CookieJar(path)}); err == nil {
+		t.Error("expected an error for an invalid cookie jar file")
+	}
+}
@@ -0,0 +1,83 @@
+package browser
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+)
+
+var (
+	// Headers that carry the caller's credentials. These are only sent with
+	// requests to the page's origin, instead of to every host the page loads
+	// from.
+	credentialHeaders = map[string]bool{
+		"Authorization": true,
+		"Cookie":        true,
+	}
+	defaultPorts = map[string]string{
+		"http":  "80",
+		"https": "443",
+	}
+)
+
+// credentials are headers to add to the requests a tab makes to one origin.
+type credentials struct {
+	origin  string
+	headers network.Headers
+}
+
+// Returns nil if there are no headers to send.
+func newCredentials(pageURL *url.URL, headers network.Headers) *credentials {
+	if len(headers) == 0 {
+		return nil
+	}
+	return &credentials{origin: origin(pageURL), headers: headers}
+}
+
+// The scheme, host and port of u, in lower case and with the port explicit.
+func origin(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[scheme]
+	}
+	return scheme + "://" + strings.ToLower(u.Hostname()) + ":" + port
+}
+
+// The headers to continue a paused request with: its own headers plus the
+// credentials, if the request is to the credentials' origin. Returns nil if
+// the request should continue unchanged.
+func (c *credentials) apply(req *network.Request) []*fetch.HeaderEntry {
+	if c == nil {
+		return nil
+	}
+	u, err := url.Parse(req.URL)
+	if (err != nil) || (origin(u) != c.origin) {
+		return nil
+	}
+	var entries []*fetch.HeaderEntry
+	added := make(map[string]bool)
+	for name, value := range req.Headers {
+		v, _ := value.(string)
+		key := http.CanonicalHeaderKey(name)
+		if extra, ok := c.headers[key].(string); ok {
+			added[key] = true
+			if key == "Cookie" && v != "" {
+				// keep the browser's own cookies along with the caller's
+				v += "; " + extra
+			} else {
+				v = extra
+			}
+		}
+		entries = append(entries, &fetch.HeaderEntry{Name: name, Value: v})
+	}
+	for name, value := range c.headers {
+		if v, ok := value.(string); ok && !added[name] {
+			entries = append(entries, &fetch.HeaderEntry{Name: name, Value: v})
+		}
+	}
+	return entries
+}
@@ -0,0 +1,51 @@
+package browser
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+func TestCredentialsApply(t *testing.T) {
+	pageURL, _ := url.Parse("https://www.Foo.com/page")
+	c := newCredentials(pageURL, network.Headers{"Authorization": "Bearer secret", "Cookie": "a=1"})
+	tests := []struct {
+		name         string
+		url          string
+		headers      network.Headers
+		expectCookie string
+		expectAuth   string
+	}{
+		{"same origin", "https://www.foo.com/app.js", network.Headers{"Accept": "*/*"}, "a=1", "Bearer secret"},
+		{"explicit default port", "https://www.foo.com:443/", nil, "a=1", "Bearer secret"},
+		{"browser cookies", "https://www.foo.com/", network.Headers{"cookie": "b=2"}, "b=2; a=1", "Bearer secret"},
+		{"third party", "https://ads.example/pixel.gif", network.Headers{"Accept": "*/*"}, "", ""},
+		{"subdomain", "https://cdn.foo.com/app.js", nil, "", ""},
+		{"other scheme", "http://www.foo.com/", nil, "", ""},
+		{"other port", "https://www.foo.com:8443/", nil, "", ""},
+	}
+	for _, test := range tests {
+		entries := c.apply(&network.Request{URL: test.url, Headers: test.headers})
+		got := make(map[string]string)
+		for _, e := range entries {
+			got[e.Name] = e.Value
+		}
+		if cookie := got["Cookie"] + got["cookie"]; cookie != test.expectCookie {
+			t.Errorf("[%s] expected cookie %q, got %q", test.name, test.expectCookie, cookie)
+		}
+		if got["Authorization"] != test.expectAuth {
+			t.Errorf("[%s] expected authorization %q, got %q", test.name, test.expectAuth, got["Authorization"])
+		}
+		if (entries != nil) && (test.headers["Accept"] != nil) && (got["Accept"] != "*/*") {
+			t.Errorf("[%s] expected the request's own headers to be kept, got %v", test.name, got)
+		}
+	}
+	var none *credentials
+	if none.apply(&network.Request{URL: "https://www.foo.com/"}) != nil {
+		t.Error("expected nil credentials not to change requests")
+	}
+	if newCredentials(pageURL, network.Headers{}) != nil {
+		t.Error("expected no credentials without credential headers")
+	}
+}
@@ -0,0 +1,115 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	nurl "net/url"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// documentTracker follows the main frame's document requests, recording the
+// response for the final document and the chain of responses that led to it
+// (HTTP redirects, and documents replaced by a client-side navigation).
+type documentTracker struct {
+	mu        sync.Mutex
+	requestID network.RequestID
+	chain     []*network.Response
+	response  *network.Response
+}
+
+// Register the tracker's event listener on the tab; call before navigating.
+func (t *documentTracker) listen(ctx context.Context) {
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		switch ev := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			if (ev.Type != network.ResourceTypeDocument) || !isMainFrame(ctx, string(ev.FrameID)) {
+				return
+			}
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			switch {
+			case ev.RedirectResponse != nil:
+				t.chain = append(t.chain, ev.RedirectResponse)
+			case t.response != nil:
+				t.chain = append(t.chain, t.response)
+			}
+			t.requestID = ev.RequestID
+			t.response = nil
+		case *network.EventResponseReceived:
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if ev.RequestID != t.requestID {
+				return
+			}
+			t.response = ev.Response
+			slog.Debug("Received document response",
+				"url", ev.Response.URL,
+				"status", ev.Response.Status,
+				"statusText", ev.Response.StatusText,
+				"protocol", ev.Response.Protocol,
+			)
+		}
+	})
+}
+
+// Chrome uses the target's ID as the ID of its main frame.
+func isMainFrame(ctx context.Context, frameID string) bool {
+	c := chromedp.FromContext(ctx)
+	return (c != nil) && (c.Target != nil) && (frameID == string(c.Target.TargetID))
+}
+
+// Copy the final document's status and headers to the response, and link its
+// Request to the final URL and, through Request.Response, to the responses
+// that came before it. The response is unchanged if no document was received.
+func (t *documentTracker) apply(ctx context.Context, response *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.response == nil {
+		return
+	}
+	var prev *http.Response
+	for _, res := range t.chain {
+		hop := &http.Response{Header: http.Header{}}
+		copyResponse(res, hop)
+		hop.Request = newRequest(ctx, res.URL, prev)
+		prev = hop
+	}
+	copyResponse(t.response, response)
+	response.Request = newRequest(ctx, t.response.URL, prev)
+}
+
+func newRequest(ctx context.Context, url string, redirectedBy *http.Response) *http.Request {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		// Chrome has already loaded the url, so this shouldn't happen
+		req = (&http.Request{Method: http.MethodGet, URL: &nurl.URL{}, Header: http.Header{}}).WithContext(ctx)
+	}
+	req.Response = redirectedBy
+	return req
+}
+
+func copyResponse(res *network.Response, response *http.Response) {
+	// see https://chromedevtools.github.io/devtools-protocol/tot/Network/#type-Response
+	response.StatusCode = int(res.Status)
+	response.Status = fmt.Sprintf("%d %s", response.StatusCode, res.StatusText)
+	response.Proto = strings.ToUpper(res.Protocol)
+	response.ProtoMajor, response.ProtoMinor = extractHTTPVersion(res.Protocol)
+	for k, v := range res.Headers {
+		switch http.CanonicalHeaderKey(k) {
+		case "Content-Length":
+			continue
+		case "Content-Encoding":
+			continue
+		}
+		// Chrome joins repeated headers with newlines
+		for _, value := range strings.Split(fmt.Sprintf("%v", v), "\n") {
+			response.Header.Add(k, value)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package browser
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+func TestDocumentTrackerApply(t *testing.T) {
+	tracker := &documentTracker{
+		chain: []*network.Response{
+			{URL: "http://example.com/", Status: 301, StatusText: "Moved Permanently", Headers: network.Headers{"Location": "https://example.com/"}},
+			{URL: "https://example.com/", Status: 302, StatusText: "Found", Headers: network.Headers{"Location": "https://www.example.com/"}},
+		},
+		response: &network.Response{
+			URL:        "https://www.example.com/",
+			Status:     200,
+			StatusText: "OK",
+			Protocol:   "h2",
+			Headers: network.Headers{
+				"content-type":     "text/html",
+				"content-length":   "1234",
+				"content-encoding": "gzip",
+				"set-cookie":       "a=1\nb=2",
+			},
+		},
+	}
+	original, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	response := &http.Response{Header: http.Header{}, Request: original}
+	tracker.apply(context.Background(), response)
+
+	if response.StatusCode != 200 || response.Status != "200 OK" {
+		t.Errorf("unexpected status %d %q", response.StatusCode, response.Status)
+	}
+	if response.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2, got %d", response.ProtoMajor)
+	}
+	if response.Request.URL.String() != "https://www.example.com/" {
+		t.Errorf("expected final url, got %s", response.Request.URL)
+	}
+	if response.Header.Get("Content-Length") != "" || response.Header.Get("Content-Encoding") != "" {
+		t.Errorf("expected Content-Length and Content-Encoding to be dropped, got %v", response.Header)
+	}
+	if cookies := response.Header.Values("Set-Cookie"); len(cookies) != 2 {
+		t.Errorf("expected 2 Set-Cookie headers, got %v", cookies)
+	}
+	var urls []string
+	var statuses []int
+	for hop := response.Request.Response; hop != nil; hop = hop.Request.Response {
+		urls = append(urls, hop.Request.URL.String())
+		statuses = append(statuses, hop.StatusCode)
+	}
+	if len(urls) != 2 || urls[0] != "https://example.com/" || urls[1] != "http://example.com/" {
+		t.Errorf("unexpected redirect chain %v", urls)
+	}
+	if len(statuses) != 2 || statuses[0] != 302 || statuses[1] != 301 {
+		t.Errorf("unexpected redirect statuses %v", statuses)
+	}
+}
+
+func TestDocumentTrackerNoResponse(t *testing.T) {
+	original, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	response := &http.Response{Header: http.Header{}, Request: original}
+	(&documentTracker{}).apply(context.Background(), response)
+	if response.Request != original || response.StatusCode != 0 {
+		t.Errorf("expected response to be unchanged")
+	}
+}
@@ -0,0 +1,41 @@
+package browser
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/efixler/headless/request"
+)
+
+// Build the envelope for a page captured with FormatJSON from the response,
+// with the target's status and headers, and the captured content.
+func newEnvelope(url string, response *http.Response, header http.Header, content *capture) request.Envelope {
+	env := request.Envelope{
+		URL:       url,
+		FinalURL:  response.Request.URL.String(),
+		Status:    response.StatusCode,
+		Headers:   header,
+		HTML:      string(content.body),
+		Title:     content.title,
+		Redirects: []request.Redirect{},
+		Warnings:  []string{},
+	}
+	// Request.Response links back through the chain, newest first
+	for hop := response.Request.Response; (hop != nil) && (hop.Request != nil); hop = hop.Request.Response {
+		env.Redirects = append(env.Redirects, request.Redirect{URL: hop.Request.URL.String(), Status: hop.StatusCode})
+	}
+	slices.Reverse(env.Redirects)
+	return env
+}
+
+// Warnings for the scripts that threw.
+func scriptWarnings(results []request.ScriptResult) []string {
+	var warnings []string
+	for i, result := range results {
+		if result.Error != "" {
+			warnings = append(warnings, fmt.Sprintf("script %d: %s", i, result.Error))
+		}
+	}
+	return warnings
+}
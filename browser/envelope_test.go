@@ -0,0 +1,51 @@
+package browser
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/efixler/headless/request"
+)
+
+func TestNewEnvelope(t *testing.T) {
+	ctx := context.Background()
+	redirect := &http.Response{StatusCode: http.StatusMovedPermanently, Request: newRequest(ctx, "http://foo.com/", nil)}
+	replaced := &http.Response{StatusCode: http.StatusOK, Request: newRequest(ctx, "https://foo.com/", redirect)}
+	response := &http.Response{StatusCode: http.StatusOK, Request: newRequest(ctx, "https://www.foo.com/", replaced)}
+	header := http.Header{"Content-Type": {"text/html"}}
+	content := &capture{body: []byte("<html></html>"), title: "Foo"}
+
+	env := newEnvelope("http://foo.com/", response, header, content)
+	if env.URL != "http://foo.com/" || env.FinalURL != "https://www.foo.com/" {
+		t.Errorf("unexpected urls %q and %q", env.URL, env.FinalURL)
+	}
+	if env.Status != http.StatusOK || env.Headers.Get("Content-Type") != "text/html" {
+		t.Errorf("unexpected status %d and headers %v", env.Status, env.Headers)
+	}
+	if env.HTML != "<html></html>" || env.Title != "Foo" {
+		t.Errorf("unexpected content %q and title %q", env.HTML, env.Title)
+	}
+	expected := []request.Redirect{{URL: "http://foo.com/", Status: 301}, {URL: "https://foo.com/", Status: 200}}
+	if len(env.Redirects) != len(expected) {
+		t.Fatalf("expected redirects %v, got %v", expected, env.Redirects)
+	}
+	for i := range expected {
+		if env.Redirects[i] != expected[i] {
+			t.Errorf("expected redirect %d to be %v, got %v", i, expected[i], env.Redirects[i])
+		}
+	}
+	if env.Warnings == nil {
+		t.Error("expected warnings to be an empty list, not null")
+	}
+}
+
+func TestScriptWarnings(t *testing.T) {
+	warnings := scriptWarnings([]request.ScriptResult{
+		{Value: []byte("1")},
+		{Error: "ReferenceError: foo is not defined"},
+	})
+	if len(warnings) != 1 || warnings[0] != "script 1: ReferenceError: foo is not defined" {
+		t.Errorf("unexpected warnings %v", warnings)
+	}
+}
@@ -0,0 +1,40 @@
+package browser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/efixler/headless"
+	"github.com/efixler/headless/metadata"
+	"github.com/efixler/headless/readability"
+)
+
+// The JSON body for a page captured with FormatArticle: the article
+// extracted from the captured HTML of the page at pageURL.
+func articleBody(content *capture, pageURL string) ([]byte, error) {
+	article, err := readability.Extract(bytes.NewReader(content.body), pageURL)
+	if errors.Is(err, readability.ErrNoContent) {
+		return nil, &headless.HTTPError{StatusCode: http.StatusUnprocessableEntity, Message: err.Error()}
+	} else if err != nil {
+		return nil, err
+	}
+	if article.Title == "" {
+		article.Title = content.title
+	}
+	return json.Marshal(article)
+}
+
+// The JSON body for a page captured with FormatMeta: the metadata extracted
+// from the captured HTML of the page at pageURL.
+func metaBody(content *capture, pageURL string) ([]byte, error) {
+	meta, err := metadata.Extract(bytes.NewReader(content.body), pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Title == "" {
+		meta.Title = content.title
+	}
+	return json.Marshal(meta)
+}
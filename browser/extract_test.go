@@ -0,0 +1,57 @@
+package browser
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/efixler/headless"
+	"github.com/efixler/headless/metadata"
+	"github.com/efixler/headless/readability"
+)
+
+func TestArticleBody(t *testing.T) {
+	content := &capture{
+		body:  []byte(`<html><body><p>Some article text, with a <a href="/more">link</a>.</p></body></html>`),
+		title: "Document Title",
+	}
+	body, err := articleBody(content, "https://foo.com/story")
+	if err != nil {
+		t.Fatalf("articleBody() error: %v", err)
+	}
+	var article readability.Article
+	if err := json.Unmarshal(body, &article); err != nil {
+		t.Fatalf("can't decode article %s: %v", body, err)
+	}
+	if article.Title != "Document Title" {
+		t.Errorf("expected the document title when the page has none, got %q", article.Title)
+	}
+	if article.URL != "https://foo.com/story" || article.Text != "Some article text, with a link." {
+		t.Errorf("unexpected article %+v", article)
+	}
+
+	_, err = articleBody(&capture{body: []byte("<html><body></body></html>")}, "https://foo.com/")
+	var httpErr *headless.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected a 422 error for a page with no content, got %v", err)
+	}
+}
+
+func TestMetaBody(t *testing.T) {
+	content := &capture{
+		body:  []byte(`<html><head><link rel="canonical" href="/story"></head><body></body></html>`),
+		title: "Document Title",
+	}
+	body, err := metaBody(content, "https://foo.com/story?page=2")
+	if err != nil {
+		t.Fatalf("metaBody() error: %v", err)
+	}
+	var meta metadata.Metadata
+	if err := json.Unmarshal(body, &meta); err != nil {
+		t.Fatalf("can't decode metadata %s: %v", body, err)
+	}
+	if meta.Title != "Document Title" || meta.Canonical != "https://foo.com/story" {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+}
@@ -0,0 +1,309 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	nurl "net/url"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/har"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+)
+
+const (
+	harVersion = "1.2"
+	harPageID  = "page_1"
+)
+
+// harRecorder collects the network activity for a tab as HAR entries.
+type harRecorder struct {
+	mu            sync.Mutex
+	records       []*harRecord
+	byID          map[network.RequestID]*harRecord
+	onContentLoad time.Time
+	onLoad        time.Time
+}
+
+type harRecord struct {
+	entry  *har.Entry
+	start  time.Time
+	timing *network.ResourceTiming
+	// the decoded length of the body received so far
+	dataLength int64
+}
+
+func newHARRecorder() *harRecorder {
+	return &harRecorder{byID: make(map[network.RequestID]*harRecord)}
+}
+
+// Event listener; pass to chromedp.ListenTarget before navigating.
+func (r *harRecorder) handleEvent(ev interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch ev := ev.(type) {
+	case *network.EventRequestWillBeSent:
+		if rec, ok := r.byID[ev.RequestID]; ok && ev.RedirectResponse != nil {
+			rec.setResponse(ev.RedirectResponse)
+			rec.entry.Response.RedirectURL = ev.Request.URL
+			rec.finish(ev.Timestamp, ev.RedirectResponse.EncodedDataLength)
+		}
+		rec := newHARRecord(ev)
+		r.records = append(r.records, rec)
+		r.byID[ev.RequestID] = rec
+	case *network.EventResponseReceived:
+		if rec, ok := r.byID[ev.RequestID]; ok {
+			rec.setResponse(ev.Response)
+		}
+	case *network.EventDataReceived:
+		if rec, ok := r.byID[ev.RequestID]; ok {
+			rec.dataLength += ev.DataLength
+		}
+	case *network.EventLoadingFinished:
+		if rec, ok := r.byID[ev.RequestID]; ok {
+			rec.finish(ev.Timestamp, ev.EncodedDataLength)
+		}
+	case *network.EventLoadingFailed:
+		if rec, ok := r.byID[ev.RequestID]; ok {
+			rec.entry.Comment = ev.ErrorText
+			if ev.BlockedReason != "" {
+				rec.entry.Comment = fmt.Sprintf("%s (%s)", ev.ErrorText, ev.BlockedReason)
+			}
+			rec.finish(ev.Timestamp, 0)
+		}
+	case *page.EventDomContentEventFired:
+		r.onContentLoad = monotonic(ev.Timestamp)
+	case *page.EventLoadEventFired:
+		r.onLoad = monotonic(ev.Timestamp)
+	}
+}
+
+// Build the HAR document for the activity recorded so far. The comment is
+// for the log as a whole, such as why the page failed to load.
+func (r *harRecorder) har(title, comment string) *har.HAR {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	log := &har.Log{
+		Version: harVersion,
+		Creator: &har.Creator{Name: "headless", Version: moduleVersion()},
+		Entries: make([]*har.Entry, 0, len(r.records)),
+		Comment: comment,
+	}
+	if len(r.records) == 0 {
+		return &har.HAR{Log: log}
+	}
+	first := r.records[0]
+	timings := &har.PageTimings{OnContentLoad: -1, OnLoad: -1}
+	if !r.onContentLoad.IsZero() {
+		timings.OnContentLoad = millis(r.onContentLoad.Sub(first.start))
+	}
+	if !r.onLoad.IsZero() {
+		timings.OnLoad = millis(r.onLoad.Sub(first.start))
+	}
+	log.Pages = []*har.Page{{
+		StartedDateTime: first.entry.StartedDateTime,
+		ID:              harPageID,
+		Title:           title,
+		PageTimings:     timings,
+	}}
+	for _, rec := range r.records {
+		entry := *rec.entry
+		if entry.Response == nil {
+			entry.Response = emptyHARResponse()
+			if entry.Comment == "" {
+				entry.Comment = "incomplete"
+			}
+		}
+		log.Entries = append(log.Entries, &entry)
+	}
+	return &har.HAR{Log: log}
+}
+
+func (r *harRecorder) marshal(title, comment string) ([]byte, error) {
+	return json.Marshal(r.har(title, comment))
+}
+
+func newHARRecord(ev *network.EventRequestWillBeSent) *harRecord {
+	var started time.Time
+	if ev.WallTime != nil {
+		started = ev.WallTime.Time()
+	}
+	req := &har.Request{
+		Method:      ev.Request.Method,
+		URL:         ev.Request.URL,
+		Cookies:     []*har.Cookie{},
+		Headers:     harHeaders(ev.Request.Headers),
+		QueryString: harQueryString(ev.Request.URL),
+		HeadersSize: -1,
+		BodySize:    int64(len(ev.Request.PostData)),
+	}
+	if ev.Request.HasPostData {
+		req.PostData = &har.PostData{
+			MimeType: headerValue(ev.Request.Headers, "Content-Type"),
+			Params:   []*har.Param{},
+			Text:     ev.Request.PostData,
+		}
+	}
+	return &harRecord{
+		entry: &har.Entry{
+			Pageref:         harPageID,
+			StartedDateTime: started.UTC().Format(time.RFC3339Nano),
+			Request:         req,
+			Cache:           &har.Cache{},
+			Timings:         &har.Timings{Blocked: -1, DNS: -1, Connect: -1, Ssl: -1},
+		},
+		start: monotonic(ev.Timestamp),
+	}
+}
+
+func (rec *harRecord) setResponse(res *network.Response) {
+	major, minor := extractHTTPVersion(res.Protocol)
+	version := fmt.Sprintf("HTTP/%d.%d", major, minor)
+	rec.entry.Request.HTTPVersion = version
+	if len(res.RequestHeaders) > 0 {
+		rec.entry.Request.Headers = harHeaders(res.RequestHeaders)
+	}
+	rec.entry.Response = &har.Response{
+		Status:      res.Status,
+		StatusText:  res.StatusText,
+		HTTPVersion: version,
+		Cookies:     []*har.Cookie{},
+		Headers:     harHeaders(res.Headers),
+		Content: &har.Content{
+			MimeType: res.MimeType,
+		},
+		RedirectURL: headerValue(res.Headers, "Location"),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	rec.entry.ServerIPAddress = res.RemoteIPAddress
+	if res.ConnectionID > 0 {
+		rec.entry.Connection = fmt.Sprint(res.ConnectionID)
+	}
+	rec.timing = res.Timing
+}
+
+// Complete the entry's sizes and timings when the request is done.
+func (rec *harRecord) finish(ts *cdp.MonotonicTime, encodedDataLength float64) {
+	end := monotonic(ts)
+	total := millis(end.Sub(rec.start))
+	if res := rec.entry.Response; res != nil {
+		// bodySize is what was transferred; content.size is the decoded body
+		res.BodySize = int64(encodedDataLength)
+		res.Content.Size = rec.dataLength
+	}
+	timings := rec.entry.Timings
+	t := rec.timing
+	if t == nil {
+		timings.Wait = total
+		rec.entry.Time = total
+		return
+	}
+	timings.Blocked = firstNonNegative(t.DNSStart, t.ConnectStart, t.SendStart)
+	if t.DNSStart >= 0 {
+		timings.DNS = t.DNSEnd - t.DNSStart
+	}
+	if t.ConnectStart >= 0 {
+		timings.Connect = t.ConnectEnd - t.ConnectStart
+	}
+	if t.SslStart >= 0 {
+		timings.Ssl = t.SslEnd - t.SslStart
+	}
+	timings.Send = t.SendEnd - t.SendStart
+	timings.Wait = t.ReceiveHeadersEnd - t.SendEnd
+	// The response timing is relative to when the network stack sent the request,
+	// which can be later than when the page issued it.
+	requestTime := cdp.MonotonicTimeEpoch.Add(time.Duration(t.RequestTime * float64(time.Second)))
+	requestEnd := millis(end.Sub(requestTime))
+	timings.Receive = max(0, requestEnd-t.ReceiveHeadersEnd)
+	rec.entry.Time = 0
+	for _, v := range []float64{timings.Blocked, timings.DNS, timings.Connect, timings.Send, timings.Wait, timings.Receive} {
+		if v > 0 {
+			rec.entry.Time += v
+		}
+	}
+}
+
+func emptyHARResponse() *har.Response {
+	return &har.Response{
+		Cookies:     []*har.Cookie{},
+		Headers:     []*har.NameValuePair{},
+		Content:     &har.Content{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+}
+
+func harHeaders(headers network.Headers) []*har.NameValuePair {
+	pairs := make([]*har.NameValuePair, 0, len(headers))
+	for k, v := range headers {
+		pairs = append(pairs, &har.NameValuePair{Name: k, Value: fmt.Sprint(v)})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs
+}
+
+func harQueryString(url string) []*har.NameValuePair {
+	pairs := []*har.NameValuePair{}
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return pairs
+	}
+	for k, values := range u.Query() {
+		for _, v := range values {
+			pairs = append(pairs, &har.NameValuePair{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs
+}
+
+// Case-insensitive header lookup
+func headerValue(headers network.Headers, name string) string {
+	for k, v := range headers {
+		if http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(name) {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// The version of the headless module, as recorded in the build info.
+func moduleVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/efixler/headless" {
+				return dep.Version
+			}
+		}
+		if info.Main.Path == "github.com/efixler/headless" && info.Main.Version != "" {
+			return info.Main.Version
+		}
+	}
+	return "(devel)"
+}
+
+func monotonic(ts *cdp.MonotonicTime) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.Time()
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func firstNonNegative(values ...float64) float64 {
+	for _, v := range values {
+		if v >= 0 {
+			return v
+		}
+	}
+	return -1
+}
@@ -0,0 +1,144 @@
+package browser
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/har"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+)
+
+func monotonicAt(seconds float64) *cdp.MonotonicTime {
+	t := cdp.MonotonicTime(cdp.MonotonicTimeEpoch.Add(time.Duration(seconds * float64(time.Second))))
+	return &t
+}
+
+func TestHARRecorder(t *testing.T) {
+	wall := cdp.TimeSinceEpoch(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+	r := newHARRecorder()
+	events := []interface{}{
+		&network.EventRequestWillBeSent{
+			RequestID: "1",
+			Request:   &network.Request{Method: "GET", URL: "http://example.com/?b=2&a=1"},
+			Timestamp: monotonicAt(100),
+			WallTime:  &wall,
+		},
+		&network.EventRequestWillBeSent{
+			RequestID: "1",
+			Request:   &network.Request{Method: "GET", URL: "https://example.com/"},
+			Timestamp: monotonicAt(100.1),
+			WallTime:  &wall,
+			RedirectResponse: &network.Response{
+				Status:   301,
+				Headers:  network.Headers{"location": "https://example.com/"},
+				Protocol: "http/1.1",
+			},
+		},
+		&network.EventResponseReceived{
+			RequestID: "1",
+			Response: &network.Response{
+				Status:     200,
+				StatusText: "OK",
+				MimeType:   "text/html",
+				Protocol:   "h2",
+				Timing: &network.ResourceTiming{
+					RequestTime:       100.1,
+					DNSStart:          -1,
+					ConnectStart:      -1,
+					SslStart:          -1,
+					SendStart:         1,
+					SendEnd:           2,
+					ReceiveHeadersEnd: 50,
+				},
+			},
+		},
+		&network.EventDataReceived{RequestID: "1", DataLength: 3000, EncodedDataLength: 1000},
+		&network.EventDataReceived{RequestID: "1", DataLength: 2000, EncodedDataLength: 234},
+		&network.EventLoadingFinished{RequestID: "1", Timestamp: monotonicAt(100.2), EncodedDataLength: 1234},
+		&network.EventRequestWillBeSent{
+			RequestID: "2",
+			Request:   &network.Request{Method: "GET", URL: "https://ads.example.com/a.js"},
+			Timestamp: monotonicAt(100.25),
+			WallTime:  &wall,
+		},
+		&network.EventLoadingFailed{RequestID: "2", Timestamp: monotonicAt(100.26), ErrorText: "net::ERR_BLOCKED_BY_CLIENT"},
+		&network.EventRequestWillBeSent{
+			RequestID: "3",
+			Request:   &network.Request{Method: "GET", URL: "https://example.com/slow.js"},
+			Timestamp: monotonicAt(100.3),
+			WallTime:  &wall,
+		},
+		&page.EventDomContentEventFired{Timestamp: monotonicAt(100.5)},
+		&page.EventLoadEventFired{Timestamp: monotonicAt(101)},
+	}
+	for _, ev := range events {
+		r.handleEvent(ev)
+	}
+	data, err := r.marshal("Example", "")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var doc har.HAR
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("can't unmarshal HAR: %v", err)
+	}
+	log := doc.Log
+	if log.Version != "1.2" {
+		t.Errorf("expected version 1.2, got %s", log.Version)
+	}
+	if len(log.Pages) != 1 || log.Pages[0].Title != "Example" {
+		t.Fatalf("expected one page titled Example, got %+v", log.Pages)
+	}
+	if log.Pages[0].PageTimings.OnLoad != 1000 {
+		t.Errorf("expected onLoad 1000ms, got %v", log.Pages[0].PageTimings.OnLoad)
+	}
+	if len(log.Entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(log.Entries))
+	}
+	redirect := log.Entries[0]
+	if redirect.Response.Status != 301 || redirect.Response.RedirectURL != "https://example.com/" {
+		t.Errorf("unexpected redirect response %+v", redirect.Response)
+	}
+	if len(redirect.Request.QueryString) != 2 || redirect.Request.QueryString[0].Name != "a" {
+		t.Errorf("unexpected query string %+v", redirect.Request.QueryString)
+	}
+	final := log.Entries[1]
+	if final.Response.Status != 200 || final.Response.HTTPVersion != "HTTP/2.0" {
+		t.Errorf("unexpected final response %+v", final.Response)
+	}
+	if final.Response.BodySize != 1234 || final.Response.Content.Size != 5000 {
+		t.Errorf("expected body size 1234 and content size 5000, got %d and %d", final.Response.BodySize, final.Response.Content.Size)
+	}
+	if final.Timings.Wait != 48 || final.Timings.Send != 1 {
+		t.Errorf("unexpected timings %+v", final.Timings)
+	}
+	if final.Timings.Receive < 49 || final.Timings.Receive > 51 {
+		t.Errorf("expected ~50ms receive time, got %v", final.Timings.Receive)
+	}
+	if failed := log.Entries[2]; failed.Comment != "net::ERR_BLOCKED_BY_CLIENT" {
+		t.Errorf("expected failure comment, got %q", failed.Comment)
+	}
+	if incomplete := log.Entries[3]; incomplete.Response == nil || incomplete.Comment != "incomplete" {
+		t.Errorf("expected incomplete entry, got %+v", incomplete)
+	}
+}
+
+func TestHARRecorderEmpty(t *testing.T) {
+	data, err := newHARRecorder().marshal("", "")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var doc har.HAR
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("can't unmarshal HAR: %v", err)
+	}
+	if doc.Log.Creator.Name != "headless" || doc.Log.Creator.Version == "" {
+		t.Errorf("unexpected creator %+v", doc.Log.Creator)
+	}
+	if doc.Log.Entries == nil || len(doc.Log.Entries) != 0 || doc.Log.Pages != nil || doc.Log.Comment != "" {
+		t.Errorf("expected an empty entries list and no pages, got %s", data)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/efixler/headless"
 )
 
 func TestMustSetMaxTabsForTabs(t *testing.T) {
@@ -65,3 +67,20 @@ func TestAcquireTab(t *testing.T) {
 		t.Fatalf("Unexpected error acquiring tab: %v", err)
 	}
 }
+
+func TestTabReleasedWhenContextDone(t *testing.T) {
+	c, err := NewChrome(context.Background(), MaxTabs(1), TabAcquireTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewChrome failed: %v", err)
+	}
+	b, err := c.AcquireTab()
+	if err != nil {
+		t.Fatalf("AcquireTab failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.(headless.Fetcher).GetContext(ctx, "\\\\xyz::invalid.url", nil)
+	if _, err = c.AcquireTab(); err != nil {
+		t.Fatalf("expected tab to be released, got %v", err)
+	}
+}
@@ -1,18 +1,24 @@
 package browser
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/chromedp/cdproto/emulation"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 	"github.com/efixler/headless"
+	"github.com/efixler/headless/request"
 	"golang.org/x/sync/semaphore"
 )
 
@@ -27,22 +33,87 @@ func NewChrome(ctx context.Context, options ...ChromeOption) (*Chrome, error) {
 	if err := b.applyOptions(options); err != nil {
 		return nil, err
 	}
-	b.ctx, b.Cancel = chromedp.NewExecAllocator(ctx, b.config.allocatorOptions...)
+	b.ctx, b.Cancel = context.WithCancel(ctx)
+	b.supervisor = &supervisor{
+		launch:       b.launchInstance,
+		recycleAfter: b.config.recycleAfter,
+		maxMemory:    b.config.maxMemory,
+	}
+	go b.supervisor.monitor(b.ctx, b.config.healthCheckInterval)
+	b.sessions = newSessions(b.config.sessionTTL, b.config.maxSessions)
+	go b.sessions.expireEvery(b.ctx, min(b.config.sessionTTL, maxSessionExpireInterval))
+	if b.config.remoteURL == "" {
+		return b, nil
+	}
+	// Chrome may not be up yet; the connection is made (and retried) when needed
+	discoverCtx, cancel := context.WithTimeout(ctx, remoteDiscoveryTimeout)
+	defer cancel()
+	if version, err := discoverRemote(discoverCtx, b.config.remoteURL); err != nil {
+		slog.Warn("Can't reach remote Chrome, will retry when needed", "url", b.config.remoteURL, "err", err)
+	} else {
+		slog.Info("Using remote Chrome", "url", b.config.remoteURL, "browser", version.Browser)
+	}
 	return b, nil
 }
 
+// The browser is launched when it's first needed, and is replaced if it exits,
+// stops responding, or is due to be recycled. Each request gets a new tab in
+// its own browser context, so requests don't share cookies or storage, unless
+// they're in the same named session.
 type Chrome struct {
 	ctx        context.Context
 	Cancel     context.CancelFunc
 	tabTimeout time.Duration
 	sem        *semaphore.Weighted
 	config     *config
+	supervisor *supervisor
+	sessions   *sessions
+	tabsInUse  atomic.Int64
+}
+
+// Stats is a snapshot of the browser's tab usage and restarts.
+type Stats struct {
+	TabsInUse int
+	MaxTabs   int
+	// The number of times the browser has been replaced
+	Restarts int
+}
+
+func (b *Chrome) Stats() Stats {
+	return Stats{
+		TabsInUse: int(b.tabsInUse.Load()),
+		MaxTabs:   b.config.maxTabs,
+		Restarts:  b.supervisor.restartCount(),
+	}
+}
+
+// A tab holds one of the Chrome's tab slots until its first request completes,
+// or until that request's context is done, whichever comes first.
+type tab struct {
+	chrome  *Chrome
+	release func()
+}
+
+func (t *tab) Get(url string, headers http.Header) (*http.Response, error) {
+	return t.GetContext(context.Background(), url, headers)
+}
+
+func (t *tab) GetContext(ctx context.Context, url string, headers http.Header) (*http.Response, error) {
+	defer t.release()
+	stop := context.AfterFunc(ctx, t.release)
+	defer stop()
+	return t.chrome.GetContext(ctx, url, headers)
 }
 
-type browserFunc func(url string, headers http.Header) (*http.Response, error)
+func (t *tab) Fetch(payload *request.Payload) (*http.Response, error) {
+	return t.FetchContext(context.Background(), payload)
+}
 
-func (f browserFunc) Get(url string, headers http.Header) (*http.Response, error) {
-	return f(url, headers)
+func (t *tab) FetchContext(ctx context.Context, payload *request.Payload) (*http.Response, error) {
+	defer t.release()
+	stop := context.AfterFunc(ctx, t.release)
+	defer stop()
+	return t.chrome.FetchContext(ctx, payload)
 }
 
 func (b *Chrome) AcquireTab() (headless.Browser, error) {
@@ -54,80 +125,364 @@ func (b *Chrome) AcquireTab() (headless.Browser, error) {
 	if err := b.sem.Acquire(tabWaitContext, 1); err != nil {
 		return nil, errors.Join(err, ErrMaxTabs)
 	}
+	return &tab{chrome: b, release: b.holdTab()}, nil
+}
+
+// Count a tab slot that was just acquired from the semaphore as in use, until
+// the returned func is called. It's safe to call more than once.
+func (b *Chrome) holdTab() func() {
+	b.tabsInUse.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.tabsInUse.Add(-1)
+			b.sem.Release(1)
+		})
+	}
+}
+
+// Per-request settings, resolved from the request payload and the browser defaults.
+type fetchOptions struct {
+	wait       request.WaitStrategy
+	timeout    time.Duration
+	format     request.Format
+	screenshot request.ScreenshotOptions
+	pdf        request.PDFOptions
+	block      request.BlockOptions
+	actions    []request.Action
+	scripts    []string
+	cookies    []request.Cookie
+	session    sessionKey
+}
+
+// The blocker for a tab. Images aren't loaded unless the format needs them,
+// since they're not part of the page's HTML; they're only reported as
+// blocked requests when the caller asked for them to be blocked. Chrome can't
+// turn images off for one tab, so they're blocked by intercepting image
+// requests.
+func newTabBlocker(opts fetchOptions, checkURL URLCheck) (*blocker, error) {
+	b, err := newBlocker(opts.block, checkURL)
+	if (err != nil) || opts.format.NeedsImages() {
+		return b, err
+	}
+	return b.blockQuietly(network.ResourceTypeImage), nil
+}
+
+func (b *Chrome) defaultFetchOptions() fetchOptions {
+	return fetchOptions{
+		wait:    b.config.waitStrategy,
+		timeout: b.config.requestTimeout,
+		block:   b.config.block,
+	}
+}
+
+func (b *Chrome) Fetch(payload *request.Payload) (*http.Response, error) {
+	return b.FetchContext(context.Background(), payload)
+}
 
-	f := func(url string, headers http.Header) (*http.Response, error) {
-		defer b.sem.Release(1)
-		return b.Get(url, headers)
+func (b *Chrome) FetchContext(ctx context.Context, payload *request.Payload) (*http.Response, error) {
+	headers := make(http.Header)
+	for k, v := range payload.Headers {
+		headers.Set(k, v)
+	}
+	opts := b.defaultFetchOptions()
+	if payload.Wait != nil {
+		opts.wait = *payload.Wait
+	}
+	if payload.Timeout > 0 {
+		opts.timeout = payload.Timeout.Duration()
+	}
+	if payload.Format != "" {
+		opts.format = payload.Format
+	}
+	if payload.Screenshot != nil {
+		opts.screenshot = *payload.Screenshot
+	}
+	if payload.PDF != nil {
+		opts.pdf = *payload.PDF
+	}
+	if payload.Block != nil {
+		opts.block = *payload.Block
 	}
-	return browserFunc(f), nil
+	opts.actions = payload.Actions
+	opts.scripts = payload.Scripts
+	opts.cookies = payload.Cookies
+	if payload.Session != "" {
+		opts.session = sessionKey{owner: SessionOwner(ctx), name: payload.Session}
+	}
+	return b.get(ctx, payload.URL, headers, opts)
 }
 
 func (b *Chrome) Get(url string, headers http.Header) (*http.Response, error) {
-	request, err := http.NewRequest(http.MethodGet, url, nil)
+	return b.GetContext(context.Background(), url, headers)
+}
+
+func (b *Chrome) GetContext(ctx context.Context, url string, headers http.Header) (*http.Response, error) {
+	return b.get(ctx, url, headers, b.defaultFetchOptions())
+}
+
+// The tab's lifetime is bound to the browser, but the request is abandoned
+// (and the tab closed) when reqCtx is done or when opts.timeout elapses.
+func (b *Chrome) get(
+	reqCtx context.Context,
+	url string,
+	headers http.Header,
+	opts fetchOptions,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	ctx, cancel := chromedp.NewContext(b.ctx)
+	inst, err := b.supervisor.acquire(reqCtx, true)
+	if err != nil {
+		slog.Error("Can't start browser", "err", err)
+		return nil, &headless.HTTPError{StatusCode: http.StatusServiceUnavailable, Message: err.Error()}
+	}
+	defer b.supervisor.release(inst)
+	// the payload's cookies go last so they replace any from the jar or session
+	sentCookies := b.config.cookieJar.all()
+	// all of the context's cookies, and the ones for the page's URL
+	var cookies, pageCookies []request.Cookie
+	tabContext := chromedp.WithNewBrowserContext()
+	if opts.session.name != "" {
+		contextID, restore, err := b.sessions.acquire(inst, opts.session)
+		if err != nil {
+			slog.Error("Can't open session", "session", opts.session.name, "err", err)
+			return nil, &headless.HTTPError{StatusCode: http.StatusServiceUnavailable, Message: err.Error()}
+		}
+		defer func() { b.sessions.release(opts.session, cookies) }()
+		// sessions keep their own cookies instead of using the jar
+		sentCookies = restore
+		tabContext = chromedp.WithExistingBrowserContext(contextID)
+	}
+	sentCookies = append(sentCookies, opts.cookies...)
+	tabCtx, cancel := chromedp.NewContext(inst.ctx, tabContext)
 	defer cancel()
+	stop := context.AfterFunc(reqCtx, cancel)
+	defer stop()
+	if (b.config.remoteURL != "") && (b.config.userAgent != "") && (headers.Get("User-Agent") == "") {
+		if headers = headers.Clone(); headers == nil {
+			headers = make(http.Header)
+		}
+		headers.Set("User-Agent", b.config.userAgent)
+	}
+	ctx := tabCtx
+	if opts.timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(tabCtx, opts.timeout)
+		defer cancelTimeout()
+	}
 
-	var html string
+	content := &capture{}
+	var scriptResults []request.ScriptResult
 	response := &http.Response{
 		Header:  http.Header{},
-		Request: request,
-	}
-
-	listenCtx, cancelListen := context.WithCancel(ctx)
-	chromedp.ListenTarget(listenCtx, func(ev interface{}) {
-		if res, ok := ev.(*network.EventResponseReceived); ok {
-			// see https://chromedevtools.github.io/devtools-protocol/tot/Network/#type-Response
-			// The first event should be a 'Document' type response with the status of the page load
-			response.StatusCode = int(res.Response.Status)
-			response.Status = fmt.Sprintf("%d %s", response.StatusCode, res.Response.StatusText)
-			response.Proto = strings.ToUpper(res.Response.Protocol)
-			response.ProtoMajor, response.ProtoMinor = extractHTTPVersion(res.Response.Protocol)
-			slog.Debug("Received network event from page",
-				"url", res.Response.URL,
-				"type", res.Type,
-				"status", response.Status,
-				"statusText", res.Response.StatusText,
-				"protocol", res.Response.Protocol,
-			)
-			headers := res.Response.Headers
-			for k, v := range headers {
-				switch http.CanonicalHeaderKey(k) {
-				case "Content-Length":
-					continue
-				case "Content-Encoding":
-					continue
-				}
-				response.Header.Add(k, fmt.Sprintf("%v", v))
-				slog.Debug("Header", "key", k, "value", v)
-			}
-			cancelListen()
-		}
-	})
+		Request: req,
+	}
+
+	document := &documentTracker{}
+	document.listen(ctx)
+	blocker, err := newTabBlocker(opts, b.config.checkURL)
+	if err != nil {
+		return nil, err
+	}
+	userAgent, extra, credentialHeaders := splitHeaders(headers)
+	blocker = blocker.sendCredentials(newCredentials(req.URL, credentialHeaders))
+	blocker.listen(ctx)
+	content.listen(ctx, opts)
+	watcher := newPageWatcher()
+	chromedp.ListenTarget(ctx, watcher.handleEvent)
 	slog.Debug("Navigating to:", "url", url)
-	// TODO: add passHeaders to request
+	var navigated time.Duration
+	start := time.Now()
 	err = chromedp.Run(ctx,
-		chromedp.Navigate(request.URL.String()),
-		chromedp.Sleep(1*time.Second),
+		b.remoteTabActions(),
+		headerActions(userAgent, extra),
+		setCookies(req.URL.String(), sentCookies),
+		blocker.enable(),
+		watcher.navigate(req.URL.String()),
+		watcher.waitFor(opts.wait),
+		chromedp.ActionFunc(func(context.Context) error {
+			navigated = time.Since(start)
+			return nil
+		}),
 		chromedp.WaitReady("body"),
-		chromedp.OuterHTML("html", &html),
+		performActions(opts.actions),
+		evaluateScripts(opts.scripts, &scriptResults),
+		content.action(opts),
+		getCookies(&cookies, &pageCookies),
 	)
 
-	if err != nil {
+	if observe := b.config.observeNavigation; observe != nil {
+		if navigated > 0 {
+			observe(navigated, nil)
+		} else {
+			observe(time.Since(start), err)
+		}
+	}
+	if (err != nil) && (reqCtx.Err() != nil) {
+		err = reqCtx.Err()
+	} else if denied := blocker.pageDenied(); denied != nil {
+		err = &headless.HTTPError{StatusCode: http.StatusForbidden, Message: denied.Error()}
+	}
+	var httpErr *headless.HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		response.StatusCode = httpErr.StatusCode
+		response.Status = fmt.Sprintf("%d %s", response.StatusCode, httpErr.Error())
+		slog.Error("Error getting HTML content", "url", url, "err", err)
+	case err != nil:
 		// see https://github.com/chromedp/chromedp/blob/ebf842c7bc28db77d0bf4d757f5948d769d0866f/nav.go#L26
 		// bad domain = page load error net::ERR_NAME_NOT_RESOLVED
 		response.StatusCode = http.StatusBadGateway
+		if errors.Is(err, context.DeadlineExceeded) {
+			response.StatusCode = http.StatusGatewayTimeout
+		}
 		response.Status = fmt.Sprintf("%d %s", response.StatusCode, err.Error())
 		slog.Error("Error getting HTML content", "url", url, "err", err)
-
+	default:
+		document.apply(reqCtx, response)
+		targetHeader := response.Header.Clone()
+		response.Header.Set(headless.FinalURLHeader, response.Request.URL.String())
+		// the page loaded, so the headers and cookies are kept below even if
+		// its content can't be formatted
+		switch opts.format {
+		case request.FormatJSON:
+			env := newEnvelope(url, response, targetHeader, content)
+			env.Timings = request.Timings{
+				NavigationMS: navigated.Milliseconds(),
+				TotalMS:      time.Since(start).Milliseconds(),
+			}
+			env.Warnings = append(env.Warnings, watcher.warned()...)
+			env.Warnings = append(env.Warnings, scriptWarnings(scriptResults)...)
+			env.ScriptResults = scriptResults
+			if blocker.reports() {
+				env.BlockedRequests = blocker.blocked()
+			}
+			env.Cookies = pageCookies
+			content.body, err = json.Marshal(env)
+		case request.FormatArticle:
+			content.body, err = articleBody(content, response.Request.URL.String())
+		case request.FormatMeta:
+			content.body, err = metaBody(content, response.Request.URL.String())
+		}
+	}
+	if err != nil {
+		// Only the HAR is worth returning when the page failed to load; it's
+		// most useful then, so send what was recorded up to the failure with
+		// the error as its comment.
+		content.body = nil
+		if content.har != nil {
+			if data, harErr := content.har.marshal("", err.Error()); harErr == nil {
+				content.body = data
+			}
+		}
+	}
+	if len(scriptResults) > 0 {
+		setJSONHeader(response.Header, headless.ScriptResultsHeader, scriptResults)
+	}
+	if len(pageCookies) > 0 {
+		setJSONHeader(response.Header, headless.CookiesHeader, pageCookies)
+	}
+	if (cookies != nil) && (opts.session.name == "") {
+		if err := b.config.cookieJar.update(sentCookies, cookies, opts.cookies); err != nil {
+			slog.Error("Error saving cookie jar", "err", err)
+		}
+	}
+	if blocker.reports() {
+		setJSONHeader(response.Header, headless.BlockedRequestsHeader, blocker.blocked())
+	}
+	if content.contentType != "" {
+		response.Header.Set("Content-Type", content.contentType)
 	}
-	response.ContentLength = int64(len(html))
-	response.Body = io.NopCloser(strings.NewReader(html))
+	response.ContentLength = int64(len(content.body))
+	response.Body = io.NopCloser(bytes.NewReader(content.body))
 	return response, err
 }
 
+// JSON metadata headers larger than this are left out of the response, since
+// proxies and load balancers commonly reject responses with more than 8 to
+// 16KB of headers.
+const maxJSONHeaderSize = 4096
+
+// Set the header to the JSON encoding of v, unless it's over
+// maxJSONHeaderSize, in which case a warning header says it was left out.
+func setJSONHeader(header http.Header, name string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("Error encoding response header", "header", name, "err", err)
+		return
+	}
+	if len(data) > maxJSONHeaderSize {
+		slog.Warn("Response header too large, leaving it out", "header", name, "size", len(data))
+		header.Add(headless.WarningHeader, fmt.Sprintf(
+			"%s left out: %d bytes is over the %d byte limit, use format json for the full value",
+			name, len(data), maxJSONHeaderSize,
+		))
+		return
+	}
+	header.Set(name, string(data))
+}
+
+var (
+	// Headers that describe the inbound connection or are computed by the browser
+	// for each request; these are never forwarded to the target.
+	skipHeaders = map[string]bool{
+		"Connection":          true,
+		"Content-Length":      true,
+		"Host":                true,
+		"Keep-Alive":          true,
+		"Proxy-Authorization": true,
+		"Proxy-Connection":    true,
+		"Te":                  true,
+		"Trailer":             true,
+		"Transfer-Encoding":   true,
+		"Upgrade":             true,
+	}
+)
+
+// Split the headers to send into a user agent override, the credentials that
+// should only be sent to the page's origin, and the remaining headers that
+// should be sent along with every request the tab makes.
+func splitHeaders(headers http.Header) (userAgent string, extra, credentials network.Headers) {
+	extra = make(network.Headers)
+	credentials = make(network.Headers)
+	for k, v := range headers {
+		key := http.CanonicalHeaderKey(k)
+		switch {
+		case len(v) == 0:
+			continue
+		case skipHeaders[key]:
+			continue
+		case key == "User-Agent":
+			userAgent = v[0]
+			continue
+		case key == "Cookie":
+			credentials[key] = strings.Join(v, "; ")
+			continue
+		case credentialHeaders[key]:
+			credentials[key] = strings.Join(v, ", ")
+			continue
+		}
+		extra[key] = strings.Join(v, ", ")
+	}
+	return
+}
+
+// Actions that apply the extra headers to the navigation and to all of the
+// sub-resource requests made by the tab. The user agent, when set, overrides
+// the browser's user agent for this tab only.
+func headerActions(userAgent string, extra network.Headers) chromedp.Tasks {
+	tasks := chromedp.Tasks{}
+	if userAgent != "" {
+		tasks = append(tasks, emulation.SetUserAgentOverride(userAgent))
+	}
+	if len(extra) > 0 {
+		tasks = append(tasks, network.Enable(), network.SetExtraHTTPHeaders(extra))
+	}
+	return tasks
+}
+
 func extractHTTPVersion(protocol string) (major, minor int) {
 	major = 1
 	protocol = strings.ToUpper(protocol)
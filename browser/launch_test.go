@@ -2,7 +2,14 @@ package browser
 
 import (
 	"context"
+	"net/http"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/efixler/headless"
+	"github.com/efixler/headless/request"
 )
 
 func TestGetErrorsOnInvalidURL(t *testing.T) {
@@ -67,3 +74,141 @@ func TestExtractProtocolVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitHeaders(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("User-Agent", "fooagent")
+	headers.Set("Accept-Language", "en-US")
+	headers.Add("Cookie", "a=1")
+	headers.Add("Cookie", "b=2")
+	headers.Set("Host", "www.example.com")
+	headers.Set("Content-Length", "42")
+	headers.Set("authorization", "Bearer secret")
+	headers["x-lowercase"] = []string{"yes"}
+
+	userAgent, extra, credentials := splitHeaders(headers)
+	if userAgent != "fooagent" {
+		t.Errorf("expected user agent %q, got %q", "fooagent", userAgent)
+	}
+	expected := map[string]string{
+		"Accept-Language": "en-US",
+		"X-Lowercase":     "yes",
+	}
+	if len(extra) != len(expected) {
+		t.Errorf("expected %d headers, got %d: %v", len(expected), len(extra), extra)
+	}
+	for k, v := range expected {
+		if extra[k] != v {
+			t.Errorf("[%s] expected %q, got %q", k, v, extra[k])
+		}
+	}
+	expectedCredentials := map[string]string{
+		"Authorization": "Bearer secret",
+		"Cookie":        "a=1; b=2",
+	}
+	if len(credentials) != len(expectedCredentials) {
+		t.Errorf("expected %d credential headers, got %d: %v", len(expectedCredentials), len(credentials), credentials)
+	}
+	for k, v := range expectedCredentials {
+		if credentials[k] != v {
+			t.Errorf("[%s] expected %q, got %q", k, v, credentials[k])
+		}
+	}
+}
+
+func TestSplitHeadersEmpty(t *testing.T) {
+	userAgent, extra, credentials := splitHeaders(nil)
+	if userAgent != "" {
+		t.Errorf("expected empty user agent, got %q", userAgent)
+	}
+	if len(extra) != 0 || len(credentials) != 0 {
+		t.Errorf("expected no headers, got %v and %v", extra, credentials)
+	}
+	if tasks := headerActions(userAgent, extra); len(tasks) != 0 {
+		t.Errorf("expected no actions, got %d", len(tasks))
+	}
+}
+
+func TestStatsTabsInUse(t *testing.T) {
+	c, err := NewChrome(context.Background(), MaxTabs(2))
+	if err != nil {
+		t.Fatalf("NewChrome failed: %v", err)
+	}
+	defer c.Cancel()
+	b, err := c.AcquireTab()
+	if err != nil {
+		t.Fatalf("AcquireTab failed: %v", err)
+	}
+	if stats := c.Stats(); stats.TabsInUse != 1 || stats.MaxTabs != 2 {
+		t.Errorf("expected 1 of 2 tabs in use, got %+v", stats)
+	}
+	// the tab is released when its request is done, even if it fails
+	b.Get("\\xyz::invalid.url", nil)
+	if stats := c.Stats(); stats.TabsInUse != 0 {
+		t.Errorf("expected no tabs in use, got %d", stats.TabsInUse)
+	}
+}
+
+func TestTabBlockerImages(t *testing.T) {
+	tests := []struct {
+		name            string
+		format          request.Format
+		block           []string
+		expectBlocked   bool
+		expectCounted   bool
+		expectReports   bool
+		expectIntercept []network.ResourceType
+	}{
+		{"html", "", nil, true, false, false, []network.ResourceType{network.ResourceTypeImage}},
+		{"html with other blocks", request.FormatHTML, []string{"font"}, true, false, true,
+			[]network.ResourceType{network.ResourceTypeFont, network.ResourceTypeImage}},
+		{"images asked for", request.FormatJSON, []string{"Image"}, true, true, true,
+			[]network.ResourceType{network.ResourceTypeImage}},
+		{"screenshot", request.FormatScreenshot, nil, false, false, false, nil},
+		{"pdf", request.FormatPDF, []string{"font"}, false, false, true, []network.ResourceType{network.ResourceTypeFont}},
+		{"har", request.FormatHAR, nil, false, false, false, nil},
+	}
+	for _, test := range tests {
+		opts := fetchOptions{format: test.format, block: request.BlockOptions{ResourceTypes: test.block}}
+		b, err := newTabBlocker(opts, nil)
+		if err != nil {
+			t.Fatalf("[%s] newTabBlocker() error: %v", test.name, err)
+		}
+		if b == nil {
+			if test.expectBlocked || test.expectReports || (len(test.expectIntercept) > 0) {
+				t.Errorf("[%s] expected a blocker", test.name)
+			}
+			continue
+		}
+		blocked, counted := b.blocks(network.ResourceTypeImage, "https://foo.com/a.png")
+		if (blocked != test.expectBlocked) || (counted != test.expectCounted) {
+			t.Errorf("[%s] expected images blocked %t and counted %t, got %t and %t",
+				test.name, test.expectBlocked, test.expectCounted, blocked, counted)
+		}
+		if b.reports() != test.expectReports {
+			t.Errorf("[%s] expected reports %t", test.name, test.expectReports)
+		}
+		var intercepted []network.ResourceType
+		for _, p := range b.interceptPatterns() {
+			intercepted = append(intercepted, p.ResourceType)
+		}
+		if !slices.Equal(intercepted, test.expectIntercept) {
+			t.Errorf("[%s] expected to intercept %v, got %v", test.name, test.expectIntercept, intercepted)
+		}
+	}
+}
+
+func TestSetJSONHeader(t *testing.T) {
+	header := http.Header{}
+	setJSONHeader(header, "X-Small", map[string]int{"image": 2})
+	if header.Get("X-Small") != `{"image":2}` {
+		t.Errorf("unexpected header value %q", header.Get("X-Small"))
+	}
+	setJSONHeader(header, "X-Large", []string{strings.Repeat("a", maxJSONHeaderSize)})
+	if _, ok := header["X-Large"]; ok {
+		t.Error("expected a header over the limit to be left out")
+	}
+	if warning := header.Get(headless.WarningHeader); !strings.HasPrefix(warning, "X-Large left out") {
+		t.Errorf("expected a warning about the large header, got %q", warning)
+	}
+}
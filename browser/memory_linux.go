@@ -0,0 +1,72 @@
+package browser
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Resident memory, in bytes, of the process and all of its descendants,
+// which for Chrome includes the renderer and GPU processes.
+func processTreeRSS(pid int) (int64, error) {
+	children := make(map[int][]int)
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return 0, err
+	}
+	for _, stat := range stats {
+		p, ppid, err := readParent(stat)
+		if err != nil {
+			// processes come and go while we're looking
+			continue
+		}
+		children[ppid] = append(children[ppid], p)
+	}
+	var total int64
+	pageSize := int64(os.Getpagesize())
+	queue := []int{pid}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = append(queue[1:], children[p]...)
+		statm, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", p))
+		if err != nil {
+			if p == pid {
+				return 0, err
+			}
+			continue
+		}
+		fields := bytes.Fields(statm)
+		if len(fields) < 2 {
+			continue
+		}
+		pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+		if err != nil {
+			continue
+		}
+		total += pages * pageSize
+	}
+	return total, nil
+}
+
+// The pid and parent pid from a /proc/<pid>/stat file
+func readParent(stat string) (pid, ppid int, err error) {
+	data, err := os.ReadFile(stat)
+	if err != nil {
+		return 0, 0, err
+	}
+	// the command name is in parentheses and can contain spaces
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return 0, 0, fmt.Errorf("malformed %s", stat)
+	}
+	if _, err := fmt.Sscanf(string(data[:bytes.IndexByte(data, ' ')]), "%d", &pid); err != nil {
+		return 0, 0, err
+	}
+	var state string
+	if _, err := fmt.Sscanf(string(data[end+1:]), " %s %d", &state, &ppid); err != nil {
+		return 0, 0, err
+	}
+	return pid, ppid, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package browser
+
+import "errors"
+
+func processTreeRSS(pid int) (int64, error) {
+	return 0, errors.New("browser memory checks are only supported on linux")
+}
@@ -1,19 +1,46 @@
 package browser
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/chromedp/chromedp"
+	"github.com/efixler/headless/request"
 	"github.com/efixler/headless/ua"
 	"golang.org/x/sync/semaphore"
 )
 
+const (
+	DefaultRequestTimeout = 30 * time.Second
+)
+
 type config struct {
-	allocatorOptions []chromedp.ExecAllocatorOption
-	userAgent        string
-	windowSize       [2]int
+	allocatorOptions    []chromedp.ExecAllocatorOption
+	userAgent           string
+	windowSize          [2]int
+	waitStrategy        request.WaitStrategy
+	requestTimeout      time.Duration
+	block               request.BlockOptions
+	checkURL            URLCheck
+	remoteURL           string
+	healthCheckInterval time.Duration
+	recycleAfter        int
+	maxMemory           int64
+	maxTabs             int
+	observeNavigation   NavigationObserver
+	cookieJar           *cookieJar
+	sessionTTL          time.Duration
+	maxSessions         int
 }
 
+// NavigationObserver is called with the time taken to navigate to each page
+// and wait for it to be ready, and the error if that failed.
+type NavigationObserver func(d time.Duration, err error)
+
+// URLCheck returns an error for URLs that the browser shouldn't request.
+type URLCheck func(ctx context.Context, url string) error
+
 type ChromeOption func(*Chrome) error
 
 func CDPOptions(cdps ...chromedp.ExecAllocatorOption) ChromeOption {
@@ -51,6 +78,7 @@ func UserAgentIfNotEmpty(uas ...string) ChromeOption {
 func MaxTabs(n int) ChromeOption {
 	return func(b *Chrome) error {
 		b.sem = semaphore.NewWeighted(int64(n))
+		b.config.maxTabs = n
 		return nil
 	}
 }
@@ -62,6 +90,140 @@ func TabAcquireTimeout(d time.Duration) ChromeOption {
 	}
 }
 
+// Sets the sub-resource requests to block for requests that don't specify
+// their own block options. Blocked requests are intercepted, which costs a
+// round trip to the browser for each request of a blocked resource type, or
+// for every request when there are URL patterns.
+func Block(opts request.BlockOptions) ChromeOption {
+	return func(b *Chrome) error {
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+		b.config.block = opts
+		return nil
+	}
+}
+
+// Checks every request the browser makes while rendering, including redirects
+// and sub-resources, failing the ones whose URL doesn't pass the check. When
+// the page itself is stopped, the request fails with a 403 headless.HTTPError.
+func CheckURLs(check URLCheck) ChromeOption {
+	return func(b *Chrome) error {
+		b.config.checkURL = check
+		return nil
+	}
+}
+
+// Sends all of the browser's traffic through the HTTP proxy at proxyURL,
+// including requests to loopback addresses, which Chrome otherwise sends
+// directly, and WebRTC, which is otherwise sent over UDP. Only applies to
+// browsers that are launched, not remote ones.
+func ProxyServer(proxyURL string) ChromeOption {
+	return func(b *Chrome) error {
+		b.config.allocatorOptions = append(b.config.allocatorOptions,
+			chromedp.ProxyServer(proxyURL),
+			chromedp.Flag("proxy-bypass-list", "<-loopback>"),
+			chromedp.Flag("force-webrtc-ip-handling-policy", "disable_non_proxied_udp"),
+		)
+		return nil
+	}
+}
+
+// Sets the maximum time for a request to navigate, wait for the page to be ready,
+// and capture its content, for requests that don't specify their own timeout.
+// Zero means no timeout.
+func RequestTimeout(d time.Duration) ChromeOption {
+	return func(b *Chrome) error {
+		if d < 0 {
+			return fmt.Errorf("request timeout can't be negative: %s", d)
+		}
+		b.config.requestTimeout = d
+		return nil
+	}
+}
+
+// Sets how often to check that the browser is responsive, replacing it if not.
+// Zero disables the checks; a browser that exits is still replaced.
+func HealthCheckInterval(d time.Duration) ChromeOption {
+	return func(b *Chrome) error {
+		if d < 0 {
+			return fmt.Errorf("health check interval can't be negative: %s", d)
+		}
+		b.config.healthCheckInterval = d
+		return nil
+	}
+}
+
+// Replaces the browser after it has loaded n pages, once those pages are done.
+// Zero means never.
+func RecycleAfter(n int) ChromeOption {
+	return func(b *Chrome) error {
+		if n < 0 {
+			return fmt.Errorf("recycle page count can't be negative: %d", n)
+		}
+		b.config.recycleAfter = n
+		return nil
+	}
+}
+
+// Replaces the browser, once its pages are done, when the resident memory of
+// its processes goes over the limit, checked with the health checks. Only
+// supported for browsers launched on Linux. Zero means no limit.
+func MaxMemory(bytes int64) ChromeOption {
+	return func(b *Chrome) error {
+		if bytes < 0 {
+			return fmt.Errorf("max memory can't be negative: %d", bytes)
+		}
+		b.config.maxMemory = bytes
+		return nil
+	}
+}
+
+// Reports navigation times, e.g. for metrics.
+func ObserveNavigations(observer NavigationObserver) ChromeOption {
+	return func(b *Chrome) error {
+		b.config.observeNavigation = observer
+		return nil
+	}
+}
+
+// Shares cookies between tabs through a JSON file at path, which is loaded
+// now and saved whenever a page changes the cookies, so that sessions
+// survive restarts. The file is created if it doesn't exist.
+func CookieJar(path string) ChromeOption {
+	return func(b *Chrome) error {
+		jar, err := loadCookieJar(path)
+		if err != nil {
+			return fmt.Errorf("can't load cookie jar: %w", err)
+		}
+		b.config.cookieJar = jar
+		return nil
+	}
+}
+
+// Sets how long a named session can be idle before it's closed.
+func SessionTTL(d time.Duration) ChromeOption {
+	return func(b *Chrome) error {
+		if d <= 0 {
+			return fmt.Errorf("session TTL must be positive: %s", d)
+		}
+		b.config.sessionTTL = d
+		return nil
+	}
+}
+
+// Sets the most named sessions that can be open at once; requests that would
+// open another fail with a 503 headless.HTTPError. Zero means no limit.
+func MaxSessions(n int) ChromeOption {
+	return func(b *Chrome) error {
+		if n < 0 {
+			return fmt.Errorf("max sessions can't be negative: %d", n)
+		}
+		b.config.maxSessions = n
+		return nil
+	}
+}
+
 func WindowSize(w, h int) ChromeOption {
 	return func(b *Chrome) error {
 		b.config.windowSize = [2]int{w, h}
@@ -69,11 +231,23 @@ func WindowSize(w, h int) ChromeOption {
 	}
 }
 
+// Sets how to decide that a page is ready for requests that don't specify
+// their own wait strategy. The default is to wait for the load event and then
+// for one second.
+func DefaultWait(ws request.WaitStrategy) ChromeOption {
+	return func(b *Chrome) error {
+		if err := ws.Validate(); err != nil {
+			return err
+		}
+		b.config.waitStrategy = ws
+		return nil
+	}
+}
+
 func getDefaults() config {
 	return config{
 		allocatorOptions: []chromedp.ExecAllocatorOption{
 			chromedp.Flag("disable-dev-shm-usage", true),
-			chromedp.Flag("blink-settings", "imagesEnabled=false"),
 			chromedp.NoFirstRun,
 			chromedp.NoDefaultBrowserCheck,
 			// chromedp.NoSandbox, TODO: Figure out what is better here in headless mode
@@ -81,7 +255,15 @@ func getDefaults() config {
 			// chromedp.IgnoreCertErrors, // check this when using proxies
 			// chromedp.Flag("mute-audio", true), // included in Headless
 		},
-		windowSize: [2]int{1366, 768},
+		windowSize:          [2]int{1366, 768},
+		requestTimeout:      DefaultRequestTimeout,
+		healthCheckInterval: DefaultHealthCheckInterval,
+		sessionTTL:          DefaultSessionTTL,
+		maxSessions:         DefaultMaxSessions,
+		waitStrategy: request.WaitStrategy{
+			Type:  request.WaitDelay,
+			Delay: request.Duration(request.DefaultDelay),
+		},
 	}
 }
 
@@ -0,0 +1,115 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	nurl "net/url"
+	"time"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	remoteDiscoveryTimeout = 5 * time.Second
+)
+
+// Connect to a Chrome that's already running (e.g. in another container)
+// instead of launching one. The url can be the DevTools HTTP endpoint
+// (http://host:9222), a bare host:port, or a browser websocket URL
+// (ws://host:9222/devtools/browser/<id>). Either way, the browser's websocket
+// URL is discovered from /json/version for each new connection, so a remote
+// Chrome that restarts is reconnected to when the connection is replaced.
+//
+// Launch options like Headless and CDPOptions don't apply to a remote Chrome;
+// the default user agent and window size are applied to each tab instead.
+func RemoteAllocator(url string) ChromeOption {
+	return func(b *Chrome) error {
+		remoteURL, err := normalizeRemoteURL(url)
+		if err != nil {
+			return err
+		}
+		b.config.remoteURL = remoteURL
+		return nil
+	}
+}
+
+// Reduce the url to the ws://host:port form that chromedp resolves through
+// /json/version when connecting. A browser-specific path is dropped, since
+// the browser ID changes when Chrome restarts.
+func normalizeRemoteURL(url string) (string, error) {
+	u, err := nurl.Parse(url)
+	if (err != nil) || (u.Host == "") {
+		// a bare host:port parses as a scheme and opaque path
+		if u, err = nurl.Parse("ws://" + url); err != nil {
+			return "", fmt.Errorf("invalid remote Chrome URL %q: %w", url, err)
+		}
+	}
+	switch u.Scheme {
+	case "ws", "wss", "http", "https":
+	default:
+		return "", fmt.Errorf("invalid remote Chrome URL %q: unsupported scheme %q", url, u.Scheme)
+	}
+	if u.Port() == "" {
+		return "", fmt.Errorf("invalid remote Chrome URL %q: missing port", url)
+	}
+	return (&nurl.URL{Scheme: "ws", Host: u.Host}).String(), nil
+}
+
+// The fields of interest from the /json/version endpoint
+type remoteVersion struct {
+	Browser              string `json:"Browser"`
+	ProtocolVersion      string `json:"Protocol-Version"`
+	WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+}
+
+// Fetch the remote Chrome's version info. Chrome only answers DevTools HTTP
+// requests addressed to an IP address or localhost, so host names are resolved
+// first.
+func discoverRemote(ctx context.Context, remoteURL string) (*remoteVersion, error) {
+	u, err := nurl.Parse(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	host, port := u.Hostname(), u.Port()
+	if (net.ParseIP(host) == nil) && (host != "localhost") {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		host = addrs[0]
+	}
+	versionURL := (&nurl.URL{Scheme: "http", Host: net.JoinHostPort(host, port), Path: "/json/version"}).String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, versionURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", versionURL, resp.Status)
+	}
+	var version remoteVersion
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return nil, fmt.Errorf("%s: %w", versionURL, err)
+	}
+	if version.WebSocketDebuggerURL == "" {
+		return nil, fmt.Errorf("%s: no webSocketDebuggerUrl", versionURL)
+	}
+	return &version, nil
+}
+
+// Per-tab equivalents of the launch options that a remote Chrome doesn't get.
+func (b *Chrome) remoteTabActions() chromedp.Action {
+	if b.config.remoteURL == "" {
+		return chromedp.Tasks{}
+	}
+	width, height := b.config.windowSize[0], b.config.windowSize[1]
+	return emulation.SetDeviceMetricsOverride(int64(width), int64(height), 1, false)
+}
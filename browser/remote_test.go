@@ -0,0 +1,89 @@
+package browser
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeRemoteURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+		err      bool
+	}{
+		{"ws://127.0.0.1:9222/devtools/browser/0a1b2c", "ws://127.0.0.1:9222", false},
+		{"http://localhost:9222", "ws://localhost:9222", false},
+		{"https://chrome.internal:9222/", "ws://chrome.internal:9222", false},
+		{"chrome:9222", "ws://chrome:9222", false},
+		{"127.0.0.1:9222", "ws://127.0.0.1:9222", false},
+		{"http://localhost", "", true},
+		{"ftp://localhost:9222", "", true},
+		{"", "", true},
+	}
+	for _, test := range tests {
+		got, err := normalizeRemoteURL(test.url)
+		if test.err {
+			if err == nil {
+				t.Errorf("[%s] expected error, got %s", test.url, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] unexpected error %v", test.url, err)
+		} else if got != test.expected {
+			t.Errorf("[%s] expected %s, got %s", test.url, test.expected, got)
+		}
+	}
+}
+
+func TestDiscoverRemote(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/json/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{
+			"Browser": "Chrome/124.0.6367.91",
+			"Protocol-Version": "1.3",
+			"webSocketDebuggerUrl": "ws://` + r.Host + `/devtools/browser/0a1b2c"
+		}`))
+	}))
+	defer server.Close()
+	remoteURL, err := normalizeRemoteURL(server.URL)
+	if err != nil {
+		t.Fatalf("normalizeRemoteURL failed: %v", err)
+	}
+	version, err := discoverRemote(context.Background(), remoteURL)
+	if err != nil {
+		t.Fatalf("discoverRemote failed: %v", err)
+	}
+	if version.Browser != "Chrome/124.0.6367.91" {
+		t.Errorf("unexpected browser %q", version.Browser)
+	}
+	if !strings.HasSuffix(version.WebSocketDebuggerURL, "/devtools/browser/0a1b2c") {
+		t.Errorf("unexpected websocket URL %q", version.WebSocketDebuggerURL)
+	}
+
+	server.Close()
+	if _, err := discoverRemote(context.Background(), remoteURL); err == nil {
+		t.Error("expected an error when the remote is down")
+	}
+}
+
+func TestRemoteAllocatorOption(t *testing.T) {
+	if _, err := NewChrome(context.Background(), RemoteAllocator("ftp://localhost:9222")); err == nil {
+		t.Error("expected an error for an invalid remote URL")
+	}
+	// nothing is listening here; NewChrome should still succeed
+	c, err := NewChrome(context.Background(), RemoteAllocator("127.0.0.1:1"), MaxTabs(1))
+	if err != nil {
+		t.Fatalf("NewChrome failed: %v", err)
+	}
+	defer c.Cancel()
+	if c.config.remoteURL != "ws://127.0.0.1:1" {
+		t.Errorf("unexpected remote URL %q", c.config.remoteURL)
+	}
+}
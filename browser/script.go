@@ -0,0 +1,38 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"github.com/efixler/headless/request"
+)
+
+// Evaluate the scripts in order, collecting their results. A script that throws
+// doesn't stop the others or fail the request; its error is recorded instead.
+func evaluateScripts(scripts []string, results *[]request.ScriptResult) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		for _, script := range scripts {
+			var value []byte
+			var result request.ScriptResult
+			err := chromedp.Evaluate(script, &value, awaitPromise).Do(ctx)
+			switch {
+			case ctx.Err() != nil:
+				return ctx.Err()
+			case err != nil:
+				result.Error = err.Error()
+			case value == nil:
+				result.Value = json.RawMessage("null")
+			default:
+				result.Value = value
+			}
+			*results = append(*results, result)
+		}
+		return nil
+	})
+}
+
+func awaitPromise(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+	return p.WithAwaitPromise(true)
+}
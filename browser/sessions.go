@@ -0,0 +1,254 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/efixler/headless/request"
+)
+
+const (
+	DefaultSessionTTL  = 10 * time.Minute
+	DefaultMaxSessions = 100
+	// How often to look for idle sessions, at most
+	maxSessionExpireInterval = time.Minute
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionInUse    = errors.New("session has tabs open")
+	// ErrMaxSessions is returned when a new session would be over the limit
+	ErrMaxSessions = errors.New("maximum number of sessions reached")
+)
+
+type sessionOwnerKey struct{}
+
+// Returns a context for requests whose named sessions belong to owner, like
+// the caller that was authenticated, so that different owners' sessions
+// with the same name are kept apart.
+func WithSessionOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, sessionOwnerKey{}, owner)
+}
+
+// The owner of the context's named sessions, or "" if it has none.
+func SessionOwner(ctx context.Context) string {
+	owner, _ := ctx.Value(sessionOwnerKey{}).(string)
+	return owner
+}
+
+// SessionInfo describes a named session.
+type SessionInfo struct {
+	Name     string    `json:"name"`
+	Created  time.Time `json:"created_at"`
+	LastUsed time.Time `json:"last_used_at"`
+	// Tabs open in the session now
+	Tabs int `json:"tabs"`
+}
+
+// A named session is a browser context that's kept between requests, so
+// they share cookies and storage with each other and nobody else.
+type session struct {
+	SessionInfo
+	inst      *instance
+	contextID cdp.BrowserContextID
+	// the session's cookies as of its last page load, to restore if the
+	// browser is replaced
+	cookies []request.Cookie
+	// closed once a context being created for the session is ready, or nil
+	opening chan struct{}
+}
+
+// Sessions are named by their owners; different owners' sessions with the
+// same name are different sessions.
+type sessionKey struct {
+	owner string
+	name  string
+}
+
+type sessions struct {
+	ttl time.Duration
+	// zero means no limit
+	max   int
+	mu    sync.Mutex
+	byKey map[sessionKey]*session
+}
+
+func newSessions(ttl time.Duration, max int) *sessions {
+	return &sessions{ttl: ttl, max: max, byKey: make(map[sessionKey]*session)}
+}
+
+// Returns the browser context for the session in inst, creating the session,
+// or a new context for it if the browser has been replaced, and counts a tab
+// against it. Cookies returned should be set in the tab; they carry the
+// session over from the replaced browser. Call release when the tab is done.
+// Returns ErrMaxSessions if there's no room for a new session.
+func (s *sessions) acquire(inst *instance, key sessionKey) (cdp.BrowserContextID, []request.Cookie, error) {
+	s.mu.Lock()
+	for {
+		sess, ok := s.byKey[key]
+		if !ok {
+			if (s.max > 0) && (len(s.byKey) >= s.max) {
+				s.mu.Unlock()
+				return "", nil, ErrMaxSessions
+			}
+			sess = &session{SessionInfo: SessionInfo{Name: key.name, Created: time.Now()}}
+			s.byKey[key] = sess
+		}
+		switch {
+		case sess.inst == inst:
+			sess.Tabs++
+			sess.LastUsed = time.Now()
+			s.mu.Unlock()
+			return sess.contextID, nil, nil
+		case sess.opening != nil:
+			// wait for the other tab's context, then look again
+			opening := sess.opening
+			s.mu.Unlock()
+			<-opening
+			s.mu.Lock()
+			continue
+		}
+		return s.open(inst, key, sess)
+	}
+}
+
+// Create a context for the session in inst, without holding the lock, which
+// is held when this is called and released when it returns. The tab is
+// counted while the context is created so the session isn't closed meanwhile.
+func (s *sessions) open(inst *instance, key sessionKey, sess *session) (cdp.BrowserContextID, []request.Cookie, error) {
+	defer s.mu.Unlock()
+	sess.opening = make(chan struct{})
+	sess.Tabs++
+	s.mu.Unlock()
+	var id cdp.BrowserContextID
+	err := errors.New("browser can't create sessions")
+	if inst.newContext != nil {
+		if id, err = inst.newContext(inst.ctx); err != nil {
+			err = errors.Join(ErrBrowserUnavailable, err)
+		}
+	}
+	s.mu.Lock()
+	close(sess.opening)
+	sess.opening = nil
+	if err != nil {
+		sess.Tabs--
+		if (sess.inst == nil) && (sess.Tabs == 0) {
+			// never opened
+			delete(s.byKey, key)
+		}
+		return "", nil, err
+	}
+	sess.inst = inst
+	sess.contextID = id
+	sess.LastUsed = time.Now()
+	return id, sess.cookies, nil
+}
+
+// Release a tab acquired for the session, keeping the cookies it ended up
+// with unless they're nil.
+func (s *sessions) release(key sessionKey, cookies []request.Cookie) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.byKey[key]
+	if !ok {
+		return
+	}
+	sess.Tabs--
+	sess.LastUsed = time.Now()
+	if cookies != nil {
+		sess.cookies = cookies
+	}
+}
+
+// The owner's sessions, ordered by name.
+func (s *sessions) list(owner string) []SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]SessionInfo, 0)
+	for key, sess := range s.byKey {
+		if key.owner == owner {
+			infos = append(infos, sess.SessionInfo)
+		}
+	}
+	slices.SortFunc(infos, func(a, b SessionInfo) int { return strings.Compare(a.Name, b.Name) })
+	return infos
+}
+
+// Close the session, discarding its cookies and storage.
+func (s *sessions) close(key sessionKey) error {
+	s.mu.Lock()
+	sess, ok := s.byKey[key]
+	switch {
+	case !ok:
+		s.mu.Unlock()
+		return ErrSessionNotFound
+	case sess.Tabs > 0:
+		s.mu.Unlock()
+		return ErrSessionInUse
+	}
+	delete(s.byKey, key)
+	s.mu.Unlock()
+	sess.dispose()
+	return nil
+}
+
+// Close sessions that have been idle for longer than the TTL as of now.
+func (s *sessions) expire(now time.Time) {
+	var expired []*session
+	s.mu.Lock()
+	for key, sess := range s.byKey {
+		if (sess.Tabs == 0) && (now.Sub(sess.LastUsed) > s.ttl) {
+			delete(s.byKey, key)
+			expired = append(expired, sess)
+		}
+	}
+	s.mu.Unlock()
+	for _, sess := range expired {
+		slog.Debug("Closing idle session", "name", sess.Name)
+		sess.dispose()
+	}
+}
+
+func (s *sessions) expireEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.expire(now)
+		}
+	}
+}
+
+// Dispose of the session's browser context, unless its browser is gone.
+func (sess *session) dispose() {
+	inst := sess.inst
+	if (inst == nil) || (inst.disposeContext == nil) || (inst.ctx.Err() != nil) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(inst.ctx, closeTimeout)
+	defer cancel()
+	if err := inst.disposeContext(ctx, sess.contextID); err != nil {
+		slog.Debug("Error closing session", "name", sess.Name, "err", err)
+	}
+}
+
+// The named sessions belonging to the context's SessionOwner.
+func (b *Chrome) Sessions(ctx context.Context) []SessionInfo {
+	return b.sessions.list(SessionOwner(ctx))
+}
+
+// Close the named session belonging to the context's SessionOwner, discarding
+// its cookies and storage. Returns ErrSessionNotFound if there's no such
+// session, or ErrSessionInUse if it has tabs open.
+func (b *Chrome) CloseSession(ctx context.Context, name string) error {
+	return b.sessions.close(sessionKey{owner: SessionOwner(ctx), name: name})
+}
@@ -0,0 +1,221 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/efixler/headless/request"
+)
+
+// fakeContexts stands in for a browser's context management.
+type fakeContexts struct {
+	mu       sync.Mutex
+	created  int
+	disposed []cdp.BrowserContextID
+}
+
+func (f *fakeContexts) instance() *instance {
+	inst := newInstance(context.Background(), func() {})
+	inst.newContext = func(ctx context.Context) (cdp.BrowserContextID, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.created++
+		return cdp.BrowserContextID(fmt.Sprintf("context-%d", f.created)), nil
+	}
+	inst.disposeContext = func(ctx context.Context, id cdp.BrowserContextID) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.disposed = append(f.disposed, id)
+		return nil
+	}
+	return inst
+}
+
+func TestSessionsShareContext(t *testing.T) {
+	f := &fakeContexts{}
+	inst := f.instance()
+	s := newSessions(time.Minute, 0)
+	first, _, err := s.acquire(inst, sessionKey{name: "alice"})
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	second, _, _ := s.acquire(inst, sessionKey{name: "alice"})
+	other, _, _ := s.acquire(inst, sessionKey{name: "bob"})
+	if first != second {
+		t.Errorf("expected requests in a session to share its context, got %s and %s", first, second)
+	}
+	if first == other {
+		t.Error("expected sessions to have their own contexts")
+	}
+	infos := s.list("")
+	if len(infos) != 2 || infos[0].Name != "alice" || infos[0].Tabs != 2 || infos[1].Name != "bob" {
+		t.Errorf("unexpected sessions %+v", infos)
+	}
+}
+
+func TestSessionsRestoreCookiesAfterRestart(t *testing.T) {
+	f := &fakeContexts{}
+	s := newSessions(time.Minute, 0)
+	old := f.instance()
+	s.acquire(old, sessionKey{name: "alice"})
+	cookies := []request.Cookie{{Name: "session", Value: "abc", Domain: ".foo.com"}}
+	s.release(sessionKey{name: "alice"}, cookies)
+
+	id, restore, err := s.acquire(old, sessionKey{name: "alice"})
+	if err != nil || len(restore) != 0 {
+		t.Errorf("expected no cookies to restore in the same browser, got %v (%v)", restore, err)
+	}
+	s.release(sessionKey{name: "alice"}, nil)
+
+	replacement := f.instance()
+	newID, restore, err := s.acquire(replacement, sessionKey{name: "alice"})
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	if newID == id {
+		t.Error("expected a new context in the replacement browser")
+	}
+	if len(restore) != 1 || restore[0] != cookies[0] {
+		t.Errorf("expected cookies %v to be restored, got %v", cookies, restore)
+	}
+}
+
+func TestSessionsClose(t *testing.T) {
+	f := &fakeContexts{}
+	inst := f.instance()
+	s := newSessions(time.Minute, 0)
+	id, _, _ := s.acquire(inst, sessionKey{name: "alice"})
+	if err := s.close(sessionKey{name: "alice"}); !errors.Is(err, ErrSessionInUse) {
+		t.Errorf("expected ErrSessionInUse, got %v", err)
+	}
+	s.release(sessionKey{name: "alice"}, nil)
+	if err := s.close(sessionKey{name: "alice"}); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if len(f.disposed) != 1 || f.disposed[0] != id {
+		t.Errorf("expected context %s to be disposed, got %v", id, f.disposed)
+	}
+	if err := s.close(sessionKey{name: "alice"}); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestSessionsExpire(t *testing.T) {
+	f := &fakeContexts{}
+	inst := f.instance()
+	s := newSessions(time.Minute, 0)
+	s.acquire(inst, sessionKey{name: "idle"})
+	s.release(sessionKey{name: "idle"}, nil)
+	s.acquire(inst, sessionKey{name: "busy"})
+
+	s.expire(time.Now().Add(30 * time.Second))
+	if len(s.list("")) != 2 {
+		t.Fatalf("expected sessions to be kept within the TTL, got %+v", s.list(""))
+	}
+	s.expire(time.Now().Add(2 * time.Minute))
+	infos := s.list("")
+	if len(infos) != 1 || infos[0].Name != "busy" {
+		t.Errorf("expected only the busy session to be kept, got %+v", infos)
+	}
+	if len(f.disposed) != 1 {
+		t.Errorf("expected the idle session's context to be disposed, got %v", f.disposed)
+	}
+}
+
+func TestSessionsBrowserGone(t *testing.T) {
+	s := newSessions(time.Minute, 0)
+	inst := newInstance(context.Background(), func() {})
+	if _, _, err := s.acquire(inst, sessionKey{name: "alice"}); err == nil {
+		t.Error("expected an error from a browser that can't create contexts")
+	}
+	if len(s.list("")) != 0 {
+		t.Errorf("expected no sessions, got %+v", s.list(""))
+	}
+}
+
+func TestSessionsOwners(t *testing.T) {
+	f := &fakeContexts{}
+	inst := f.instance()
+	s := newSessions(time.Minute, 0)
+	alice, _, _ := s.acquire(inst, sessionKey{owner: "alice", name: "shop"})
+	bob, _, _ := s.acquire(inst, sessionKey{owner: "bob", name: "shop"})
+	if alice == bob {
+		t.Error("expected owners' sessions with the same name to have their own contexts")
+	}
+	if infos := s.list("alice"); len(infos) != 1 || infos[0].Name != "shop" {
+		t.Errorf("expected alice to see her own session, got %+v", infos)
+	}
+	if infos := s.list(""); len(infos) != 0 {
+		t.Errorf("expected no sessions without an owner, got %+v", infos)
+	}
+	s.release(sessionKey{owner: "bob", name: "shop"}, nil)
+	if err := s.close(sessionKey{owner: "carol", name: "shop"}); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound for another owner's session, got %v", err)
+	}
+	if err := s.close(sessionKey{owner: "bob", name: "shop"}); err != nil {
+		t.Errorf("close failed: %v", err)
+	}
+}
+
+func TestSessionsMax(t *testing.T) {
+	f := &fakeContexts{}
+	inst := f.instance()
+	s := newSessions(time.Minute, 2)
+	s.acquire(inst, sessionKey{name: "alice"})
+	s.acquire(inst, sessionKey{name: "bob"})
+	if _, _, err := s.acquire(inst, sessionKey{name: "carol"}); !errors.Is(err, ErrMaxSessions) {
+		t.Errorf("expected ErrMaxSessions, got %v", err)
+	}
+	if _, _, err := s.acquire(inst, sessionKey{name: "alice"}); err != nil {
+		t.Errorf("expected an open session to be usable at the limit, got %v", err)
+	}
+	s.release(sessionKey{name: "bob"}, nil)
+	s.close(sessionKey{name: "bob"})
+	if _, _, err := s.acquire(inst, sessionKey{name: "carol"}); err != nil {
+		t.Errorf("expected room for a session after one closed, got %v", err)
+	}
+}
+
+func TestSessionsOpenWithoutLock(t *testing.T) {
+	f := &fakeContexts{}
+	inst := f.instance()
+	newContext := inst.newContext
+	started, unblock := make(chan struct{}, 2), make(chan struct{})
+	inst.newContext = func(ctx context.Context) (cdp.BrowserContextID, error) {
+		started <- struct{}{}
+		<-unblock
+		return newContext(ctx)
+	}
+	s := newSessions(time.Minute, 0)
+	ids := make(chan cdp.BrowserContextID, 2)
+	for range 2 {
+		go func() {
+			id, _, err := s.acquire(inst, sessionKey{name: "alice"})
+			if err != nil {
+				t.Errorf("acquire failed: %v", err)
+			}
+			ids <- id
+		}()
+	}
+	// the lock isn't held while the context is created
+	<-started
+	other := f.instance()
+	if _, _, err := s.acquire(other, sessionKey{name: "bob"}); err != nil {
+		t.Errorf("acquire failed: %v", err)
+	}
+	close(unblock)
+	if first, second := <-ids, <-ids; first != second {
+		t.Errorf("expected the waiting tab to share the new context, got %s and %s", first, second)
+	}
+	if infos := s.list(""); len(infos) != 2 || infos[0].Tabs != 2 {
+		t.Errorf("unexpected sessions %+v", infos)
+	}
+	if f.created != 2 {
+		t.Errorf("expected 2 contexts, got %d", f.created)
+	}
+}
@@ -0,0 +1,324 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	DefaultHealthCheckInterval = 10 * time.Second
+	heartbeatTimeout           = 5 * time.Second
+	// How long a retired browser waits for its tabs to finish before it's closed anyway
+	drainTimeout = 2 * time.Minute
+	closeTimeout = 5 * time.Second
+	// How long launching a browser (or connecting to a remote one) can take
+	launchTimeout = 30 * time.Second
+)
+
+var (
+	ErrBrowserUnavailable = errors.New("browser unavailable")
+)
+
+// instance is a running browser (or a connection to a remote one) that tabs
+// are opened in. It's replaced when it dies, stops responding, or is due to
+// be recycled; a replaced instance is closed once its tabs are done.
+type instance struct {
+	ctx    context.Context
+	close  func()
+	ping   func(ctx context.Context) error
+	memory func() (int64, error)
+	// create and dispose of browser contexts for named sessions
+	newContext     func(ctx context.Context) (cdp.BrowserContextID, error)
+	disposeContext func(ctx context.Context, id cdp.BrowserContextID) error
+	inflight       int
+	pageLoads      int
+	retired        bool
+	closed         sync.Once
+	drained        chan struct{}
+}
+
+func newInstance(ctx context.Context, close func()) *instance {
+	return &instance{ctx: ctx, close: close, drained: make(chan struct{})}
+}
+
+// supervisor owns the current browser instance for a Chrome.
+type supervisor struct {
+	// Launches are abandoned when ctx is done
+	launch        func(ctx context.Context) (*instance, error)
+	launchTimeout time.Duration
+	recycleAfter  int
+	maxMemory     int64
+	mu            sync.Mutex
+	current       *instance
+	// the launch in progress, if any
+	launching *launch
+	restarts  int
+}
+
+// launch is a browser launch that callers of acquire wait for; err is set
+// before done is closed.
+type launch struct {
+	done chan struct{}
+	err  error
+}
+
+// Launch a browser (or connect to the remote one) and open its first tab,
+// which keeps the browser open until the instance is closed. Gives up when
+// ctx is done.
+func (b *Chrome) launchInstance(ctx context.Context) (*instance, error) {
+	var allocCtx context.Context
+	var allocCancel context.CancelFunc
+	if b.config.remoteURL == "" {
+		allocCtx, allocCancel = chromedp.NewExecAllocator(b.ctx, b.config.allocatorOptions...)
+	} else {
+		allocCtx, allocCancel = chromedp.NewRemoteAllocator(b.ctx, b.config.remoteURL)
+	}
+	browserCtx, browserCancel := chromedp.NewContext(allocCtx)
+	inst := newInstance(browserCtx, func() {
+		// close gracefully if we can, then make sure everything is torn down
+		ctx, cancel := context.WithTimeout(browserCtx, closeTimeout)
+		defer cancel()
+		if err := chromedp.Cancel(ctx); err != nil {
+			slog.Debug("Error closing browser", "err", err)
+		}
+		browserCancel()
+		allocCancel()
+	})
+	// The browser lives as long as the context of the first Run, so ctx can't
+	// be passed to it; cancel the browser instead if ctx is done first.
+	stop := context.AfterFunc(ctx, browserCancel)
+	err := chromedp.Run(browserCtx)
+	if !stop() {
+		err = errors.Join(err, ctx.Err())
+	}
+	if err != nil {
+		browserCancel()
+		allocCancel()
+		return nil, errors.Join(ErrBrowserUnavailable, err)
+	}
+	c := chromedp.FromContext(browserCtx)
+	inst.ping = func(ctx context.Context) error {
+		_, _, _, _, _, err := browser.GetVersion().Do(cdp.WithExecutor(ctx, c.Browser))
+		return err
+	}
+	inst.newContext = func(ctx context.Context) (cdp.BrowserContextID, error) {
+		return target.CreateBrowserContext().Do(cdp.WithExecutor(ctx, c.Browser))
+	}
+	inst.disposeContext = func(ctx context.Context, id cdp.BrowserContextID) error {
+		return target.DisposeBrowserContext(id).Do(cdp.WithExecutor(ctx, c.Browser))
+	}
+	if process := c.Browser.Process(); process != nil {
+		pid := process.Pid
+		inst.memory = func() (int64, error) { return processTreeRSS(pid) }
+	}
+	return inst, nil
+}
+
+// Returns the current instance, launching one if needed, and counts a tab
+// against it. Call release when the tab is done. Page loads count towards
+// recycling the instance; other tabs, like readiness checks, don't.
+//
+// Callers that arrive while a browser is launching wait for that launch, or
+// until ctx is done. An abandoned launch carries on for the other callers.
+func (s *supervisor) acquire(ctx context.Context, pageLoad bool) (*instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.current == nil {
+		l := s.launching
+		if l == nil {
+			l = &launch{done: make(chan struct{})}
+			s.launching = l
+			go s.runLaunch(l)
+		}
+		s.mu.Unlock()
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			s.mu.Lock()
+			return nil, errors.Join(ErrBrowserUnavailable, ctx.Err())
+		}
+		s.mu.Lock()
+		if l.err != nil {
+			return nil, l.err
+		}
+	}
+	inst := s.current
+	inst.inflight++
+	if !pageLoad {
+		return inst, nil
+	}
+	inst.pageLoads++
+	if (s.recycleAfter > 0) && (inst.pageLoads >= s.recycleAfter) {
+		s.retireLocked(inst, "page load limit reached")
+	}
+	return inst, nil
+}
+
+// Launch a browser without holding the lock, then make it the current one.
+func (s *supervisor) runLaunch(l *launch) {
+	timeout := s.launchTimeout
+	if timeout <= 0 {
+		timeout = launchTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	inst, err := s.launch(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.launching = nil
+	l.err = err
+	if err == nil {
+		s.current = inst
+		// a browser that exits on its own is replaced on the next acquire
+		context.AfterFunc(inst.ctx, func() { s.retire(inst, "browser exited") })
+	}
+	close(l.done)
+}
+
+func (s *supervisor) release(inst *instance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst.inflight--
+	if inst.retired && (inst.inflight == 0) {
+		close(inst.drained)
+	}
+}
+
+// Stop opening tabs in the instance, and close it once its tabs are done.
+func (s *supervisor) retire(inst *instance, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retireLocked(inst, reason)
+}
+
+func (s *supervisor) retireLocked(inst *instance, reason string) {
+	if inst.retired {
+		return
+	}
+	inst.retired = true
+	if s.current == inst {
+		s.current = nil
+		s.restarts++
+	}
+	slog.Info("Retiring browser", "reason", reason, "inflight", inst.inflight, "pageLoads", inst.pageLoads)
+	if inst.inflight == 0 {
+		close(inst.drained)
+	}
+	go func() {
+		select {
+		case <-inst.drained:
+		case <-inst.ctx.Done():
+		case <-time.After(drainTimeout):
+			slog.Warn("Closing browser with tabs still open", "reason", reason)
+		}
+		inst.closed.Do(inst.close)
+	}()
+}
+
+// Check the current instance, retiring it if it's unresponsive or using
+// too much memory.
+func (s *supervisor) check(ctx context.Context) {
+	s.mu.Lock()
+	inst := s.current
+	s.mu.Unlock()
+	if inst == nil {
+		return
+	}
+	if inst.ping != nil {
+		pingCtx, cancel := context.WithTimeout(ctx, heartbeatTimeout)
+		err := inst.ping(pingCtx)
+		cancel()
+		if (err != nil) && (ctx.Err() == nil) {
+			slog.Error("Browser not responding", "err", err)
+			s.retire(inst, "browser not responding")
+			// its tabs aren't going to finish; don't wait for them
+			inst.closed.Do(inst.close)
+			return
+		}
+	}
+	if (s.maxMemory > 0) && (inst.memory != nil) {
+		rss, err := inst.memory()
+		switch {
+		case err != nil:
+			slog.Debug("Can't check browser memory", "err", err)
+		case rss > s.maxMemory:
+			slog.Warn("Browser memory over limit", "rss", rss, "max", s.maxMemory)
+			s.retire(inst, "memory limit reached")
+		}
+	}
+}
+
+// Check the browser every interval until ctx is done, then close it.
+func (s *supervisor) monitor(ctx context.Context, interval time.Duration) {
+	defer s.shutdown()
+	if interval <= 0 {
+		<-ctx.Done()
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.check(ctx)
+		}
+	}
+}
+
+func (s *supervisor) shutdown() {
+	s.mu.Lock()
+	inst := s.current
+	s.current = nil
+	if inst != nil {
+		inst.retired = true
+	}
+	s.mu.Unlock()
+	if inst != nil {
+		inst.closed.Do(inst.close)
+	}
+}
+
+// Number of times the browser has been replaced.
+func (s *supervisor) restartCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+// Reports an error unless the browser can take a request now: a tab slot is
+// free, and a blank tab can be opened before ctx is done. The slot is only
+// held while checking, and is counted in the Stats while it is.
+func (b *Chrome) Ready(ctx context.Context) error {
+	if b.sem != nil {
+		if !b.sem.TryAcquire(1) {
+			return ErrMaxTabs
+		}
+		defer b.holdTab()()
+	}
+	inst, err := b.supervisor.acquire(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer b.supervisor.release(inst)
+	tabCtx, cancel := chromedp.NewContext(inst.ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	if err := chromedp.Run(tabCtx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
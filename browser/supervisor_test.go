@@ -0,0 +1,300 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeBrowser struct {
+	launched atomic.Int32
+	closed   atomic.Int32
+	pingErr  atomic.Value
+	rss      atomic.Int64
+}
+
+func (f *fakeBrowser) launch(context.Context) (*instance, error) {
+	f.launched.Add(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	inst := newInstance(ctx, func() {
+		f.closed.Add(1)
+		cancel()
+	})
+	inst.ping = func(ctx context.Context) error {
+		if err, ok := f.pingErr.Load().(error); ok {
+			return err
+		}
+		return nil
+	}
+	inst.memory = func() (int64, error) { return f.rss.Load(), nil }
+	return inst, nil
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSupervisorReusesInstance(t *testing.T) {
+	f := &fakeBrowser{}
+	s := &supervisor{launch: f.launch}
+	first, err := s.acquire(context.Background(), true)
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	second, _ := s.acquire(context.Background(), true)
+	if first != second {
+		t.Error("expected tabs to share the browser")
+	}
+	s.release(first)
+	s.release(second)
+	if f.launched.Load() != 1 {
+		t.Errorf("expected 1 launch, got %d", f.launched.Load())
+	}
+}
+
+func TestSupervisorRecyclesAfterPageLoads(t *testing.T) {
+	f := &fakeBrowser{}
+	s := &supervisor{launch: f.launch, recycleAfter: 2}
+	first, _ := s.acquire(context.Background(), true)
+	second, _ := s.acquire(context.Background(), true)
+	third, _ := s.acquire(context.Background(), true)
+	if first != second {
+		t.Error("expected the first two tabs to share the browser")
+	}
+	if third == second {
+		t.Error("expected a new browser after the page load limit")
+	}
+	s.release(first)
+	if f.closed.Load() != 0 {
+		t.Error("retired browser closed before its tabs were done")
+	}
+	s.release(second)
+	waitFor(t, "retired browser to close", func() bool { return f.closed.Load() == 1 })
+	s.release(third)
+	if s.restartCount() != 1 {
+		t.Errorf("expected 1 restart, got %d", s.restartCount())
+	}
+}
+
+func TestSupervisorReplacesExitedBrowser(t *testing.T) {
+	f := &fakeBrowser{}
+	s := &supervisor{launch: f.launch}
+	first, _ := s.acquire(context.Background(), true)
+	s.release(first)
+	first.close()
+	waitFor(t, "exited browser to be retired", func() bool { return s.restartCount() == 1 })
+	second, _ := s.acquire(context.Background(), true)
+	defer s.release(second)
+	if second == first {
+		t.Error("expected a new browser after the old one exited")
+	}
+}
+
+func TestSupervisorReplacesUnresponsiveBrowser(t *testing.T) {
+	f := &fakeBrowser{}
+	s := &supervisor{launch: f.launch}
+	first, _ := s.acquire(context.Background(), true)
+	s.check(context.Background())
+	if f.closed.Load() != 0 {
+		t.Fatal("healthy browser was closed")
+	}
+	f.pingErr.Store(errors.New("no response"))
+	s.check(context.Background())
+	// closed right away, even with a tab open
+	if f.closed.Load() != 1 {
+		t.Errorf("expected unresponsive browser to be closed")
+	}
+	s.release(first)
+	second, _ := s.acquire(context.Background(), true)
+	defer s.release(second)
+	if second == first {
+		t.Error("expected a new browser")
+	}
+}
+
+func TestSupervisorRecyclesOverMemory(t *testing.T) {
+	f := &fakeBrowser{}
+	s := &supervisor{launch: f.launch, maxMemory: 1000}
+	first, _ := s.acquire(context.Background(), true)
+	f.rss.Store(500)
+	s.check(context.Background())
+	if s.restartCount() != 0 {
+		t.Fatal("browser under the memory limit was retired")
+	}
+	f.rss.Store(2000)
+	s.check(context.Background())
+	if s.restartCount() != 1 {
+		t.Fatal("expected browser over the memory limit to be retired")
+	}
+	if f.closed.Load() != 0 {
+		t.Error("retired browser closed before its tabs were done")
+	}
+	s.release(first)
+	waitFor(t, "retired browser to close", func() bool { return f.closed.Load() == 1 })
+}
+
+func TestSupervisorProbesDontCountAsPageLoads(t *testing.T) {
+	f := &fakeBrowser{}
+	s := &supervisor{launch: f.launch, recycleAfter: 1}
+	probe, _ := s.acquire(context.Background(), false)
+	s.release(probe)
+	page, _ := s.acquire(context.Background(), true)
+	s.release(page)
+	if probe != page {
+		t.Error("expected the probe not to count towards recycling")
+	}
+	if s.restartCount() != 1 {
+		t.Errorf("expected the page load to recycle the browser, got %d restarts", s.restartCount())
+	}
+}
+
+func TestSupervisorLaunchError(t *testing.T) {
+	s := &supervisor{launch: func(context.Context) (*instance, error) { return nil, ErrBrowserUnavailable }}
+	if _, err := s.acquire(context.Background(), true); !errors.Is(err, ErrBrowserUnavailable) {
+		t.Errorf("expected ErrBrowserUnavailable, got %v", err)
+	}
+}
+
+func TestSupervisorSharesLaunch(t *testing.T) {
+	f := &fakeBrowser{}
+	unblock := make(chan struct{})
+	s := &supervisor{launch: func(ctx context.Context) (*instance, error) {
+		<-unblock
+		return f.launch(ctx)
+	}}
+	results := make(chan *instance, 3)
+	for range 3 {
+		go func() {
+			inst, err := s.acquire(context.Background(), true)
+			if err != nil {
+				t.Errorf("acquire failed: %v", err)
+			}
+			results <- inst
+		}()
+	}
+	// the lock isn't held while launching
+	s.check(context.Background())
+	if s.restartCount() != 0 {
+		t.Errorf("expected no restarts, got %d", s.restartCount())
+	}
+	close(unblock)
+	first := <-results
+	for range 2 {
+		if inst := <-results; inst != first {
+			t.Error("expected the waiting callers to share the launched browser")
+		}
+	}
+	if f.launched.Load() != 1 {
+		t.Errorf("expected 1 launch, got %d", f.launched.Load())
+	}
+}
+
+func TestSupervisorAcquireContext(t *testing.T) {
+	f := &fakeBrowser{}
+	unblock := make(chan struct{})
+	s := &supervisor{launch: func(ctx context.Context) (*instance, error) {
+		<-unblock
+		return f.launch(ctx)
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquire(ctx, true); !errors.Is(err, ErrBrowserUnavailable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected ErrBrowserUnavailable and DeadlineExceeded, got %v", err)
+	}
+	// the launch carries on for later callers
+	close(unblock)
+	inst, err := s.acquire(context.Background(), true)
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	s.release(inst)
+	if f.launched.Load() != 1 {
+		t.Errorf("expected 1 launch, got %d", f.launched.Load())
+	}
+}
+
+func TestSupervisorLaunchTimeout(t *testing.T) {
+	s := &supervisor{
+		launch: func(ctx context.Context) (*instance, error) {
+			<-ctx.Done()
+			return nil, errors.Join(ErrBrowserUnavailable, ctx.Err())
+		},
+		launchTimeout: 10 * time.Millisecond,
+	}
+	if _, err := s.acquire(context.Background(), true); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the launch to time out, got %v", err)
+	}
+}
+
+func TestSupervisorShutdown(t *testing.T) {
+	f := &fakeBrowser{}
+	s := &supervisor{launch: f.launch}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.monitor(ctx, time.Hour)
+		close(done)
+	}()
+	inst, _ := s.acquire(context.Background(), true)
+	s.release(inst)
+	cancel()
+	<-done
+	if f.closed.Load() != 1 {
+		t.Errorf("expected browser to be closed on shutdown")
+	}
+}
+
+func TestProcessTreeRSS(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only supported on linux")
+	}
+	rss, err := processTreeRSS(os.Getpid())
+	if err != nil {
+		t.Fatalf("processTreeRSS failed: %v", err)
+	}
+	if rss <= 0 {
+		t.Errorf("expected positive rss, got %d", rss)
+	}
+}
+
+func TestReadyWithoutFreeTabs(t *testing.T) {
+	c, err := NewChrome(context.Background(), MaxTabs(1))
+	if err != nil {
+		t.Fatalf("NewChrome failed: %v", err)
+	}
+	defer c.Cancel()
+	if _, err := c.AcquireTab(); err != nil {
+		t.Fatalf("AcquireTab failed: %v", err)
+	}
+	if err := c.Ready(context.Background()); !errors.Is(err, ErrMaxTabs) {
+		t.Errorf("expected ErrMaxTabs, got %v", err)
+	}
+}
+
+func TestReadyReleasesTab(t *testing.T) {
+	c, err := NewChrome(context.Background(), MaxTabs(1))
+	if err != nil {
+		t.Fatalf("NewChrome failed: %v", err)
+	}
+	defer c.Cancel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Ready(ctx)
+	if inUse := c.Stats().TabsInUse; inUse != 0 {
+		t.Errorf("expected no tabs in use after the check, got %d", inUse)
+	}
+	if _, err := c.AcquireTab(); err != nil {
+		t.Errorf("expected the checked tab slot to be free, got %v", err)
+	}
+}
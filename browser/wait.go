@@ -0,0 +1,178 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/efixler/headless/request"
+)
+
+const (
+	pollInterval = 50 * time.Millisecond
+)
+
+// pageWatcher tracks the lifecycle events and the in-flight network requests
+// for a tab, so that wait strategies can decide when a page is ready.
+type pageWatcher struct {
+	mu           sync.Mutex
+	loaderID     cdp.LoaderID
+	lifecycle    map[cdp.LoaderID]map[string]bool
+	inflight     map[network.RequestID]bool
+	lastActivity time.Time
+	warnings     []string
+}
+
+func newPageWatcher() *pageWatcher {
+	return &pageWatcher{
+		lifecycle:    make(map[cdp.LoaderID]map[string]bool),
+		inflight:     make(map[network.RequestID]bool),
+		lastActivity: time.Now(),
+	}
+}
+
+// Event listener; pass to chromedp.ListenTarget before navigating.
+func (w *pageWatcher) handleEvent(ev interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch ev := ev.(type) {
+	case *page.EventLifecycleEvent:
+		events, ok := w.lifecycle[ev.LoaderID]
+		if !ok {
+			events = make(map[string]bool)
+			w.lifecycle[ev.LoaderID] = events
+		}
+		events[ev.Name] = true
+	case *network.EventRequestWillBeSent:
+		w.inflight[ev.RequestID] = true
+		w.lastActivity = time.Now()
+	case *network.EventLoadingFinished:
+		delete(w.inflight, ev.RequestID)
+		w.lastActivity = time.Now()
+	case *network.EventLoadingFailed:
+		delete(w.inflight, ev.RequestID)
+		w.lastActivity = time.Now()
+	}
+}
+
+// Navigate to the url without waiting for the page to load, recording the
+// loader ID so that lifecycle events for this navigation can be identified.
+func (w *pageWatcher) navigate(url string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		_, loaderID, errorText, err := page.Navigate(url).Do(ctx)
+		if err != nil {
+			return err
+		}
+		if errorText != "" {
+			return fmt.Errorf("page load error %s", errorText)
+		}
+		w.mu.Lock()
+		w.loaderID = loaderID
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+// Reports whether the named lifecycle event (e.g. "DOMContentLoaded", "load")
+// has fired for the current navigation.
+func (w *pageWatcher) reached(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lifecycle[w.loaderID][name]
+}
+
+func (w *pageWatcher) idle(maxInflight int, idleTime time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.inflight) <= maxInflight && time.Since(w.lastActivity) >= idleTime
+}
+
+func (w *pageWatcher) wait(ctx context.Context, ready func() bool) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for !ready() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Action that blocks until the page is ready according to the wait strategy.
+// If the page isn't ready before the strategy's MaxWait, a warning is logged
+// and the action returns without error so the content can still be captured.
+func (w *pageWatcher) waitFor(ws request.WaitStrategy) chromedp.Action {
+	ws = ws.WithDefaults()
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		waitCtx, cancel := context.WithTimeout(ctx, ws.MaxWait.Duration())
+		defer cancel()
+		err := w.waitForStrategy(waitCtx, ws)
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, context.DeadlineExceeded), errors.Is(err, chromedp.ErrPollingTimeout):
+			slog.Warn("Page not ready before max wait, capturing anyway", "wait", ws.Type, "maxWait", ws.MaxWait.Duration())
+			w.warn(fmt.Sprintf("page not ready (wait %s) before max wait of %s, captured anyway", ws.Type, ws.MaxWait.Duration()))
+		default:
+			return err
+		}
+		if ws.Type == request.WaitDelay {
+			return sleep(ctx, ws.Delay.Duration())
+		}
+		return nil
+	})
+}
+
+func (w *pageWatcher) warn(warning string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.warnings = append(w.warnings, warning)
+}
+
+// Problems noticed while waiting that didn't fail the request.
+func (w *pageWatcher) warned() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.warnings...)
+}
+
+func (w *pageWatcher) waitForStrategy(ctx context.Context, ws request.WaitStrategy) error {
+	domContentLoaded := func() bool { return w.reached("DOMContentLoaded") }
+	switch ws.Type {
+	case request.WaitDOMContentLoaded:
+		return w.wait(ctx, domContentLoaded)
+	case request.WaitLoad, request.WaitDelay:
+		return w.wait(ctx, func() bool { return w.reached("load") })
+	case request.WaitNetworkIdle:
+		return w.wait(ctx, func() bool {
+			return domContentLoaded() && w.idle(ws.MaxInflight, ws.IdleTime.Duration())
+		})
+	case request.WaitSelector:
+		if ws.Visible {
+			return chromedp.WaitVisible(ws.Selector).Do(ctx)
+		}
+		return chromedp.WaitReady(ws.Selector).Do(ctx)
+	case request.WaitExpression:
+		if err := w.wait(ctx, domContentLoaded); err != nil {
+			return err
+		}
+		var result interface{}
+		return chromedp.Poll(
+			ws.Expression,
+			&result,
+			chromedp.WithPollingInterval(pollInterval*2),
+			chromedp.WithPollingTimeout(ws.MaxWait.Duration()),
+		).Do(ctx)
+	}
+	return fmt.Errorf("%w: %q", request.ErrInvalidWaitType, ws.Type)
+}
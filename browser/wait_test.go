@@ -0,0 +1,48 @@
+package browser
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+)
+
+func TestPageWatcherLifecycle(t *testing.T) {
+	w := newPageWatcher()
+	w.handleEvent(&page.EventLifecycleEvent{LoaderID: "old", Name: "load"})
+	w.handleEvent(&page.EventLifecycleEvent{LoaderID: "current", Name: "DOMContentLoaded"})
+	w.loaderID = "current"
+	if !w.reached("DOMContentLoaded") {
+		t.Error("expected DOMContentLoaded to be reached")
+	}
+	if w.reached("load") {
+		t.Error("load event from another navigation should be ignored")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*pollInterval)
+	defer cancel()
+	if err := w.wait(ctx, func() bool { return w.reached("load") }); err == nil {
+		t.Error("expected wait to time out")
+	}
+}
+
+func TestPageWatcherIdle(t *testing.T) {
+	w := newPageWatcher()
+	w.handleEvent(&network.EventRequestWillBeSent{RequestID: "1"})
+	w.handleEvent(&network.EventRequestWillBeSent{RequestID: "2"})
+	if w.idle(0, 0) {
+		t.Error("expected not idle with 2 requests in flight")
+	}
+	if !w.idle(2, 0) {
+		t.Error("expected idle when in-flight requests are within the limit")
+	}
+	w.handleEvent(&network.EventLoadingFinished{RequestID: "1"})
+	w.handleEvent(&network.EventLoadingFailed{RequestID: "2"})
+	if w.idle(0, time.Hour) {
+		t.Error("expected not idle before the idle time has passed")
+	}
+	if !w.idle(0, 0) {
+		t.Error("expected idle with no requests in flight")
+	}
+}
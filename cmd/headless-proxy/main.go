@@ -2,17 +2,21 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/efixler/envflags"
 	"github.com/efixler/headless/browser"
+	"github.com/efixler/headless/internal/metrics"
 	"github.com/efixler/headless/internal/proxy"
+	"github.com/efixler/headless/request"
 	"github.com/efixler/headless/ua"
 	"github.com/efixler/webutil/graceful"
 )
@@ -21,55 +25,281 @@ var (
 	flags         = flag.NewFlagSet("headless-proxy", flag.ExitOnError)
 	maxConcurrent *envflags.Value[int]
 	userAgent     *envflags.Value[*ua.Arg]
+	reqTimeout    *envflags.Value[time.Duration]
+	blockTypes    *envflags.Value[string]
+	blockURLs     *envflags.Value[string]
+	credsFile     *envflags.Value[string]
+	apiKeys       *envflags.Value[string]
+	apiKeysFile   *envflags.Value[string]
+	caCert        *envflags.Value[string]
+	caKey         *envflags.Value[string]
+	tlsCert       *envflags.Value[string]
+	tlsKey        *envflags.Value[string]
+	tlsSelfSigned *envflags.Value[bool]
+	allowSchemes  *envflags.Value[string]
+	allowHosts    *envflags.Value[string]
+	denyHosts     *envflags.Value[string]
+	allowPrivate  *envflags.Value[bool]
+	maxURLLength  *envflags.Value[int]
+	connectPorts  *envflags.Value[string]
+	remoteChrome  *envflags.Value[string]
+	healthCheck   *envflags.Value[time.Duration]
+	recycleAfter  *envflags.Value[int]
+	maxMemoryMB   *envflags.Value[int]
+	adminPort     *envflags.Value[int]
+	jobRetention  *envflags.Value[time.Duration]
+	maxJobs       *envflags.Value[int]
+	maxJobsMB     *envflags.Value[int]
+	callbackKey   *envflags.Value[string]
+	cookieJar     *envflags.Value[string]
+	sessionTTL    *envflags.Value[time.Duration]
+	maxSessions   *envflags.Value[int]
 	proxyFlag     = flags.Bool("proxy", false, "Run as a proxy server")
 	server        = &http.Server{}
+	adminServer   = &http.Server{}
 	logWriter     io.Writer
 )
 
+const (
+	certReloadInterval = 10 * time.Second
+)
+
 func main() {
 	slog.Info("Starting headless-proxy server", "addr", server.Addr)
 	ctx, cancel := context.WithCancel(context.Background())
 
-	c, err := browser.NewChrome(
-		ctx,
+	policy := urlPolicy()
+	registry := metrics.NewRegistry()
+	serviceMetrics := proxy.NewMetrics(registry)
+	options := []browser.ChromeOption{
 		browser.Headless(true),
 		browser.MaxTabs(maxConcurrent.Get()),
 		browser.UserAgentIfNotEmpty(userAgent.Get().String()),
-	)
+		browser.RequestTimeout(reqTimeout.Get()),
+		browser.Block(request.BlockOptions{
+			ResourceTypes: splitList(blockTypes.Get()),
+			URLPatterns:   splitList(blockURLs.Get()),
+		}),
+		browser.CheckURLs(policy.CheckBrowserRequest),
+		browser.HealthCheckInterval(healthCheck.Get()),
+		browser.RecycleAfter(recycleAfter.Get()),
+		browser.MaxMemory(int64(maxMemoryMB.Get()) << 20),
+		browser.ObserveNavigations(serviceMetrics.ObserveNavigation),
+		browser.SessionTTL(sessionTTL.Get()),
+		browser.MaxSessions(maxSessions.Get()),
+	}
+	if remoteChrome.Get() != "" {
+		// the remote browser's connections can't be checked, only its requests
+		slog.Warn("The URL policy is best-effort with -remote-chrome: websockets, workers and DNS changes aren't covered")
+		options = append(options, browser.RemoteAllocator(remoteChrome.Get()))
+	} else {
+		egressURL, err := proxy.StartEgressProxy(ctx, policy)
+		if err != nil {
+			slog.Error("can't start egress proxy", "err", err)
+			os.Exit(1)
+		}
+		options = append(options, browser.ProxyServer(egressURL))
+	}
+	if cookieJar.Get() != "" {
+		options = append(options, browser.CookieJar(cookieJar.Get()))
+	}
+	c, err := browser.NewChrome(ctx, options...)
 	if err != nil {
 		slog.Error("can't initialize headless browser", "err", err)
 		os.Exit(1)
 	}
+	auth, err := authenticator()
+	if err != nil {
+		slog.Error("can't load credentials", "err", err)
+		os.Exit(1)
+	}
 	if *proxyFlag {
-		if server.Handler, err = proxy.HTTPProxy(c); err != nil {
+		var ca *proxy.CertificateAuthority
+		if caCert.Get() != "" {
+			if ca, err = proxy.LoadCA(caCert.Get(), caKey.Get()); err != nil {
+				slog.Error("can't load CA certificate", "err", err)
+				os.Exit(1)
+			}
+		}
+		if server.Handler, err = proxy.HTTPProxy(
+			c,
+			proxy.WithAuthenticator(auth),
+			proxy.WithCA(ca),
+			proxy.WithURLPolicy(policy),
+			proxy.WithMetrics(serviceMetrics),
+		); err != nil {
 			slog.Error("can't initialize headless proxy", "err", err)
 			os.Exit(1)
 		}
 	} else {
-		if server.Handler, err = proxy.Service(c); err != nil {
+		jobs, err := proxy.NewJobQueue(ctx, c, proxy.JobOptions{
+			Capacity:         maxConcurrent.Get(),
+			Retention:        jobRetention.Get(),
+			MaxFinished:      maxJobs.Get(),
+			MaxFinishedBytes: int64(maxJobsMB.Get()) << 20,
+			SigningKey:       []byte(callbackKey.Get()),
+			CheckCallback:    policy.Check,
+			DialCallback:     policy.DialContext,
+		})
+		if err != nil {
+			slog.Error("can't initialize job queue", "err", err)
+			os.Exit(1)
+		}
+		if server.Handler, err = proxy.Service(
+			c,
+			proxy.WithAuthenticator(auth),
+			proxy.WithURLPolicy(policy),
+			proxy.WithMetrics(serviceMetrics),
+			proxy.WithJobs(jobs),
+		); err != nil {
 			slog.Error("can't initialize headless service", "err", err)
 			os.Exit(1)
 		}
 	}
 
+	if err := configureTLS(ctx); err != nil {
+		slog.Error("can't configure TLS", "err", err)
+		os.Exit(1)
+	}
+	registerBrowserMetrics(registry, c)
+	admin := http.NewServeMux()
+	switch {
+	case adminPort.Get() > 0:
+		// Metrics and health checks are left open for scrapers and probes on
+		// the admin port. It isn't proxied, so proxy credentials are taken in
+		// the Authorization header.
+		adminAuth := auth
+		if basic, ok := auth.(*proxy.ProxyBasicAuth); ok {
+			adminAuth = basic.Basic()
+		}
+		proxy.MountMetrics(admin, registry.Handler(), nil)
+		proxy.MountHealth(admin, c)
+		proxy.MountSessions(admin, c, adminAuth)
+		adminServer.Handler = admin
+		adminServer.TLSConfig = server.TLSConfig
+		go func() {
+			slog.Info("Starting admin server", "addr", adminServer.Addr)
+			if err := listen(adminServer); err != nil && err != http.ErrServerClosed {
+				slog.Error("admin server error", "error", err)
+			}
+		}()
+	case *proxyFlag:
+		// every path on the main port belongs to proxied sites
+		slog.Info("Set -admin-port to serve metrics, health checks and sessions in proxy mode")
+	default:
+		// the main port is public, so metrics take the same credentials as requests
+		proxy.MountMetrics(admin, registry.Handler(), auth)
+		admin.Handle("/", server.Handler)
+		server.Handler = admin
+	}
+
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := listen(server); err != nil && err != http.ErrServerClosed {
 			slog.Error("headless-proxy error, shutting down", "error", err)
 		}
 	}()
 
 	graceful.WaitForShutdown(server, cancel)
+	adminServer.Close()
 	if logFile, ok := (logWriter).(*os.File); ok {
 		logFile.Sync()
 	}
 }
 
+// Serve HTTPS when s has a TLS config, HTTP otherwise.
+func listen(s *http.Server) error {
+	if s.TLSConfig != nil {
+		return s.ListenAndServeTLS("", "")
+	}
+	return s.ListenAndServe()
+}
+
+func registerBrowserMetrics(registry *metrics.Registry, c *browser.Chrome) {
+	registry.NewGaugeFunc("headless_tabs_in_use", "Browser tabs in use.", func() float64 {
+		return float64(c.Stats().TabsInUse)
+	})
+	registry.NewGaugeFunc("headless_tabs_max", "Maximum browser tabs (-max-concurrent).", func() float64 {
+		return float64(c.Stats().MaxTabs)
+	})
+	registry.NewCounterFunc("headless_browser_restarts_total", "Times the browser has been replaced.", func() float64 {
+		return float64(c.Stats().Restarts)
+	})
+}
+
+func urlPolicy() *proxy.URLPolicy {
+	policy := proxy.NewURLPolicy()
+	policy.Schemes = splitList(allowSchemes.Get())
+	policy.AllowHosts = splitList(allowHosts.Get())
+	policy.DenyHosts = splitList(denyHosts.Get())
+	policy.AllowPrivate = allowPrivate.Get()
+	policy.MaxURLLength = maxURLLength.Get()
+	policy.ConnectPorts = splitList(connectPorts.Get())
+	return policy
+}
+
+// Serve over TLS when a certificate is configured, watching the certificate
+// files for changes, or with a generated certificate when self-signed is set.
+func configureTLS(ctx context.Context) error {
+	switch {
+	case tlsCert.Get() != "":
+		kp, err := proxy.LoadKeyPair(tlsCert.Get(), tlsKey.Get())
+		if err != nil {
+			return err
+		}
+		go kp.Watch(ctx, certReloadInterval)
+		server.TLSConfig = &tls.Config{GetCertificate: kp.GetCertificate}
+	case tlsSelfSigned.Get():
+		hosts := []string{"localhost", "127.0.0.1", "::1"}
+		if hostname, err := os.Hostname(); err == nil {
+			hosts = append(hosts, hostname)
+		}
+		cert, err := proxy.SelfSignedCertificate(hosts...)
+		if err != nil {
+			return err
+		}
+		slog.Warn("serving with a self-signed certificate", "hosts", hosts, "sha256", proxy.Fingerprint(cert))
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{*cert}}
+	}
+	return nil
+}
+
+// Basic proxy credentials in proxy mode, bearer API keys otherwise.
+// Returns nil when no credentials are configured.
+func authenticator() (proxy.Authenticator, error) {
+	if *proxyFlag {
+		if credsFile.Get() == "" {
+			return nil, nil
+		}
+		return proxy.LoadProxyBasicAuth(credsFile.Get())
+	}
+	keys := splitList(apiKeys.Get())
+	switch {
+	case apiKeysFile.Get() != "":
+		return proxy.LoadBearerAuth(apiKeysFile.Get(), keys...)
+	case len(keys) > 0:
+		return proxy.NewBearerAuth(keys...)
+	}
+	return nil, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func init() {
 	logWriter = os.Stderr
 	envflags.EnvPrefix = "HEADLESS_PROXY_"
 	flags.Usage = usage
 	port := envflags.NewInt("PORT", 8008)
 	port.AddTo(flags, "port", "Port to listen on")
+	adminPort = envflags.NewInt("ADMIN_PORT", 0)
+	adminPort.AddTo(flags, "admin-port", "Port for /metrics, /healthz, /readyz and /sessions, separate from the main port (required in proxy mode)")
 	readTimeout := envflags.NewDuration("READ_TIMEOUT", 5*time.Second)
 	readTimeout.AddTo(flags, "inbound-read-timeout", "Inbound connection read timeout")
 	writeTimeout := envflags.NewDuration("WRITE_TIMEOUT", 30*time.Second)
@@ -78,6 +308,62 @@ func init() {
 	idleTimeout.AddTo(flags, "inbound-idle-timeout", "Inbound connection keepalive idle timeout")
 	maxConcurrent = envflags.NewInt("MAX_CONCURRENT", 6)
 	maxConcurrent.AddTo(flags, "max-concurrent", "Maximum concurrent connections")
+	reqTimeout = envflags.NewDuration("REQUEST_TIMEOUT", browser.DefaultRequestTimeout)
+	reqTimeout.AddTo(flags, "request-timeout", "Default maximum time to render a page (0 for no limit)")
+	blockTypes = envflags.NewString("BLOCK_RESOURCE_TYPES", "")
+	blockTypes.AddTo(flags, "block-resource-types", "Comma-separated resource types to block by default [image|media|font|stylesheet|script]")
+	blockURLs = envflags.NewString("BLOCK_URL_PATTERNS", "")
+	blockURLs.AddTo(flags, "block-url-patterns", "Comma-separated URL globs (or /regexps/) to block by default")
+	credsFile = envflags.NewString("CREDENTIALS_FILE", "")
+	credsFile.AddTo(flags, "credentials-file", "File of user:password lines for Proxy-Authorization (proxy mode)")
+	apiKeys = envflags.NewString("API_KEYS", "")
+	apiKeys.AddTo(flags, "api-keys", "Comma-separated bearer API keys (service mode)")
+	apiKeysFile = envflags.NewString("API_KEYS_FILE", "")
+	apiKeysFile.AddTo(flags, "api-keys-file", "File of bearer API keys, one per line (service mode)")
+	caCert = envflags.NewString("CA_CERT", "")
+	caCert.AddTo(flags, "ca-cert", "PEM CA certificate for intercepting https requests (proxy mode)")
+	caKey = envflags.NewString("CA_KEY", "")
+	caKey.AddTo(flags, "ca-key", "PEM private key for the -ca-cert certificate")
+	tlsCert = envflags.NewString("TLS_CERT", "")
+	tlsCert.AddTo(flags, "tls-cert", "PEM certificate to serve HTTPS with (reloaded when changed)")
+	tlsKey = envflags.NewString("TLS_KEY", "")
+	tlsKey.AddTo(flags, "tls-key", "PEM private key for the -tls-cert certificate")
+	tlsSelfSigned = envflags.NewBool("TLS_SELF_SIGNED", false)
+	tlsSelfSigned.AddTo(flags, "tls-self-signed", "Serve HTTPS with a generated self-signed certificate, for development")
+	allowSchemes = envflags.NewString("ALLOW_SCHEMES", "http,https")
+	allowSchemes.AddTo(flags, "allow-schemes", "Comma-separated URL schemes that can be rendered")
+	allowHosts = envflags.NewString("ALLOW_HOSTS", "")
+	allowHosts.AddTo(flags, "allow-hosts", "Comma-separated hosts (or *.domain wildcards) to allow; empty allows all")
+	denyHosts = envflags.NewString("DENY_HOSTS", "")
+	denyHosts.AddTo(flags, "deny-hosts", "Comma-separated hosts (or *.domain wildcards) to deny")
+	allowPrivate = envflags.NewBool("ALLOW_PRIVATE_NETWORKS", false)
+	allowPrivate.AddTo(flags, "allow-private-networks", "Allow URLs for loopback, private and link-local addresses")
+	maxURLLength = envflags.NewInt("MAX_URL_LENGTH", proxy.DefaultMaxURLLength)
+	maxURLLength.AddTo(flags, "max-url-length", "Maximum URL length (0 for no limit)")
+	connectPorts = envflags.NewString("CONNECT_PORTS", "443")
+	connectPorts.AddTo(flags, "connect-ports", "Comma-separated ports the browser can open tunnels (like HTTPS) to")
+	remoteChrome = envflags.NewString("REMOTE_CHROME", "")
+	remoteChrome.AddTo(flags, "remote-chrome", "DevTools address (host:port or URL) of a running Chrome to use instead of launching one")
+	healthCheck = envflags.NewDuration("HEALTH_CHECK_INTERVAL", browser.DefaultHealthCheckInterval)
+	healthCheck.AddTo(flags, "health-check-interval", "How often to check the browser is responsive (0 to disable)")
+	recycleAfter = envflags.NewInt("RECYCLE_AFTER", 0)
+	recycleAfter.AddTo(flags, "recycle-after", "Restart the browser after this many page loads (0 for never)")
+	maxMemoryMB = envflags.NewInt("MAX_BROWSER_MEMORY_MB", 0)
+	maxMemoryMB.AddTo(flags, "max-browser-memory-mb", "Restart the browser when its memory use goes over this many MB (0 for no limit, linux only)")
+	jobRetention = envflags.NewDuration("JOB_RETENTION", proxy.DefaultJobRetention)
+	jobRetention.AddTo(flags, "job-retention", "How long finished async jobs can be fetched (service mode)")
+	maxJobs = envflags.NewInt("MAX_FINISHED_JOBS", proxy.DefaultMaxFinishedJobs)
+	maxJobs.AddTo(flags, "max-finished-jobs", "Most finished async jobs to keep; the oldest are dropped first (service mode)")
+	maxJobsMB = envflags.NewInt("MAX_FINISHED_JOBS_MB", proxy.DefaultMaxFinishedBytes>>20)
+	maxJobsMB.AddTo(flags, "max-finished-jobs-mb", "Most MB of finished async job results to keep; the oldest are dropped first (service mode)")
+	callbackKey = envflags.NewString("CALLBACK_SIGNING_KEY", "")
+	callbackKey.AddTo(flags, "callback-signing-key", "Key for signing job callbacks; callback_url is rejected without one (service mode)")
+	cookieJar = envflags.NewString("COOKIE_JAR", "")
+	cookieJar.AddTo(flags, "cookie-jar", "JSON file to keep cookies in, shared by all requests and kept across restarts")
+	sessionTTL = envflags.NewDuration("SESSION_TTL", browser.DefaultSessionTTL)
+	sessionTTL.AddTo(flags, "session-ttl", "How long a named session can be idle before it's closed")
+	maxSessions = envflags.NewInt("MAX_SESSIONS", browser.DefaultMaxSessions)
+	maxSessions.AddTo(flags, "max-sessions", "Most named sessions open at once (0 for no limit)")
 
 	userAgent = envflags.NewText("DEFAULT_USER_AGENT", &ua.Arg{})
 	userAgent.AddTo(flags, "default-user-agent", "Default user agent string (omit for browser default, :firefox: for Firefox, :safari: for Safari, or custom string)")
@@ -85,6 +371,9 @@ func init() {
 	logLevel.AddTo(flags, "log-level", "Set the log level [debug|error|info|warn]")
 	flags.Parse(os.Args[1:])
 	server.Addr = fmt.Sprintf(":%d", port.Get())
+	adminServer.Addr = fmt.Sprintf(":%d", adminPort.Get())
+	adminServer.ReadTimeout = readTimeout.Get()
+	adminServer.WriteTimeout = writeTimeout.Get()
 	server.ReadTimeout = readTimeout.Get()
 	server.WriteTimeout = writeTimeout.Get()
 	server.IdleTimeout = idleTimeout.Get()
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/efixler/headless"
+	"github.com/efixler/headless/request"
+)
+
+const (
+	// Longest payload line accepted in batch input
+	maxBatchLine = 10 << 20
+)
+
+// One line of batch input, numbered from 1.
+type batchItem struct {
+	line    int
+	payload *request.Payload
+	err     error
+}
+
+// One line of batch output.
+type batchResult struct {
+	Line    int         `json:"line"`
+	URL     string      `json:"url,omitempty"`
+	Status  int         `json:"status,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	// Screenshots and PDFs are written to File; other formats are returned in Body.
+	Body      string    `json:"body,omitempty"`
+	File      string    `json:"file,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	// Time spent waiting for a tab, and then rendering the page
+	TabWaitMS  int64 `json:"tab_wait_ms"`
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// Render the request.Payload on each line of r, up to concurrency at once,
+// writing a result line to w for each as it finishes. Files are named for
+// the run and the line, so runs don't overwrite each other's files.
+func runBatch(ctx context.Context, tf headless.TabFactory, r io.Reader, w io.Writer, concurrency int, outDir string) error {
+	run := time.Now().Format("20060102-150405")
+	items := make(chan batchItem)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				result := renderBatchItem(ctx, tf, item, filepath.Join(outDir, run))
+				mu.Lock()
+				if err := encoder.Encode(result); err != nil {
+					slog.Error("Error writing batch result", "line", item.line, "err", err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxBatchLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		item := batchItem{line: line}
+		item.payload, item.err = parseBatchLine(text)
+		items <- item
+	}
+	close(items)
+	wg.Wait()
+	return scanner.Err()
+}
+
+func parseBatchLine(text []byte) (*request.Payload, error) {
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.DisallowUnknownFields()
+	var payload request.Payload
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, err
+	}
+	if payload.URL == "" {
+		return &payload, fmt.Errorf("url is required")
+	}
+	return &payload, payload.Validate()
+}
+
+// Render the item, writing screenshots and PDFs to files starting with
+// filePrefix. Existing files aren't overwritten.
+func renderBatchItem(ctx context.Context, tf headless.TabFactory, item batchItem, filePrefix string) *batchResult {
+	result := &batchResult{Line: item.line, StartedAt: time.Now()}
+	if item.payload != nil {
+		result.URL = item.payload.URL
+	}
+	if item.err != nil {
+		result.Error = item.err.Error()
+		return result
+	}
+	tab, err := tf.AcquireTab()
+	result.TabWaitMS = time.Since(result.StartedAt).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	fetchStart := time.Now()
+	resp, fetchErr := headless.AsFetcher(tab).FetchContext(ctx, item.payload)
+	defer func() { result.DurationMS = time.Since(fetchStart).Milliseconds() }()
+	if fetchErr != nil {
+		result.Error = fetchErr.Error()
+	}
+	if resp == nil {
+		return result
+	}
+	// a failed fetch can still return what was captured before the failure,
+	// which is kept along with the error
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		result.Error = errors.Join(fetchErr, err).Error()
+		return result
+	}
+	result.Status = resp.StatusCode
+	result.Headers = resp.Header
+	switch item.payload.Format {
+	case request.FormatScreenshot, request.FormatPDF:
+	default:
+		result.Body = string(content)
+		return result
+	}
+	if (fetchErr != nil) && (len(content) == 0) {
+		return result
+	}
+	result.File = fmt.Sprintf("%s-%d%s", filePrefix, item.line, extension(resp.Header.Get("Content-Type")))
+	if err := writeNewFile(result.File, content); err != nil {
+		result.Error = errors.Join(fetchErr, err).Error()
+		result.File = ""
+	}
+	return result
+}
+
+// Like os.WriteFile, but fails if the file already exists.
+func writeNewFile(name string, content []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func extension(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "application/pdf":
+		return ".pdf"
+	}
+	return ".bin"
+}
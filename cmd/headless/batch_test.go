@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/efixler/headless"
+	"github.com/efixler/headless/request"
+)
+
+// fakeTabs renders payloads without a browser, tracking how many are
+// rendered at once.
+type fakeTabs struct {
+	inflight atomic.Int32
+	mu       sync.Mutex
+	peak     int32
+}
+
+func (f *fakeTabs) AcquireTab() (headless.Browser, error) {
+	return &fakeTab{tabs: f}, nil
+}
+
+type fakeTab struct {
+	tabs *fakeTabs
+}
+
+func (t *fakeTab) Get(url string, headers http.Header) (*http.Response, error) {
+	return t.Fetch(&request.Payload{URL: url})
+}
+
+func (t *fakeTab) GetContext(ctx context.Context, url string, headers http.Header) (*http.Response, error) {
+	return t.Get(url, headers)
+}
+
+func (t *fakeTab) Fetch(payload *request.Payload) (*http.Response, error) {
+	return t.FetchContext(context.Background(), payload)
+}
+
+func (t *fakeTab) FetchContext(ctx context.Context, payload *request.Payload) (*http.Response, error) {
+	n := t.tabs.inflight.Add(1)
+	defer t.tabs.inflight.Add(-1)
+	t.tabs.mu.Lock()
+	t.tabs.peak = max(t.tabs.peak, n)
+	t.tabs.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	if strings.Contains(payload.URL, "fail") {
+		return nil, errors.New("page load error")
+	}
+	body, contentType := "<html>"+payload.URL+"</html>", "text/html"
+	if payload.Format == request.FormatScreenshot {
+		body, contentType = "png:"+payload.URL, "image/png"
+	}
+	header := http.Header{"Content-Type": {contentType}}
+	resp := &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	if strings.Contains(payload.URL, "partial") {
+		return resp, errors.New("page load error")
+	}
+	return resp, nil
+}
+
+func readResults(t *testing.T, out *bytes.Buffer) map[int]batchResult {
+	t.Helper()
+	results := make(map[int]batchResult)
+	decoder := json.NewDecoder(out)
+	for decoder.More() {
+		var result batchResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatalf("can't decode result line: %v", err)
+		}
+		if _, ok := results[result.Line]; ok {
+			t.Errorf("line %d has more than one result", result.Line)
+		}
+		results[result.Line] = result
+	}
+	return results
+}
+
+func TestRunBatch(t *testing.T) {
+	input := strings.Join([]string{
+		`{"url": "http://example.com/1"}`,
+		``,
+		`{"url": "http://example.com/3", "format": "screenshot"}`,
+		`not json`,
+		`{"format": "html"}`,
+		`{"url": "http://example.com/fail"}`,
+		`{"url": "http://example.com/7", "unknown": true}`,
+		`{"url": "http://example.com/8"}`,
+	}, "\n")
+	tests := []struct {
+		line  int
+		url   string
+		body  string
+		file  string
+		error string
+	}{
+		{1, "http://example.com/1", "<html>http://example.com/1</html>", "", ""},
+		{3, "http://example.com/3", "", "png:http://example.com/3", ""},
+		{4, "", "", "", "invalid character"},
+		{5, "", "", "", "url is required"},
+		{6, "http://example.com/fail", "", "", "page load error"},
+		{7, "", "", "", "unknown field"},
+		{8, "http://example.com/8", "<html>http://example.com/8</html>", "", ""},
+	}
+	dir := t.TempDir()
+	tabs := &fakeTabs{}
+	var out bytes.Buffer
+	if err := runBatch(context.Background(), tabs, strings.NewReader(input), &out, 2, dir); err != nil {
+		t.Fatalf("runBatch() error: %v", err)
+	}
+	results := readResults(t, &out)
+	if len(results) != len(tests) {
+		t.Errorf("expected %d results, got %d", len(tests), len(results))
+	}
+	for _, test := range tests {
+		result, ok := results[test.line]
+		if !ok {
+			t.Errorf("[%d] expected a result", test.line)
+			continue
+		}
+		if result.URL != test.url {
+			t.Errorf("[%d] expected url %q, got %q", test.line, test.url, result.URL)
+		}
+		if result.Body != test.body {
+			t.Errorf("[%d] expected body %q, got %q", test.line, test.body, result.Body)
+		}
+		if !strings.Contains(result.Error, test.error) || ((test.error == "") != (result.Error == "")) {
+			t.Errorf("[%d] expected error containing %q, got %q", test.line, test.error, result.Error)
+		}
+		if test.file == "" {
+			if result.File != "" {
+				t.Errorf("[%d] expected no file, got %q", test.line, result.File)
+			}
+			continue
+		}
+		if (filepath.Dir(result.File) != dir) || !strings.HasSuffix(result.File, fmt.Sprintf("-%d.png", test.line)) {
+			t.Errorf("[%d] expected a .png file for the line in %s, got %q", test.line, dir, result.File)
+		}
+		if content, err := os.ReadFile(result.File); err != nil || string(content) != test.file {
+			t.Errorf("[%d] expected file content %q, got %q (%v)", test.line, test.file, content, err)
+		}
+	}
+	if tabs.peak > 2 {
+		t.Errorf("expected at most 2 pages at once, got %d", tabs.peak)
+	}
+}
+
+func TestRunBatchConcurrency(t *testing.T) {
+	var lines []string
+	for i := range 12 {
+		lines = append(lines, fmt.Sprintf(`{"url": "http://example.com/%d"}`, i+1))
+	}
+	tests := []struct {
+		concurrency int
+	}{
+		{1},
+		{3},
+		{12},
+	}
+	for _, test := range tests {
+		tabs := &fakeTabs{}
+		var out bytes.Buffer
+		err := runBatch(context.Background(), tabs, strings.NewReader(strings.Join(lines, "\n")), &out, test.concurrency, t.TempDir())
+		if err != nil {
+			t.Fatalf("[%d] runBatch() error: %v", test.concurrency, err)
+		}
+		results := readResults(t, &out)
+		for i := range lines {
+			if results[i+1].URL != fmt.Sprintf("http://example.com/%d", i+1) {
+				t.Errorf("[%d] expected line %d's result to have its url, got %q", test.concurrency, i+1, results[i+1].URL)
+			}
+		}
+		if tabs.peak > int32(test.concurrency) {
+			t.Errorf("[%d] expected at most %d pages at once, got %d", test.concurrency, test.concurrency, tabs.peak)
+		}
+		if (test.concurrency > 1) && (tabs.peak < 2) {
+			t.Errorf("[%d] expected pages to be rendered concurrently", test.concurrency)
+		}
+	}
+}
+
+func TestRunBatchLineTooLong(t *testing.T) {
+	input := `{"url": "http://example.com/1"}` + "\n" + strings.Repeat("x", maxBatchLine+1) + "\n" + `{"url": "http://example.com/3"}`
+	var out bytes.Buffer
+	err := runBatch(context.Background(), &fakeTabs{}, strings.NewReader(input), &out, 1, t.TempDir())
+	if err == nil {
+		t.Error("expected an error for a line over the limit")
+	}
+	results := readResults(t, &out)
+	if _, ok := results[1]; !ok || len(results) != 1 {
+		t.Errorf("expected only the line before the long one to be rendered, got %v", results)
+	}
+}
+
+func TestRenderBatchItemKeepsFiles(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "run")
+	existing := prefix + "-1.png"
+	if err := os.WriteFile(existing, []byte("earlier"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	item := batchItem{line: 1, payload: &request.Payload{URL: "http://example.com/", Format: request.FormatScreenshot}}
+	result := renderBatchItem(context.Background(), &fakeTabs{}, item, prefix)
+	if (result.Error == "") || (result.File != "") {
+		t.Errorf("expected an error and no file, got %q and %q", result.Error, result.File)
+	}
+	if content, _ := os.ReadFile(existing); string(content) != "earlier" {
+		t.Errorf("expected the existing file to be kept, got %q", content)
+	}
+}
+
+func TestRenderBatchItemPartial(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "run")
+	tests := []struct {
+		name   string
+		format request.Format
+		body   string
+		file   string
+	}{
+		{"html", request.FormatHTML, "<html>http://example.com/partial</html>", ""},
+		{"screenshot", request.FormatScreenshot, "", prefix + "-1.png"},
+	}
+	for _, test := range tests {
+		item := batchItem{line: 1, payload: &request.Payload{URL: "http://example.com/partial", Format: test.format}}
+		result := renderBatchItem(context.Background(), &fakeTabs{}, item, prefix)
+		if result.Error == "" {
+			t.Errorf("[%s] expected the fetch error to be kept", test.name)
+		}
+		if result.Body != test.body {
+			t.Errorf("[%s] expected body %q, got %q", test.name, test.body, result.Body)
+		}
+		if result.File != test.file {
+			t.Errorf("[%s] expected file %q, got %q", test.name, test.file, result.File)
+		}
+		if test.file == "" {
+			continue
+		}
+		if content, _ := os.ReadFile(test.file); string(content) != "png:http://example.com/partial" {
+			t.Errorf("[%s] expected the partial content in the file, got %q", test.name, content)
+		}
+	}
+}
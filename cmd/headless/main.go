@@ -7,30 +7,49 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/efixler/envflags"
+	"github.com/efixler/headless"
 	"github.com/efixler/headless/browser"
+	"github.com/efixler/headless/request"
 	"github.com/efixler/headless/ua"
 )
 
 var (
-	flags     = flag.NewFlagSet("headless", flag.ExitOnError)
-	userAgent *envflags.Value[*ua.Arg]
-	headless  bool
+	flags          = flag.NewFlagSet("headless", flag.ExitOnError)
+	userAgent      *envflags.Value[*ua.Arg]
+	logLevel       *envflags.Value[slog.Level]
+	noHeadless     *envflags.Value[bool]
+	runHeadless    bool
+	screenshotFile = flags.String("screenshot", "", "Save a screenshot of the page to this file (.png, .jpg or .jpeg) instead of printing the HTML")
+	fullPage       = flags.Bool("full-page", false, "With -screenshot, capture the entire page instead of just the viewport")
+	pdfFile        = flags.String("pdf", "", "Save the page as a PDF to this file instead of printing the HTML")
+	landscape      = flags.Bool("landscape", false, "With -pdf, use landscape orientation")
+	harFile        = flags.String("har", "", "Save a HAR file with the page's network activity to this file instead of printing the HTML")
+	article        = flags.Bool("article", false, "Print the page's main article (title, byline, date, lead image, HTML and text) as JSON instead of the HTML")
+	meta           = flags.Bool("meta", false, "Print the page's metadata (title, description, canonical URL, OpenGraph, Twitter, hreflang, JSON-LD and microdata) as JSON instead of the HTML")
+	batchFile      = flags.String("batch", "", "Render the request payloads in this JSONL file (- for stdin), printing a JSON result line for each")
+	concurrency    = flags.Int("concurrency", 4, "With -batch, maximum pages to render at once")
+	outputDir      = flags.String("output-dir", ".", "With -batch, directory for screenshot and PDF files")
+	cookieJar      = flags.String("cookie-jar", "", "JSON file to load cookies from and save them to")
 )
 
 func main() {
+	flags.Parse(os.Args[1:])
+	slog.SetLogLoggerLevel(logLevel.Get())
+	runHeadless = !noHeadless.Get()
+	if *batchFile != "" {
+		batch()
+		return
+	}
 	if len(flags.Args()) == 0 {
 		flags.Usage()
 		os.Exit(1)
 	}
 	url := flags.Args()[0]
-	b, err := browser.NewChrome(
-		context.Background(),
-		browser.Headless(headless),
-		browser.MaxTabs(1),
-		browser.UserAgentIfNotEmpty(userAgent.Get().String()),
-	)
+	b, err := newChrome(1)
 	if err != nil {
 		slog.Error("can't initialize headless browser", "err", err)
 		os.Exit(1)
@@ -42,33 +61,119 @@ func main() {
 		os.Exit(1)
 	}
 
-	resp, err := tab.Get(url, nil)
+	payload := &request.Payload{URL: url}
+	outFile := ""
+	switch {
+	case *screenshotFile != "":
+		outFile = *screenshotFile
+		payload.Format = request.FormatScreenshot
+		payload.Screenshot = &request.ScreenshotOptions{
+			FullPage: *fullPage,
+			Type:     imageType(outFile),
+		}
+	case *pdfFile != "":
+		outFile = *pdfFile
+		payload.Format = request.FormatPDF
+		payload.PDF = &request.PDFOptions{
+			Landscape:       *landscape,
+			PrintBackground: true,
+		}
+	case *harFile != "":
+		outFile = *harFile
+		payload.Format = request.FormatHAR
+	case *article:
+		payload.Format = request.FormatArticle
+	case *meta:
+		payload.Format = request.FormatMeta
+	}
+
+	resp, err := headless.AsFetcher(tab).Fetch(payload)
 	if err != nil {
-		slog.Error("Error getting HTML content", "url", url, "err", err)
+		slog.Error("Error getting page content", "url", url, "err", err)
+		if (resp != nil) && (outFile != "") {
+			// save what was captured before the failure, like a partial HAR
+			if content, _ := io.ReadAll(resp.Body); len(content) > 0 {
+				os.WriteFile(outFile, content, 0644)
+			}
+		}
 		os.Exit(1)
 	}
 	content, _ := io.ReadAll(resp.Body)
-	fmt.Println(string(content))
+	if outFile == "" {
+		fmt.Println(string(content))
+		return
+	}
+	if err := os.WriteFile(outFile, content, 0644); err != nil {
+		slog.Error("Error writing output file", "file", outFile, "err", err)
+		os.Exit(1)
+	}
+}
+
+func batch() {
+	if *concurrency < 1 {
+		slog.Error("-concurrency must be at least 1")
+		os.Exit(1)
+	}
+	in := os.Stdin
+	if *batchFile != "-" {
+		f, err := os.Open(*batchFile)
+		if err != nil {
+			slog.Error("Error opening batch file", "file", *batchFile, "err", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+	b, err := newChrome(*concurrency)
+	if err != nil {
+		slog.Error("can't initialize headless browser", "err", err)
+		os.Exit(1)
+	}
+	defer b.Cancel()
+	if err := runBatch(context.Background(), b, in, os.Stdout, *concurrency, *outputDir); err != nil {
+		slog.Error("Error reading batch input", "err", err)
+		b.Cancel()
+		os.Exit(1)
+	}
+}
+
+func newChrome(maxTabs int) (*browser.Chrome, error) {
+	options := []browser.ChromeOption{
+		browser.Headless(runHeadless),
+		browser.MaxTabs(maxTabs),
+		browser.UserAgentIfNotEmpty(userAgent.Get().String()),
+	}
+	if *cookieJar != "" {
+		options = append(options, browser.CookieJar(*cookieJar))
+	}
+	return browser.NewChrome(context.Background(), options...)
+}
+
+func imageType(filename string) request.ImageType {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg":
+		return request.ImageJPEG
+	default:
+		return request.ImagePNG
+	}
 }
 
 func init() {
 	envflags.EnvPrefix = "HEADLESS_"
-	logLevelFlag := envflags.NewLogLevel("LOG_LEVEL", slog.LevelInfo)
-	logLevelFlag.AddTo(flags, "log-level", "Log level")
-	noHeadlessFlag := envflags.NewBool("NO_HEADLESS", false)
-	noHeadlessFlag.AddTo(flags, "H", "Show browser window (don't run in headless mode)")
+	logLevel = envflags.NewLogLevel("LOG_LEVEL", slog.LevelInfo)
+	logLevel.AddTo(flags, "log-level", "Log level")
+	noHeadless = envflags.NewBool("NO_HEADLESS", false)
+	noHeadless.AddTo(flags, "H", "Show browser window (don't run in headless mode)")
 
 	userAgent = envflags.NewText("USER_AGENT", &ua.Arg{})
 	userAgent.AddTo(flags, "user-agent", "User agent to use (omit for browser default, :firefox: for Firefox, :safari: for Safari, or custom string)")
 	flags.Usage = usage
-	flags.Parse(os.Args[1:])
-	slog.SetLogLoggerLevel(logLevelFlag.Get())
-	headless = !noHeadlessFlag.Get()
 }
 
 func usage() {
 	fmt.Println(`Usage: 
 	headless [flags] :url
+	headless [flags] -batch :file
  
   -h	
   	Show this help message`)
@@ -9,6 +9,7 @@ require (
 	github.com/chromedp/chromedp v0.9.5
 	github.com/efixler/envflags v0.0.0-20240216173636-8ba3a3ae2ac0
 	github.com/efixler/webutil v0.0.0-20240331165905-2fd0e608a9e9
+	golang.org/x/net v0.24.0
 	golang.org/x/sync v0.6.0
 )
 
@@ -19,5 +20,5 @@ require (
 	github.com/gobwas/ws v1.3.2 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
-	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/sys v0.19.0 // indirect
 )
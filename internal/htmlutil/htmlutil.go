@@ -0,0 +1,92 @@
+// Package htmlutil has the helpers for reading parsed HTML that the
+// readability and metadata packages share.
+package htmlutil
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The value of n's attribute, and whether it has it.
+func AttrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// The value of n's attribute, or "" if it doesn't have it.
+func Attr(n *html.Node, key string) string {
+	v, _ := AttrOK(n, key)
+	return v
+}
+
+// Whether n is an element with one of tags, or any element with no tags.
+func IsElement(n *html.Node, tags ...string) bool {
+	return (n.Type == html.ElementNode) && ((len(tags) == 0) || slices.Contains(tags, n.Data))
+}
+
+// All the elements under n (not including n) with one of tags, in document
+// order. With no tags, all the elements under n.
+func FindAll(n *html.Node, tags ...string) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if IsElement(c, tags...) {
+				found = append(found, c)
+			}
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// The first element under n with the tag, in document order, or nil.
+func FindFirst(n *html.Node, tag string) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if IsElement(c, tag) {
+			return c
+		}
+		if found := FindFirst(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// The text under n, as is.
+func TextContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(TextContent(c))
+	}
+	return b.String()
+}
+
+// The text under n with whitespace collapsed.
+func InnerText(n *html.Node) string {
+	return strings.Join(strings.Fields(TextContent(n)), " ")
+}
+
+// Resolve ref against base, leaving it as is if it can't be parsed.
+func Resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || base == nil {
+		return ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
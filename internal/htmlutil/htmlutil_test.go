@@ -0,0 +1,57 @@
+package htmlutil
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestFind(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><body>
+		<div id="outer"><p class="first">One <b>two</b></p><div id="inner"><p>  Three
+			four </p></div></div>
+	</body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	divs := FindAll(doc, "div")
+	if len(divs) != 2 || Attr(divs[0], "id") != "outer" || Attr(divs[1], "id") != "inner" {
+		t.Errorf("expected the divs in document order, got %d", len(divs))
+	}
+	if p := FindFirst(doc, "p"); p == nil || Attr(p, "class") != "first" {
+		t.Errorf("expected the first paragraph, got %v", p)
+	}
+	if _, ok := AttrOK(divs[0], "class"); ok {
+		t.Error("expected no class attribute")
+	}
+	if got := InnerText(divs[1]); got != "Three four" {
+		t.Errorf("expected collapsed text, got %q", got)
+	}
+	if got := TextContent(FindFirst(doc, "p")); got != "One two" {
+		t.Errorf("unexpected text content %q", got)
+	}
+	if !IsElement(divs[0]) || IsElement(divs[0], "p", "span") {
+		t.Error("unexpected IsElement result")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	base, _ := url.Parse("https://foo.com/a/b")
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{"c", "https://foo.com/a/c"},
+		{" /c ", "https://foo.com/c"},
+		{"https://bar.com/", "https://bar.com/"},
+		{"", ""},
+		{"%zz", "%zz"},
+	}
+	for _, test := range tests {
+		if got := Resolve(base, test.ref); got != test.expected {
+			t.Errorf("[%s] expected %q, got %q", test.ref, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Package metrics implements the counters, gauges and histograms that
+// headless-proxy exposes, written in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+)
+
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry holds a set of metrics and writes them in registration order.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("metric %s registered twice", name))
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.Write(w)
+	})
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	desc   desc
+	mu     sync.Mutex
+	values map[string]*labeled[float64]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		values: make(map[string]*labeled[float64]),
+	}
+	r.register(name, c)
+	return c
+}
+
+// Add v to the counter with the label values, which must match the labels
+// the counter was created with.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	get(c.desc, c.values, labelValues).value += v
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// The current value for the label values, mainly for tests.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l, ok := c.values[key(labelValues)]; ok {
+		return l.value
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.desc.header(w)
+	for _, l := range sorted(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.desc.name, c.desc.labelString(l.labelValues), formatFloat(l.value))
+	}
+}
+
+// A gauge or counter whose value is read when the metrics are written.
+type funcMetric struct {
+	desc desc
+	fn   func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{desc: desc{name: name, help: help, kind: "gauge"}, fn: fn})
+}
+
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{desc: desc{name: name, help: help, kind: "counter"}, fn: fn})
+}
+
+func (f *funcMetric) write(w io.Writer) {
+	f.desc.header(w)
+	fmt.Fprintf(w, "%s %s\n", f.desc.name, formatFloat(f.fn()))
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	desc    desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*labeled[*histogram]
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*labeled[*histogram]),
+	}
+	r.register(name, h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l := get(h.desc, h.values, labelValues)
+	if l.value == nil {
+		l.value = &histogram{counts: make([]uint64, len(h.buckets))}
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			l.value.counts[i]++
+		}
+	}
+	l.value.count++
+	l.value.sum += v
+}
+
+// The number of observations for the label values, mainly for tests.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if l, ok := h.values[key(labelValues)]; ok && l.value != nil {
+		return l.value.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.desc.header(w)
+	name := h.desc.name
+	for _, l := range sorted(h.values) {
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, h.desc.labelString(l.labelValues, "le", formatFloat(upper)), l.value.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, h.desc.labelString(l.labelValues, "le", "+Inf"), l.value.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, h.desc.labelString(l.labelValues), formatFloat(l.value.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, h.desc.labelString(l.labelValues), l.value.count)
+	}
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+type labeled[T any] struct {
+	labelValues []string
+	value       T
+}
+
+func (d desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// Find or create the entry for the label values; the caller holds the lock.
+func get[T any](d desc, values map[string]*labeled[T], labelValues []string) *labeled[T] {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", d.name, len(d.labels), len(labelValues)))
+	}
+	k := key(labelValues)
+	l, ok := values[k]
+	if !ok {
+		l = &labeled[T]{labelValues: append([]string(nil), labelValues...)}
+		values[k] = l
+	}
+	return l
+}
+
+// {a="1",b="2"} for the label values, plus any extra name/value pairs.
+func (d desc) labelString(labelValues []string, extra ...string) string {
+	if len(d.labels)+len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(d.labels)+len(extra)/2)
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for i, name := range d.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escape.Replace(labelValues[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escape.Replace(extra[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func key(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func sorted[T any](values map[string]*labeled[T]) []*labeled[T] {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]*labeled[T], 0, len(keys))
+	for _, k := range keys {
+		list = append(list, values[k])
+	}
+	return list
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests handled.", "mode", "code")
+	requests.Inc("proxy", "200")
+	requests.Inc("proxy", "200")
+	requests.Add(3, "service", "502")
+	latency := r.NewHistogramVec("test_latency_seconds", "Latency.", []float64{1, 0.1}, "result")
+	latency.Observe(0.05, "ok")
+	latency.Observe(0.5, "ok")
+	latency.Observe(5, "ok")
+	r.NewGaugeFunc("test_in_use", "In use.", func() float64 { return 2 })
+	r.NewCounterFunc("test_restarts_total", "Restarts\nwith a newline.", func() float64 { return 1 })
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Header().Get("Content-Type") != ContentType {
+		t.Errorf("unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+	expected := `# HELP test_requests_total Requests handled.
+# TYPE test_requests_total counter
+test_requests_total{mode="proxy",code="200"} 2
+test_requests_total{mode="service",code="502"} 3
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{result="ok",le="0.1"} 1
+test_latency_seconds_bucket{result="ok",le="1"} 2
+test_latency_seconds_bucket{result="ok",le="+Inf"} 3
+test_latency_seconds_sum{result="ok"} 5.55
+test_latency_seconds_count{result="ok"} 3
+# HELP test_in_use In use.
+# TYPE test_in_use gauge
+test_in_use 2
+# HELP test_restarts_total Restarts\nwith a newline.
+# TYPE test_restarts_total counter
+test_restarts_total 1
+`
+	if got := w.Body.String(); got != expected {
+		t.Errorf("unexpected exposition:\n%s\nexpected:\n%s", got, expected)
+	}
+	if requests.Value("proxy", "200") != 2 {
+		t.Errorf("expected counter value 2, got %v", requests.Value("proxy", "200"))
+	}
+	if latency.Count("ok") != 3 {
+		t.Errorf("expected 3 observations, got %d", latency.Count("ok"))
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Test.", "value")
+	c.Inc("a \"quoted\"\\path\n")
+	var b strings.Builder
+	r.Write(&b)
+	if !strings.Contains(b.String(), `test_total{value="a \"quoted\"\\path\n"} 1`) {
+		t.Errorf("label not escaped: %s", b.String())
+	}
+}
+
+func TestRegistrationPanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Test.", "a")
+	for name, fn := range map[string]func(){
+		"duplicate name":  func() { r.NewCounterVec("test_total", "Test.") },
+		"wrong label set": func() { r.NewCounterVec("other_total", "Test.", "a", "b").Inc("1") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("[%s] expected a panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
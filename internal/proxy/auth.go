@@ -0,0 +1,241 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/efixler/headless/browser"
+)
+
+const (
+	Realm = "headless"
+)
+
+var (
+	ErrNoCredentials = errors.New("no credentials configured")
+)
+
+// Authenticator decides whether a request may use the service and, when it
+// may not, writes the response that asks the client for credentials.
+type Authenticator interface {
+	Authenticate(req *http.Request) bool
+	Challenge(w http.ResponseWriter)
+}
+
+// Identifier is implemented by authenticators that can tell their callers
+// apart, so that each caller's named sessions are kept from the others'.
+type Identifier interface {
+	// The caller of a request that was authenticated.
+	Principal(req *http.Request) string
+}
+
+// Wrap next so that it's only called for requests accepted by the authenticator.
+// When the authenticator is an Identifier, the caller owns the request's
+// sessions; see browser.WithSessionOwner.
+func requireAuth(a Authenticator, next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !a.Authenticate(req) {
+			slog.Info("headless request not authorized", "remote", req.RemoteAddr, "url", req.URL)
+			a.Challenge(w)
+			return
+		}
+		if id, ok := a.(Identifier); ok {
+			req = req.WithContext(browser.WithSessionOwner(req.Context(), id.Principal(req)))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// ProxyBasicAuth checks Basic credentials in the Proxy-Authorization header,
+// responding with 407 Proxy Authentication Required when they're missing or wrong.
+type ProxyBasicAuth struct {
+	// password hashes keyed by user name
+	users map[string][32]byte
+}
+
+func NewProxyBasicAuth(credentials map[string]string) (*ProxyBasicAuth, error) {
+	if len(credentials) == 0 {
+		return nil, ErrNoCredentials
+	}
+	a := &ProxyBasicAuth{users: make(map[string][32]byte, len(credentials))}
+	for user, password := range credentials {
+		a.users[user] = sha256.Sum256([]byte(password))
+	}
+	return a, nil
+}
+
+// Load credentials from a file with one user:password pair per line.
+// Blank lines and lines starting with # are ignored.
+func LoadProxyBasicAuth(path string) (*ProxyBasicAuth, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+	credentials := make(map[string]string, len(lines))
+	for i, line := range lines {
+		user, password, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s:%d: expected user:password", path, i+1)
+		}
+		credentials[user] = password
+	}
+	return NewProxyBasicAuth(credentials)
+}
+
+func (a *ProxyBasicAuth) Authenticate(req *http.Request) bool {
+	return a.check(req.Header.Values("Proxy-Authorization"))
+}
+
+// The user name in the Proxy-Authorization header.
+func (a *ProxyBasicAuth) Principal(req *http.Request) string {
+	return basicUser(req.Header.Values("Proxy-Authorization"))
+}
+
+func (a *ProxyBasicAuth) Challenge(w http.ResponseWriter) {
+	w.Header().Set("Proxy-Authenticate", fmt.Sprintf("Basic realm=%q", Realm))
+	http.Error(w, http.StatusText(http.StatusProxyAuthRequired), http.StatusProxyAuthRequired)
+}
+
+// The same credentials, for endpoints that aren't proxied, like the ones on
+// the admin port, where clients send them in the Authorization header.
+func (a *ProxyBasicAuth) Basic() *BasicAuth {
+	return &BasicAuth{credentials: a}
+}
+
+// Whether the Basic credentials in the header values match a user.
+func (a *ProxyBasicAuth) check(values []string) bool {
+	user, password, ok := basicCredentials(values)
+	if !ok {
+		return false
+	}
+	expected, known := a.users[user]
+	given := sha256.Sum256([]byte(password))
+	// compare even for unknown users so timing doesn't reveal which users exist
+	return (subtle.ConstantTimeCompare(expected[:], given[:]) == 1) && known
+}
+
+func basicCredentials(values []string) (user, password string, ok bool) {
+	// http.Request.BasicAuth only reads the Authorization header
+	r := &http.Request{Header: http.Header{"Authorization": values}}
+	return r.BasicAuth()
+}
+
+func basicUser(values []string) string {
+	user, _, _ := basicCredentials(values)
+	return user
+}
+
+// BasicAuth checks Basic credentials in the Authorization header,
+// responding with 401 Unauthorized when they're missing or wrong.
+type BasicAuth struct {
+	credentials *ProxyBasicAuth
+}
+
+func (a *BasicAuth) Authenticate(req *http.Request) bool {
+	return a.credentials.check(req.Header.Values("Authorization"))
+}
+
+// The user name in the Authorization header.
+func (a *BasicAuth) Principal(req *http.Request) string {
+	return basicUser(req.Header.Values("Authorization"))
+}
+
+func (a *BasicAuth) Challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", Realm))
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// BearerAuth checks for an API key in an Authorization: Bearer header,
+// responding with 401 Unauthorized when it's missing or wrong.
+type BearerAuth struct {
+	keys [][32]byte
+}
+
+func NewBearerAuth(keys ...string) (*BearerAuth, error) {
+	a := &BearerAuth{}
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			a.keys = append(a.keys, sha256.Sum256([]byte(key)))
+		}
+	}
+	if len(a.keys) == 0 {
+		return nil, ErrNoCredentials
+	}
+	return a, nil
+}
+
+// Load API keys from a file with one key per line, adding them to any keys
+// passed directly. Blank lines and lines starting with # are ignored.
+func LoadBearerAuth(path string, keys ...string) (*BearerAuth, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewBearerAuth(append(keys, lines...)...)
+}
+
+func (a *BearerAuth) Authenticate(req *http.Request) bool {
+	given, ok := bearerHash(req)
+	if !ok {
+		return false
+	}
+	match := 0
+	for _, key := range a.keys {
+		match |= subtle.ConstantTimeCompare(key[:], given[:])
+	}
+	return match == 1
+}
+
+// The start of the API key's hash, which tells callers apart without
+// revealing their keys.
+func (a *BearerAuth) Principal(req *http.Request) string {
+	given, _ := bearerHash(req)
+	return hex.EncodeToString(given[:8])
+}
+
+func bearerHash(req *http.Request) ([32]byte, bool) {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return [32]byte{}, false
+	}
+	return sha256.Sum256([]byte(strings.TrimSpace(token))), true
+}
+
+func (a *BearerAuth) Challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", Realm))
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return scanLines(f)
+}
+
+func scanLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func basic(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func TestProxyBasicAuth(t *testing.T) {
+	auth, err := NewProxyBasicAuth(map[string]string{"alice": "secret", "bob": "pa:ss"})
+	if err != nil {
+		t.Fatalf("NewProxyBasicAuth() error: %v", err)
+	}
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		ok     bool
+	}{
+		{"no header", "", "", false},
+		{"valid", "Proxy-Authorization", basic("alice", "secret"), true},
+		{"password with colon", "Proxy-Authorization", basic("bob", "pa:ss"), true},
+		{"wrong password", "Proxy-Authorization", basic("alice", "nope"), false},
+		{"unknown user", "Proxy-Authorization", basic("carol", "secret"), false},
+		{"wrong header", "Authorization", basic("alice", "secret"), false},
+		{"not basic", "Proxy-Authorization", "Bearer secret", false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		if ok := auth.Authenticate(req); ok != test.ok {
+			t.Errorf("[%s] expected %v, got %v", test.name, test.ok, ok)
+		}
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	proxyAuth, _ := NewProxyBasicAuth(map[string]string{"alice": "secret"})
+	auth := proxyAuth.Basic()
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		ok     bool
+	}{
+		{"no header", "", "", false},
+		{"valid", "Authorization", basic("alice", "secret"), true},
+		{"wrong password", "Authorization", basic("alice", "nope"), false},
+		{"proxy header", "Proxy-Authorization", basic("alice", "secret"), false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/sessions", nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		if ok := auth.Authenticate(req); ok != test.ok {
+			t.Errorf("[%s] expected %v, got %v", test.name, test.ok, ok)
+		}
+	}
+	w := httptest.NewRecorder()
+	auth.Challenge(w)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Basic realm="headless"` {
+		t.Errorf("expected a 401 Basic challenge, got %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	auth, err := NewBearerAuth("key1", " key2 ", "")
+	if err != nil {
+		t.Fatalf("NewBearerAuth() error: %v", err)
+	}
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"no header", "", false},
+		{"first key", "Bearer key1", true},
+		{"second key", "Bearer key2", true},
+		{"lowercase scheme", "bearer key1", true},
+		{"unknown key", "Bearer key3", false},
+		{"basic", basic("key1", ""), false},
+		{"no scheme", "key1", false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		if test.value != "" {
+			req.Header.Set("Authorization", test.value)
+		}
+		if ok := auth.Authenticate(req); ok != test.ok {
+			t.Errorf("[%s] expected %v, got %v", test.name, test.ok, ok)
+		}
+	}
+}
+
+func TestNoCredentials(t *testing.T) {
+	if _, err := NewBearerAuth(" ", ""); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials, got %v", err)
+	}
+	if _, err := NewProxyBasicAuth(nil); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials, got %v", err)
+	}
+}
+
+func TestLoadCredentialFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	creds := write("creds", "# users\nalice:secret\n\n  bob:hunter2  \n")
+	basicAuth, err := LoadProxyBasicAuth(creds)
+	if err != nil {
+		t.Fatalf("LoadProxyBasicAuth() error: %v", err)
+	}
+	if len(basicAuth.users) != 2 {
+		t.Errorf("expected 2 users, got %d", len(basicAuth.users))
+	}
+	bad := write("bad", "alice:secret\nnocolon\n")
+	if _, err := LoadProxyBasicAuth(bad); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("expected error on line 2, got %v", err)
+	}
+
+	keys := write("keys", "# keys\nkey1\nkey2\n")
+	bearer, err := LoadBearerAuth(keys, "key3")
+	if err != nil {
+		t.Fatalf("LoadBearerAuth() error: %v", err)
+	}
+	if len(bearer.keys) != 3 {
+		t.Errorf("expected 3 keys, got %d", len(bearer.keys))
+	}
+	if _, err := LoadBearerAuth(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestHandlersChallenge(t *testing.T) {
+	basicAuth, _ := NewProxyBasicAuth(map[string]string{"alice": "secret"})
+	bearer, _ := NewBearerAuth("key1")
+	tf := &mockBrowser{}
+	proxyHandler, err := HTTPProxy(tf, WithAuthenticator(basicAuth))
+	if err != nil {
+		t.Fatalf("HTTPProxy() error: %v", err)
+	}
+	service, err := Service(tf, WithAuthenticator(bearer))
+	if err != nil {
+		t.Fatalf("Service() error: %v", err)
+	}
+	tests := []struct {
+		name      string
+		handler   http.Handler
+		req       *http.Request
+		status    int
+		challenge string
+	}{
+		{
+			"proxy",
+			proxyHandler,
+			httptest.NewRequest("GET", "http://example.com/", nil),
+			http.StatusProxyAuthRequired,
+			"Proxy-Authenticate",
+		},
+		{
+			"service",
+			service,
+			httptest.NewRequest("POST", "/", strings.NewReader(`{"url":"http://example.com"}`)),
+			http.StatusUnauthorized,
+			"WWW-Authenticate",
+		},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		test.handler.ServeHTTP(w, test.req)
+		if w.Code != test.status {
+			t.Errorf("[%s] expected %d, got %d", test.name, test.status, w.Code)
+		}
+		if got := w.Header().Get(test.challenge); got != `Basic realm="headless"` && got != `Bearer realm="headless"` {
+			t.Errorf("[%s] unexpected %s header %q", test.name, test.challenge, got)
+		}
+		if tf.url != "" {
+			t.Errorf("[%s] browser shouldn't be called, got url %q", test.name, tf.url)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("Proxy-Authorization", basic("alice", "secret"))
+	w := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(w, req)
+	if tf.url != "http://example.com/" {
+		t.Errorf("expected authorized request to reach the browser, got url %q", tf.url)
+	}
+	if tf.headers.Get("Proxy-Authorization") != "" {
+		t.Error("Proxy-Authorization should not be forwarded")
+	}
+}
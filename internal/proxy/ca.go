@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	leafValidity  = 365 * 24 * time.Hour
+	maxCachedCert = 1024
+)
+
+var (
+	ErrNotCA = errors.New("certificate is not a CA")
+)
+
+// CertificateAuthority mints TLS certificates for intercepted hosts on the fly.
+// Clients of the proxy need to trust the CA certificate for https requests.
+type CertificateAuthority struct {
+	cert    *x509.Certificate
+	der     []byte
+	signer  crypto.Signer
+	leafKey *ecdsa.PrivateKey
+	mu      sync.Mutex
+	cache   map[string]*tls.Certificate
+	// Certificates are minted once per host at a time, outside mu
+	minting singleflight.Group
+}
+
+// Load a CA from PEM encoded certificate and key files.
+func LoadCA(certFile, keyFile string) (*CertificateAuthority, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", pair.PrivateKey)
+	}
+	return NewCA(cert, signer)
+}
+
+func NewCA(cert *x509.Certificate, key crypto.Signer) (*CertificateAuthority, error) {
+	if !cert.IsCA {
+		return nil, ErrNotCA
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &CertificateAuthority{
+		cert:    cert,
+		der:     cert.Raw,
+		signer:  key,
+		leafKey: leafKey,
+		cache:   make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// Generate a self-signed CA, useful for tests and throwaway setups.
+func GenerateCA(name string, validity time.Duration) (*CertificateAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return NewCA(cert, key)
+}
+
+// The CA certificate, for adding to a client's trusted roots.
+func (ca *CertificateAuthority) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// Returns a certificate for host (a DNS name or IP address), minting it if needed.
+// Concurrent requests for the same host share one new certificate, and requests
+// for other hosts aren't held up while it's minted.
+func (ca *CertificateAuthority) certificate(host string) (*tls.Certificate, error) {
+	if cert := ca.cached(host); cert != nil {
+		return cert, nil
+	}
+	v, err, _ := ca.minting.Do(host, func() (any, error) {
+		// another call may have just finished minting it
+		if cert := ca.cached(host); cert != nil {
+			return cert, nil
+		}
+		cert, err := ca.mint(host)
+		if err != nil {
+			return nil, err
+		}
+		ca.mu.Lock()
+		defer ca.mu.Unlock()
+		if len(ca.cache) >= maxCachedCert {
+			clear(ca.cache)
+		}
+		ca.cache[host] = cert
+		return cert, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*tls.Certificate), nil
+}
+
+// The cached certificate for host, or nil if there isn't an unexpired one.
+func (ca *CertificateAuthority) cached(host string) *tls.Certificate {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if cert, ok := ca.cache[host]; ok && time.Now().Before(cert.Leaf.NotAfter) {
+		return cert
+	}
+	return nil
+}
+
+// Create and sign a new certificate for host.
+func (ca *CertificateAuthority) mint(host string) (*tls.Certificate, error) {
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if template.NotAfter.After(ca.cert.NotAfter) {
+		template.NotAfter = ca.cert.NotAfter
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, ca.leafKey.Public(), ca.signer)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.der},
+		PrivateKey:  ca.leafKey,
+		Leaf:        leaf,
+	}, nil
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
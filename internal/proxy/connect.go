@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/efixler/headless/browser"
+)
+
+// Used in the tunnel when the outer server doesn't set these.
+const (
+	tunnelReadHeaderTimeout = 10 * time.Second
+	tunnelIdleTimeout       = 2 * time.Minute
+)
+
+// Handle CONNECT requests by terminating TLS in the tunnel with a certificate
+// minted by the CA, then passing each request read from the tunnel to next
+// as an absolute https request. Other requests go straight to next.
+func connectHandler(ca *CertificateAuthority, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodConnect {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if ca == nil {
+			http.Error(w, "https proxying is not configured", http.StatusNotImplemented)
+			return
+		}
+		host, port, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			http.Error(w, "CONNECT requires host:port", http.StatusBadRequest)
+			return
+		}
+		authority := req.Host
+		if port == "443" {
+			authority = host
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "CONNECT not supported", http.StatusInternalServerError)
+			return
+		}
+		conn, rw, err := hijacker.Hijack()
+		if err != nil {
+			slog.Error("can't hijack CONNECT connection", "host", req.Host, "err", err)
+			return
+		}
+		tunnel := tunnelServer(req)
+		// The outer server's deadlines are for the CONNECT request; replace them
+		// with one for the 200 response, then leave the rest to the tunnel server.
+		conn.SetDeadline(time.Time{})
+		conn.SetWriteDeadline(time.Now().Add(tunnel.ReadHeaderTimeout))
+		if _, err := rw.WriteString("HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+			conn.Close()
+			return
+		}
+		if err := rw.Flush(); err != nil {
+			conn.Close()
+			return
+		}
+		conn.SetWriteDeadline(time.Time{})
+		slog.Debug("headless proxy tunnel", "remote", req.RemoteAddr, "host", req.Host)
+		tc := &tunnelConn{Conn: conn, r: rw.Reader, done: make(chan struct{})}
+		tlsConn := tls.Server(tc, &tls.Config{
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				if hello.ServerName != "" {
+					return ca.certificate(hello.ServerName)
+				}
+				return ca.certificate(host)
+			},
+			NextProtos: []string{"http/1.1"},
+		})
+		// requests in the tunnel belong to whoever made the CONNECT request
+		owner := browser.SessionOwner(req.Context())
+		tunnel.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Scheme = "https"
+			r.URL.Host = authority
+			next.ServeHTTP(w, r.WithContext(browser.WithSessionOwner(r.Context(), owner)))
+		})
+		tunnel.Serve(&tunnelListener{conn: tlsConn, tc: tc})
+	})
+}
+
+// The server for the requests in a tunnel, with the read, write and idle
+// timeouts of the server that accepted the CONNECT request. The TLS handshake
+// is limited by the shortest of the read header, read and write timeouts.
+func tunnelServer(req *http.Request) *http.Server {
+	tunnel := &http.Server{
+		ReadHeaderTimeout: tunnelReadHeaderTimeout,
+		IdleTimeout:       tunnelIdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelDebug),
+	}
+	outer, ok := req.Context().Value(http.ServerContextKey).(*http.Server)
+	if !ok {
+		return tunnel
+	}
+	tunnel.ReadTimeout = outer.ReadTimeout
+	tunnel.WriteTimeout = outer.WriteTimeout
+	if outer.ReadHeaderTimeout > 0 {
+		tunnel.ReadHeaderTimeout = outer.ReadHeaderTimeout
+	} else if outer.ReadTimeout > 0 {
+		tunnel.ReadHeaderTimeout = outer.ReadTimeout
+	}
+	if outer.IdleTimeout > 0 {
+		tunnel.IdleTimeout = outer.IdleTimeout
+	}
+	return tunnel
+}
+
+// tunnelConn is the hijacked connection; reads go through the buffered reader
+// from the hijack in case the client sent data before the 200 response.
+type tunnelConn struct {
+	net.Conn
+	r    *bufio.Reader
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *tunnelConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *tunnelConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
+
+// tunnelListener hands the tunnel's one connection to an http.Server, then
+// blocks further Accepts until the connection is closed.
+type tunnelListener struct {
+	conn     net.Conn
+	tc       *tunnelConn
+	accepted bool
+}
+
+func (l *tunnelListener) Accept() (net.Conn, error) {
+	if !l.accepted {
+		l.accepted = true
+		return l.conn, nil
+	}
+	<-l.tc.done
+	return nil, net.ErrClosed
+}
+
+func (l *tunnelListener) Close() error {
+	return nil
+}
+
+func (l *tunnelListener) Addr() net.Addr {
+	return l.tc.LocalAddr()
+}
@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	nurl "net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTLSProxyClient(t *testing.T, handler http.Handler, ca *CertificateAuthority, user *nurl.Userinfo) *http.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	proxyURL, _ := nurl.Parse(server.URL)
+	proxyURL.User = user
+	roots := x509.NewCertPool()
+	if ca != nil {
+		roots.AddCert(ca.Certificate())
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		},
+	}
+}
+
+func TestConnectInterceptsHTTPS(t *testing.T) {
+	ca, err := GenerateCA("headless test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCA() error: %v", err)
+	}
+	tf := &mockBrowser{}
+	handler, err := HTTPProxy(tf, WithCA(ca))
+	if err != nil {
+		t.Fatalf("HTTPProxy() error: %v", err)
+	}
+	client := newTLSProxyClient(t, handler, ca, nil)
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"default port", "https://example.com/path?q=1"},
+		{"other port", "https://example.com:8443/"},
+		{"same tunnel", "https://example.com/again"},
+		{"ip address", "https://127.0.0.2/"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.url, nil)
+		req.Header.Set("User-Agent", "test-agent")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("[%s] request error: %v", test.name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("[%s] expected 200, got %d", test.name, resp.StatusCode)
+		}
+		if tf.url != test.url {
+			t.Errorf("[%s] expected browser url %s, got %s", test.name, test.url, tf.url)
+		}
+		if !strings.Contains(string(body), test.url) {
+			t.Errorf("[%s] expected body to contain %s, got %s", test.name, test.url, body)
+		}
+		if tf.headers.Get("User-Agent") != "test-agent" {
+			t.Errorf("[%s] expected User-Agent to be forwarded, got %q", test.name, tf.headers.Get("User-Agent"))
+		}
+	}
+}
+
+func TestConnectWithoutCA(t *testing.T) {
+	handler, err := HTTPProxy(&mockBrowser{})
+	if err != nil {
+		t.Fatalf("HTTPProxy() error: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodConnect, "http://example.com:443", nil)
+	req.Host = "example.com:443"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501, got %d", w.Code)
+	}
+}
+
+func TestConnectRequiresProxyAuth(t *testing.T) {
+	ca, err := GenerateCA("headless test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCA() error: %v", err)
+	}
+	auth, _ := NewProxyBasicAuth(map[string]string{"alice": "secret"})
+	tf := &mockBrowser{}
+	handler, err := HTTPProxy(tf, WithCA(ca), WithAuthenticator(auth))
+	if err != nil {
+		t.Fatalf("HTTPProxy() error: %v", err)
+	}
+	if _, err := newTLSProxyClient(t, handler, ca, nil).Get("https://example.com/"); err == nil {
+		t.Error("expected CONNECT without credentials to fail")
+	}
+	if tf.url != "" {
+		t.Errorf("browser shouldn't be called, got url %q", tf.url)
+	}
+	resp, err := newTLSProxyClient(t, handler, ca, nurl.UserPassword("alice", "secret")).Get("https://example.com/")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	if tf.url != "https://example.com/" {
+		t.Errorf("expected browser url https://example.com/, got %q", tf.url)
+	}
+}
+
+func TestConnectTunnelTimeouts(t *testing.T) {
+	ca, err := GenerateCA("headless test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCA() error: %v", err)
+	}
+	handler, err := HTTPProxy(&mockBrowser{}, WithCA(ca))
+	if err != nil {
+		t.Fatalf("HTTPProxy() error: %v", err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ReadHeaderTimeout = 100 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("CONNECT error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	// never start the TLS handshake; the tunnel should be closed
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := r.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected the idle tunnel to be closed, got %v", err)
+	}
+}
+
+func TestCACertificates(t *testing.T) {
+	ca, err := GenerateCA("headless test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCA() error: %v", err)
+	}
+	cert, err := ca.certificate("example.com")
+	if err != nil {
+		t.Fatalf("certificate() error: %v", err)
+	}
+	if again, _ := ca.certificate("example.com"); again != cert {
+		t.Error("expected certificate to be cached")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots}); err != nil {
+		t.Errorf("certificate doesn't verify: %v", err)
+	}
+	if cert.Leaf.NotAfter.After(ca.Certificate().NotAfter) {
+		t.Error("certificate outlives the CA")
+	}
+	ipCert, err := ca.certificate("10.0.0.1")
+	if err != nil {
+		t.Fatalf("certificate() error: %v", err)
+	}
+	if len(ipCert.Leaf.IPAddresses) != 1 || len(ipCert.Leaf.DNSNames) != 0 {
+		t.Errorf("expected an IP address certificate, got %v %v", ipCert.Leaf.IPAddresses, ipCert.Leaf.DNSNames)
+	}
+	if _, err := NewCA(cert.Leaf, ca.leafKey); !errors.Is(err, ErrNotCA) {
+		t.Errorf("expected ErrNotCA, got %v", err)
+	}
+}
+
+func TestCACertificatesConcurrently(t *testing.T) {
+	ca, err := GenerateCA("headless test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCA() error: %v", err)
+	}
+	hosts := []string{"example.com", "example.org"}
+	certs := make([]*tls.Certificate, 16)
+	var wg sync.WaitGroup
+	for i := range certs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			certs[i], _ = ca.certificate(hosts[i%len(hosts)])
+		}()
+	}
+	wg.Wait()
+	for i, cert := range certs {
+		if cert == nil {
+			t.Fatalf("[%d] expected a certificate", i)
+		}
+		if cert != certs[i%len(hosts)] {
+			t.Errorf("[%d] expected one certificate for %s, got more", i, hosts[i%len(hosts)])
+		}
+	}
+}
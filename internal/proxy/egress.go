@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+const (
+	egressReadHeaderTimeout = 10 * time.Second
+)
+
+// EgressProxy is a forward proxy for the browser's own traffic, so that the
+// policy is enforced on every connection the browser makes, including
+// websockets, workers and out-of-process frames that the browser's request
+// interception doesn't see. Connections are made with policy.DialContext.
+func EgressProxy(policy *URLPolicy) http.Handler {
+	forward := &httputil.ReverseProxy{
+		// requests to a forward proxy already have the absolute target URL
+		Rewrite: func(*httputil.ProxyRequest) {},
+		Transport: &http.Transport{
+			DialContext:           policy.DialContext,
+			MaxIdleConnsPerHost:   4,
+			IdleConnTimeout:       90 * time.Second,
+			ResponseHeaderTimeout: 60 * time.Second,
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			status, msg := egressError(err)
+			http.Error(w, msg, status)
+		},
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelDebug),
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodConnect:
+			egressTunnel(w, req, policy)
+		case req.URL.IsAbs():
+			forward.ServeHTTP(w, req)
+		default:
+			http.Error(w, "not a proxy request", http.StatusBadRequest)
+		}
+	})
+}
+
+// Starts EgressProxy on a loopback port, returning its URL for the browser's
+// proxy server setting. The proxy is stopped when ctx is done.
+func StartEgressProxy(ctx context.Context, policy *URLPolicy) (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	server := &http.Server{
+		Handler:           EgressProxy(policy),
+		ReadHeaderTimeout: egressReadHeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelDebug),
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("egress proxy error", "err", err)
+		}
+	}()
+	return "http://" + listener.Addr().String(), nil
+}
+
+// Connect the client to req.Host and copy bytes both ways until either side
+// is done. Only the policy's ConnectPorts can be tunneled to.
+func egressTunnel(w http.ResponseWriter, req *http.Request, policy *URLPolicy) {
+	err := policy.checkConnect(req.Host)
+	var target net.Conn
+	if err == nil {
+		target, err = policy.DialContext(req.Context(), "tcp", req.Host)
+	}
+	if err != nil {
+		slog.Debug("egress connection not made", "host", req.Host, "err", err)
+		status, msg := egressError(err)
+		http.Error(w, msg, status)
+		return
+	}
+	defer target.Close()
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "CONNECT not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		slog.Error("can't hijack egress CONNECT connection", "host", req.Host, "err", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Time{})
+	if _, err := rw.WriteString("HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+	if err := rw.Flush(); err != nil {
+		return
+	}
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(target, rw.Reader)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, target)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func egressError(err error) (int, string) {
+	if errors.Is(err, ErrForbiddenURL) {
+		return http.StatusForbidden, err.Error()
+	}
+	return http.StatusBadGateway, fmt.Sprintf("can't connect: %s", err)
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	nurl "net/url"
+	"testing"
+)
+
+func TestEgressProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	tlsTarget := httptest.NewTLSServer(target.Config.Handler)
+	defer tlsTarget.Close()
+	tlsURL, _ := nurl.Parse(tlsTarget.URL)
+	allowTLSPort := func(p *URLPolicy) {
+		p.AllowPrivate = true
+		p.ConnectPorts = []string{tlsURL.Port()}
+	}
+	tests := []struct {
+		name   string
+		modify func(p *URLPolicy)
+		url    string
+		status int
+	}{
+		{"http private", nil, target.URL, http.StatusForbidden},
+		{"https private", nil, tlsTarget.URL, 0},
+		{"http allow private", func(p *URLPolicy) { p.AllowPrivate = true }, target.URL, http.StatusOK},
+		{"https allow private", allowTLSPort, tlsTarget.URL, http.StatusOK},
+		{"https port not allowed", func(p *URLPolicy) { p.AllowPrivate = true }, tlsTarget.URL, 0},
+		{"denied host", func(p *URLPolicy) {
+			p.AllowPrivate = true
+			p.DenyHosts = []string{"127.0.0.1"}
+		}, target.URL, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		p := testPolicy()
+		if test.modify != nil {
+			test.modify(p)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		proxyURL, err := StartEgressProxy(ctx, p)
+		if err != nil {
+			t.Fatalf("[%s] StartEgressProxy() error: %v", test.name, err)
+		}
+		u, _ := nurl.Parse(proxyURL)
+		transport := tlsTarget.Client().Transport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(u)
+		client := &http.Client{Transport: transport}
+		resp, err := client.Get(test.url)
+		cancel()
+		if test.status == 0 {
+			// the proxy refuses the CONNECT, which the client reports as an error
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("[%s] expected the tunnel to be refused, got %d", test.name, resp.StatusCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] request error: %v", test.name, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("[%s] expected status %d, got %d", test.name, test.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestEgressProxyRejectsOriginRequests(t *testing.T) {
+	w := httptest.NewRecorder()
+	EgressProxy(testPolicy()).ServeHTTP(w, httptest.NewRequest("GET", "/path", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestEgressProxyConnectPorts(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		status int
+	}{
+		{"ssh", "example.com:22", http.StatusForbidden},
+		{"smtp", "example.com:25", http.StatusForbidden},
+		{"no port", "example.com", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodConnect, "http://"+test.host, nil)
+		req.Host = test.host
+		EgressProxy(testPolicy()).ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("[%s] expected status %d, got %d", test.name, test.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/efixler/headless"
+	"github.com/efixler/headless/request"
+)
+
+// envelopeBrowser returns a 404 from the target, with a target header.
+type envelopeBrowser struct {
+	mockBrowser
+}
+
+func (b *envelopeBrowser) AcquireTab() (headless.Browser, error) {
+	return b, nil
+}
+
+func (b *envelopeBrowser) FetchContext(ctx context.Context, payload *request.Payload) (*http.Response, error) {
+	b.payload = payload
+	contentType := "text/html"
+	if payload.Format == request.FormatJSON {
+		contentType = "application/json"
+	}
+	body := `{"status": 404}`
+	return &http.Response{
+		StatusCode:    http.StatusNotFound,
+		Header:        http.Header{"Content-Type": {contentType}, "X-Upstream": {"yes"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+func TestJSONEnvelopeResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        string
+		accept         string
+		expectFormat   request.Format
+		expectStatus   int
+		expectUpstream bool
+	}{
+		{"html", `{"url": "http://foo.com/"}`, "", "", http.StatusNotFound, true},
+		{"format json", `{"url": "http://foo.com/", "format": "json"}`, "", request.FormatJSON, http.StatusOK, false},
+		{"accept json", `{"url": "http://foo.com/"}`, "text/html;q=0.9, application/json", request.FormatJSON, http.StatusOK, false},
+		{"explicit format", `{"url": "http://foo.com/", "format": "html"}`, "application/json", request.FormatHTML, http.StatusNotFound, true},
+		{"format meta", `{"url": "http://foo.com/", "format": "meta"}`, "application/json", request.FormatMeta, http.StatusNotFound, true},
+	}
+	for _, test := range tests {
+		eb := &envelopeBrowser{}
+		handler, err := New(eb, AsPostHandler)
+		if err != nil {
+			t.Fatalf("can't initialize proxy handler %v", err)
+		}
+		req := httptest.NewRequest("POST", "/", strings.NewReader(test.payload))
+		req.Header.Set("Content-Type", "application/json")
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if eb.payload.Format != test.expectFormat {
+			t.Errorf("[%s] expected format %q, got %q", test.name, test.expectFormat, eb.payload.Format)
+		}
+		if w.Code != test.expectStatus {
+			t.Errorf("[%s] expected status %d, got %d", test.name, test.expectStatus, w.Code)
+		}
+		if (w.Header().Get("X-Upstream") != "") != test.expectUpstream {
+			t.Errorf("[%s] expected target headers copied: %t", test.name, test.expectUpstream)
+		}
+	}
+}
+
+func TestEnvelopeSchemaEndpoint(t *testing.T) {
+	handler, err := Service(&mockBrowser{})
+	if err != nil {
+		t.Fatalf("Service() error: %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/schemas/envelope.json", nil))
+	if w.Code != http.StatusOK || w.Body.String() != string(request.EnvelopeSchema) {
+		t.Errorf("expected the envelope schema, got %d", w.Code)
+	}
+}
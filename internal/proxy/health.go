@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/efixler/headless"
+)
+
+const (
+	ReadyTimeout = 5 * time.Second
+	// How long a readiness check's result is reused, so that frequent (or
+	// unauthenticated) probes don't each take a tab
+	ReadyCacheTTL = 2 * time.Second
+)
+
+// ReadinessChecker is implemented by tab factories that can report whether
+// they're able to take a request right now, like browser.Chrome.
+type ReadinessChecker interface {
+	Ready(ctx context.Context) error
+}
+
+// Mount GET /healthz, which succeeds as long as the process is serving, and
+// GET /readyz, which succeeds when the tab factory is ready to take requests.
+// Tab factories that don't implement ReadinessChecker are always ready. The
+// readiness result is reused for ReadyCacheTTL, and probes that arrive during
+// a check wait for its result.
+func MountHealth(mux *http.ServeMux, c headless.TabFactory) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	rc, ok := c.(ReadinessChecker)
+	if !ok {
+		mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprintln(w, "ok")
+		})
+		return
+	}
+	readiness := &readiness{checker: rc}
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, req *http.Request) {
+		if err := readiness.check(); err != nil {
+			http.Error(w, fmt.Sprintf("not ready: %s", err), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// readiness keeps the result of the last readiness check.
+type readiness struct {
+	checker ReadinessChecker
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// Run the check, unless the last one is recent enough to reuse. The check
+// isn't tied to any one probe, since its result is shared.
+func (r *readiness) check() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.checked.IsZero() && (time.Since(r.checked) < ReadyCacheTTL) {
+		return r.err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ReadyTimeout)
+	defer cancel()
+	r.err = r.checker.Ready(ctx)
+	r.checked = time.Now()
+	if r.err != nil {
+		slog.Warn("headless not ready", "err", r.err)
+	}
+	return r.err
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/efixler/headless"
+)
+
+type readyBrowser struct {
+	mockBrowser
+	err    error
+	checks int
+}
+
+func (b *readyBrowser) Ready(ctx context.Context) error {
+	b.checks++
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("expected a deadline")
+	}
+	return b.err
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	ready := &readyBrowser{}
+	notReady := &readyBrowser{err: errors.New("no free tabs")}
+	tests := []struct {
+		name    string
+		factory headless.TabFactory
+		path    string
+		status  int
+	}{
+		{"healthz", ready, "/healthz", http.StatusOK},
+		{"healthz when not ready", notReady, "/healthz", http.StatusOK},
+		{"readyz", ready, "/readyz", http.StatusOK},
+		{"readyz when not ready", notReady, "/readyz", http.StatusServiceUnavailable},
+		{"readyz without checker", &mockBrowser{}, "/readyz", http.StatusOK},
+	}
+	for _, test := range tests {
+		mux := http.NewServeMux()
+		MountHealth(mux, test.factory)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("[%s] expected %d, got %d: %s", test.name, test.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestReadyzReusesResult(t *testing.T) {
+	b := &readyBrowser{}
+	mux := http.NewServeMux()
+	MountHealth(mux, b)
+	for range 3 {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", w.Code)
+		}
+	}
+	if b.checks != 1 {
+		t.Errorf("expected 1 readiness check, got %d", b.checks)
+	}
+}
+
+func TestServiceMountsHealth(t *testing.T) {
+	auth, _ := NewBearerAuth("key")
+	handler, err := Service(&readyBrowser{}, WithAuthenticator(auth))
+	if err != nil {
+		t.Fatalf("Service() error: %v", err)
+	}
+	// health checks don't need credentials
+	for _, path := range []string{"/healthz", "/readyz"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("[%s] expected 200, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/efixler/headless"
+	"github.com/efixler/headless/browser"
+	"github.com/efixler/headless/request"
+)
+
+const (
+	DefaultJobRetention = time.Hour
+	// Finished jobs beyond these limits are dropped, oldest first, before
+	// their retention is up.
+	DefaultMaxFinishedJobs  = 1000
+	DefaultMaxFinishedBytes = 256 << 20
+	// Callback request header holding the hex HMAC-SHA256 of the timestamp
+	// header, a period, and the request body, prefixed with "sha256=".
+	CallbackSignatureHeader = "X-Headless-Signature"
+	// Callback request header holding the Unix time the callback was signed.
+	CallbackTimestampHeader = "X-Headless-Timestamp"
+	CallbackJobIDHeader     = "X-Headless-Job-ID"
+	callbackTimeout         = 30 * time.Second
+	callbackAttempts        = 3
+	callbackRetryDelay      = 5 * time.Second
+	// How long a job keeps trying to get a tab before it fails
+	jobTabWait    = 5 * time.Minute
+	tabRetryDelay = time.Second
+	// How often to look for finished jobs past their retention
+	maxExpireInterval = time.Minute
+)
+
+var (
+	ErrQueueFull         = errors.New("job queue is full")
+	ErrCallbacksDisabled = errors.New("callback_url requires a callback signing key")
+)
+
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// Job is a render request run in the background, and its result once it's
+// finished.
+type Job struct {
+	ID       string     `json:"id"`
+	Status   JobStatus  `json:"status"`
+	URL      string     `json:"url"`
+	Created  time.Time  `json:"created_at"`
+	Started  *time.Time `json:"started_at,omitempty"`
+	Finished *time.Time `json:"finished_at,omitempty"`
+	// Why a failed job failed. Its Result holds the status code only.
+	Error  string     `json:"error,omitempty"`
+	Result *JobResult `json:"result,omitempty"`
+	// set when the job is created; the payload is dropped when it's done
+	payload     *request.Payload
+	callbackURL string
+	// the browser.SessionOwner of the request that submitted the job
+	owner string
+}
+
+// JobResult is the response the service would have sent for the request.
+type JobResult struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	// "base64" when the body isn't UTF-8 text, like screenshots and PDFs.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type JobOptions struct {
+	// Maximum number of jobs waiting to run, which is also the number of
+	// jobs that run at once. Use the browser's MaxTabs.
+	Capacity int
+	// How long finished jobs can be fetched. Defaults to DefaultJobRetention.
+	Retention time.Duration
+	// The most finished jobs to keep, and the most result body bytes to keep
+	// for them; the oldest are dropped first. Default to DefaultMaxFinishedJobs
+	// and DefaultMaxFinishedBytes.
+	MaxFinished      int
+	MaxFinishedBytes int64
+	// Key for signing callbacks. Jobs with a callback_url are rejected
+	// without one.
+	SigningKey []byte
+	// Checks callback URLs when jobs are submitted and again before the
+	// callback is sent, e.g. URLPolicy.Check.
+	CheckCallback URLCheck
+	// Dials callback connections, e.g. URLPolicy.DialContext, which checks
+	// the address that's connected to rather than a separate lookup.
+	DialCallback func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// URLCheck returns an error if the URL shouldn't be requested.
+type URLCheck func(ctx context.Context, url string) error
+
+// JobQueue runs render requests in the background so that clients don't have
+// to hold a connection open while long pages render. Jobs are kept in memory.
+type JobQueue struct {
+	factory headless.TabFactory
+	options JobOptions
+	queue   chan *Job
+	client  *http.Client
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	// finished jobs, in the order they finished
+	finished      []*Job
+	finishedBytes int64
+}
+
+// Start a job queue whose workers run until ctx is done.
+func NewJobQueue(ctx context.Context, factory headless.TabFactory, options JobOptions) (*JobQueue, error) {
+	if options.Capacity <= 0 {
+		return nil, errors.New("job queue capacity must be positive")
+	}
+	if options.Retention <= 0 {
+		options.Retention = DefaultJobRetention
+	}
+	if options.MaxFinished <= 0 {
+		options.MaxFinished = DefaultMaxFinishedJobs
+	}
+	if options.MaxFinishedBytes <= 0 {
+		options.MaxFinishedBytes = DefaultMaxFinishedBytes
+	}
+	q := &JobQueue{
+		factory: factory,
+		options: options,
+		queue:   make(chan *Job, options.Capacity),
+		jobs:    make(map[string]*Job),
+		client: &http.Client{
+			Timeout: callbackTimeout,
+			// a redirect could lead anywhere; callbacks have to land where they're checked
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+	if options.DialCallback != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		// a proxy would be dialed instead of the callback's host
+		transport.Proxy = nil
+		transport.DialContext = options.DialCallback
+		q.client.Transport = transport
+	}
+	for range options.Capacity {
+		go q.work(ctx)
+	}
+	go q.expireEvery(ctx, min(options.Retention, maxExpireInterval))
+	return q, nil
+}
+
+// Queue the payload, returning ErrQueueFull when there's no room for it.
+func (q *JobQueue) Submit(ctx context.Context, payload *request.Payload) (Job, error) {
+	if payload.CallbackURL != "" {
+		if len(q.options.SigningKey) == 0 {
+			return Job{}, ErrCallbacksDisabled
+		}
+		if q.options.CheckCallback != nil {
+			if err := q.options.CheckCallback(ctx, payload.CallbackURL); err != nil {
+				return Job{}, fmt.Errorf("callback_url: %w", err)
+			}
+		}
+	}
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{
+		ID:          id,
+		Status:      JobQueued,
+		URL:         payload.URL,
+		Created:     time.Now(),
+		payload:     payload,
+		callbackURL: payload.CallbackURL,
+		owner:       browser.SessionOwner(ctx),
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.queue <- job:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	q.jobs[id] = job
+	return *job, nil
+}
+
+// Returns a copy of the job, or false if it doesn't exist or has expired.
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+func (q *JobQueue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-q.queue:
+			q.run(ctx, job)
+		}
+	}
+}
+
+func (q *JobQueue) run(ctx context.Context, job *Job) {
+	q.mu.Lock()
+	started := time.Now()
+	job.Status = JobRunning
+	job.Started = &started
+	payload := job.payload
+	q.mu.Unlock()
+
+	result, err := q.fetch(browser.WithSessionOwner(ctx, job.owner), payload)
+
+	q.mu.Lock()
+	finished := time.Now()
+	job.Finished = &finished
+	job.payload = nil
+	if err != nil {
+		status, msg := fetchError(err)
+		job.Status = JobFailed
+		job.Error = msg
+		if result == nil {
+			result = &JobResult{}
+		}
+		// keep what was captured before the failure, like a partial HAR
+		result.StatusCode = status
+		job.Result = result
+		slog.Info("headless job failed", "id", job.ID, "url", job.URL, "err", err)
+	} else {
+		job.Status = JobDone
+		job.Result = result
+	}
+	q.keepFinished(job)
+	done := *job
+	q.mu.Unlock()
+
+	if (done.callbackURL != "") && (ctx.Err() == nil) {
+		q.callback(ctx, done)
+	}
+}
+
+// Render the payload, waiting for a tab for up to jobTabWait. The result can
+// come back along with the error, with what was captured before the failure.
+func (q *JobQueue) fetch(ctx context.Context, payload *request.Payload) (*JobResult, error) {
+	deadline := time.Now().Add(jobTabWait)
+	var target headless.Browser
+	for {
+		var err error
+		if target, err = q.factory.AcquireTab(); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, &headless.HTTPError{StatusCode: http.StatusServiceUnavailable, Message: err.Error()}
+		}
+		slog.Debug("headless job waiting for a tab", "url", payload.URL, "err", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(tabRetryDelay):
+		}
+	}
+	resp, fetchErr := headless.AsFetcher(target).FetchContext(ctx, payload)
+	if (fetchErr != nil) && !hasBody(resp) {
+		return nil, fetchErr
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Join(fetchErr, err)
+	}
+	result := &JobResult{StatusCode: resp.StatusCode, Header: resp.Header}
+	if utf8.Valid(body) {
+		result.Body = string(body)
+	} else {
+		result.Body = base64.StdEncoding.EncodeToString(body)
+		result.Encoding = "base64"
+	}
+	return result, fetchErr
+}
+
+// Post the finished job to its callback URL, retrying on failure.
+func (q *JobQueue) callback(ctx context.Context, job Job) {
+	if q.options.CheckCallback != nil {
+		if err := q.options.CheckCallback(ctx, job.callbackURL); err != nil {
+			slog.Warn("headless job callback not allowed", "id", job.ID, "err", err)
+			return
+		}
+	}
+	body, err := json.Marshal(job)
+	if err != nil {
+		slog.Error("Error encoding job for callback", "id", job.ID, "err", err)
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		err := q.postCallback(ctx, job, body)
+		if err == nil {
+			return
+		}
+		slog.Warn("headless job callback failed", "id", job.ID, "attempt", attempt, "err", err)
+		if attempt == callbackAttempts {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(attempt) * callbackRetryDelay):
+		}
+	}
+}
+
+func (q *JobQueue) postCallback(ctx context.Context, job Job, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(CallbackJobIDHeader, job.ID)
+	req.Header.Set(CallbackTimestampHeader, timestamp)
+	req.Header.Set(CallbackSignatureHeader, "sha256="+SignCallback(q.options.SigningKey, timestamp, body))
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if (resp.StatusCode < 200) || (resp.StatusCode > 299) {
+		return fmt.Errorf("callback returned %s", resp.Status)
+	}
+	return nil
+}
+
+// The hex HMAC-SHA256 of the timestamp, a period, and the body, as sent
+// in the CallbackSignatureHeader (after "sha256=").
+func SignCallback(key []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (q *JobQueue) expireEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			q.expire(now)
+		}
+	}
+}
+
+// Drop jobs that finished more than the retention period before now.
+func (q *JobQueue) expire(now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for (len(q.finished) > 0) && (now.Sub(*q.finished[0].Finished) > q.options.Retention) {
+		q.dropOldest()
+	}
+}
+
+// Add the job to the finished jobs, dropping the oldest ones while there are
+// too many or their bodies are too big. Call with q.mu held.
+func (q *JobQueue) keepFinished(job *Job) {
+	q.finished = append(q.finished, job)
+	q.finishedBytes += job.size()
+	for (len(q.finished) > q.options.MaxFinished) || (q.finishedBytes > q.options.MaxFinishedBytes) {
+		q.dropOldest()
+	}
+}
+
+func (q *JobQueue) dropOldest() {
+	job := q.finished[0]
+	q.finished[0] = nil
+	q.finished = q.finished[1:]
+	q.finishedBytes -= job.size()
+	delete(q.jobs, job.ID)
+}
+
+// The bytes held by the job's result body.
+func (j *Job) size() int64 {
+	if j.Result == nil {
+		return 0
+	}
+	return int64(len(j.Result.Body))
+}
+
+// Mount POST /jobs, which queues a job and responds with 202 Accepted and
+// the job, and GET /jobs/{id}, which returns the job to the caller that
+// submitted it; it's not found for anyone else.
+func (q *JobQueue) mount(mux *http.ServeMux, conf *config) {
+	mux.Handle("POST /jobs", requireAuth(conf.auth, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		payload, err := parsePostPayload(req)
+		if (err == nil) && (conf.policy != nil) {
+			err = conf.policy.Check(req.Context(), payload.URL)
+		}
+		var job Job
+		if err == nil {
+			job, err = q.Submit(req.Context(), payload)
+		}
+		if err != nil {
+			status := http.StatusBadRequest
+			switch {
+			case errors.Is(err, ErrForbiddenURL):
+				status = http.StatusForbidden
+				slog.Info("headless job URL not allowed", "remote", req.RemoteAddr, "err", err)
+			case errors.Is(err, ErrQueueFull):
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+	})))
+	mux.Handle("GET /jobs/{id}", requireAuth(conf.auth, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		job, ok := q.Get(req.PathValue("id"))
+		if !ok || (job.owner != browser.SessionOwner(req.Context())) {
+			http.NotFound(w, req)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error writing JSON response", "err", err)
+	}
+}
+
+func newJobID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,352 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efixler/headless"
+	"github.com/efixler/headless/request"
+)
+
+func newTestJobs(t *testing.T, tf headless.TabFactory, options JobOptions) (*JobQueue, http.Handler) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if options.Capacity == 0 {
+		options.Capacity = 1
+	}
+	q, err := NewJobQueue(ctx, tf, options)
+	if err != nil {
+		t.Fatalf("NewJobQueue() error: %v", err)
+	}
+	handler, err := Service(tf, WithJobs(q))
+	if err != nil {
+		t.Fatalf("Service() error: %v", err)
+	}
+	return q, handler
+}
+
+func submitJob(t *testing.T, handler http.Handler, payload string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/jobs", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// Poll GET /jobs/{id} until the job is finished.
+func waitForJob(t *testing.T, handler http.Handler, id string) Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/jobs/"+id, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200 for job %s, got %d", id, w.Code)
+		}
+		var job Job
+		if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+			t.Fatalf("can't decode job: %v", err)
+		}
+		if (job.Status == JobDone) || (job.Status == JobFailed) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s not finished, status %s", id, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	_, handler := newTestJobs(t, &mockBrowser{}, JobOptions{})
+	w := submitJob(t, handler, `{"url": "http://foo.com/"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body)
+	}
+	var submitted Job
+	if err := json.Unmarshal(w.Body.Bytes(), &submitted); err != nil {
+		t.Fatalf("can't decode job: %v", err)
+	}
+	if w.Header().Get("Location") != "/jobs/"+submitted.ID {
+		t.Errorf("expected Location /jobs/%s, got %q", submitted.ID, w.Header().Get("Location"))
+	}
+	job := waitForJob(t, handler, submitted.ID)
+	if job.Status != JobDone {
+		t.Fatalf("expected status %s, got %s (%s)", JobDone, job.Status, job.Error)
+	}
+	if job.Started == nil || job.Finished == nil {
+		t.Errorf("expected start and finish times, got %v and %v", job.Started, job.Finished)
+	}
+	if job.Result.StatusCode != http.StatusOK {
+		t.Errorf("expected result status 200, got %d", job.Result.StatusCode)
+	}
+	if !strings.Contains(job.Result.Body, "<title>http://foo.com/</title>") || job.Result.Encoding != "" {
+		t.Errorf("unexpected result body %q (encoding %q)", job.Result.Body, job.Result.Encoding)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/jobs/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown job, got %d", w.Code)
+	}
+}
+
+func TestJobFailure(t *testing.T) {
+	tf := &mockBrowser{err: &headless.HTTPError{StatusCode: http.StatusTeapot}}
+	_, handler := newTestJobs(t, tf, JobOptions{})
+	w := submitJob(t, handler, `{"url": "http://foo.com/"}`)
+	var submitted Job
+	json.Unmarshal(w.Body.Bytes(), &submitted)
+	job := waitForJob(t, handler, submitted.ID)
+	if job.Status != JobFailed {
+		t.Fatalf("expected status %s, got %s", JobFailed, job.Status)
+	}
+	if job.Result.StatusCode != http.StatusTeapot || job.Error == "" {
+		t.Errorf("expected result status 418 and an error, got %d and %q", job.Result.StatusCode, job.Error)
+	}
+}
+
+// blockingTabs hands out tabs that don't finish until release is closed.
+type blockingTabs struct {
+	mockBrowser
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingTabs) AcquireTab() (headless.Browser, error) {
+	return b, nil
+}
+
+func (b *blockingTabs) FetchContext(ctx context.Context, payload *request.Payload) (*http.Response, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return b.mockBrowser.Fetch(payload)
+}
+
+func TestJobQueueFull(t *testing.T) {
+	tf := &blockingTabs{started: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(tf.release)
+	_, handler := newTestJobs(t, tf, JobOptions{Capacity: 1})
+	if w := submitJob(t, handler, `{"url": "http://foo.com/1"}`); w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", w.Code)
+	}
+	// the first job is running, so the second fills the queue
+	<-tf.started
+	if w := submitJob(t, handler, `{"url": "http://foo.com/2"}`); w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", w.Code)
+	}
+	if w := submitJob(t, handler, `{"url": "http://foo.com/3"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 with the queue full, got %d", w.Code)
+	}
+}
+
+func TestJobCallback(t *testing.T) {
+	key := []byte("secret")
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		received <- req
+		bodies <- body
+	}))
+	defer callbackServer.Close()
+	_, handler := newTestJobs(t, &mockBrowser{}, JobOptions{SigningKey: key})
+
+	w := submitJob(t, handler, `{"url": "http://foo.com/", "callback_url": "`+callbackServer.URL+`/done"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body)
+	}
+	var submitted Job
+	json.Unmarshal(w.Body.Bytes(), &submitted)
+
+	var req *http.Request
+	select {
+	case req = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback not received")
+	}
+	body := <-bodies
+	if req.URL.Path != "/done" {
+		t.Errorf("expected callback to /done, got %s", req.URL.Path)
+	}
+	if req.Header.Get(CallbackJobIDHeader) != submitted.ID {
+		t.Errorf("expected job ID %s, got %q", submitted.ID, req.Header.Get(CallbackJobIDHeader))
+	}
+	expected := "sha256=" + SignCallback(key, req.Header.Get(CallbackTimestampHeader), body)
+	if req.Header.Get(CallbackSignatureHeader) != expected {
+		t.Errorf("expected signature %s, got %q", expected, req.Header.Get(CallbackSignatureHeader))
+	}
+	var job Job
+	if err := json.Unmarshal(body, &job); err != nil {
+		t.Fatalf("can't decode callback body: %v", err)
+	}
+	if job.ID != submitted.ID || job.Status != JobDone || job.Result == nil {
+		t.Errorf("unexpected callback job %+v", job)
+	}
+}
+
+func TestJobCallbackRejected(t *testing.T) {
+	forbid := func(ctx context.Context, url string) error {
+		return ErrForbiddenURL
+	}
+	tests := []struct {
+		name         string
+		options      JobOptions
+		expectStatus int
+	}{
+		{"no signing key", JobOptions{}, http.StatusBadRequest},
+		{"not allowed", JobOptions{SigningKey: []byte("secret"), CheckCallback: forbid}, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		_, handler := newTestJobs(t, &mockBrowser{}, test.options)
+		w := submitJob(t, handler, `{"url": "http://foo.com/", "callback_url": "http://hooks.example.com/"}`)
+		if w.Code != test.expectStatus {
+			t.Errorf("[%s] expected status %d, got %d", test.name, test.expectStatus, w.Code)
+		}
+	}
+}
+
+func TestCallbackURLOnlyForJobs(t *testing.T) {
+	handler, err := New(&mockBrowser{}, AsPostHandler)
+	if err != nil {
+		t.Fatalf("can't initialize proxy handler %v", err)
+	}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"url": "http://foo.com/", "callback_url": "http://hooks.example.com/"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestJobExpiry(t *testing.T) {
+	q, handler := newTestJobs(t, &mockBrowser{}, JobOptions{Retention: time.Minute})
+	w := submitJob(t, handler, `{"url": "http://foo.com/"}`)
+	var submitted Job
+	json.Unmarshal(w.Body.Bytes(), &submitted)
+	job := waitForJob(t, handler, submitted.ID)
+
+	q.expire(job.Finished.Add(30 * time.Second))
+	if _, ok := q.Get(job.ID); !ok {
+		t.Fatal("job expired before its retention period")
+	}
+	q.expire(job.Finished.Add(2 * time.Minute))
+	if _, ok := q.Get(job.ID); ok {
+		t.Error("expected job to expire after its retention period")
+	}
+}
+
+func TestNewJobQueueCapacity(t *testing.T) {
+	_, err := NewJobQueue(context.Background(), &mockBrowser{}, JobOptions{})
+	if err == nil {
+		t.Error("expected an error for a queue without capacity")
+	}
+}
+
+func TestJobFinishedLimits(t *testing.T) {
+	q := &JobQueue{
+		jobs:    make(map[string]*Job),
+		options: JobOptions{Retention: time.Minute, MaxFinished: 3, MaxFinishedBytes: 10},
+	}
+	finish := func(id, body string) {
+		now := time.Now()
+		job := &Job{ID: id, Finished: &now, Result: &JobResult{Body: body}}
+		q.jobs[id] = job
+		q.keepFinished(job)
+	}
+	tests := []struct {
+		name string
+		id   string
+		body string
+		kept []string
+		gone []string
+	}{
+		{"under limits", "a", "1234", []string{"a"}, nil},
+		{"still under", "b", "1234", []string{"a", "b"}, nil},
+		{"over bytes", "c", "1234", []string{"b", "c"}, []string{"a"}},
+		{"no body", "d", "", []string{"b", "c", "d"}, nil},
+		{"over count", "e", "", []string{"c", "d", "e"}, []string{"b"}},
+		{"too big to keep", "f", "12345678901", nil, []string{"c", "d", "e", "f"}},
+	}
+	for _, test := range tests {
+		finish(test.id, test.body)
+		for _, id := range test.kept {
+			if _, ok := q.Get(id); !ok {
+				t.Errorf("[%s] expected job %s to be kept", test.name, id)
+			}
+		}
+		for _, id := range test.gone {
+			if _, ok := q.Get(id); ok {
+				t.Errorf("[%s] expected job %s to be dropped", test.name, id)
+			}
+		}
+	}
+	if q.finishedBytes != 0 || len(q.finished) != 0 {
+		t.Errorf("expected nothing kept, got %d jobs and %d bytes", len(q.finished), q.finishedBytes)
+	}
+}
+
+func TestJobCallbackDialer(t *testing.T) {
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Error("callback to a private address shouldn't be sent")
+	}))
+	defer callbackServer.Close()
+	q, _ := newTestJobs(t, &mockBrowser{}, JobOptions{
+		SigningKey:   []byte("secret"),
+		DialCallback: testPolicy().DialContext,
+	})
+	err := q.postCallback(context.Background(), Job{ID: "1", callbackURL: callbackServer.URL}, []byte("{}"))
+	if !errors.Is(err, ErrForbiddenURL) {
+		t.Errorf("expected ErrForbiddenURL, got %v", err)
+	}
+}
+
+func TestJobOwners(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	tf := &mockBrowser{}
+	q, err := NewJobQueue(ctx, tf, JobOptions{Capacity: 1})
+	if err != nil {
+		t.Fatalf("NewJobQueue() error: %v", err)
+	}
+	auth, _ := NewBearerAuth("first-key", "second-key")
+	handler, err := Service(tf, WithJobs(q), WithAuthenticator(auth))
+	if err != nil {
+		t.Fatalf("Service() error: %v", err)
+	}
+	req := httptest.NewRequest("POST", "/jobs", strings.NewReader(`{"url": "http://foo.com/"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer first-key")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body)
+	}
+	var job Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("can't decode job: %v", err)
+	}
+	tests := []struct {
+		key          string
+		expectStatus int
+	}{
+		{"first-key", http.StatusOK},
+		{"second-key", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/jobs/"+job.ID, nil)
+		req.Header.Set("Authorization", "Bearer "+test.key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != test.expectStatus {
+			t.Errorf("[%s] expected status %d, got %d", test.key, test.expectStatus, w.Code)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/efixler/headless/internal/metrics"
+)
+
+var (
+	tabWaitBuckets = []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10}
+)
+
+// Metrics records the service's request, tab and navigation metrics.
+type Metrics struct {
+	requests      *metrics.CounterVec
+	responseBytes *metrics.CounterVec
+	tabWait       *metrics.HistogramVec
+	tabRejections *metrics.CounterVec
+	navigation    *metrics.HistogramVec
+}
+
+func NewMetrics(r *metrics.Registry) *Metrics {
+	return &Metrics{
+		requests: r.NewCounterVec(
+			"headless_requests_total",
+			"Render requests handled, by mode and HTTP status code.",
+			"mode", "code",
+		),
+		responseBytes: r.NewCounterVec(
+			"headless_response_bytes_total",
+			"Response body bytes returned to clients, by mode.",
+			"mode",
+		),
+		tabWait: r.NewHistogramVec(
+			"headless_tab_wait_seconds",
+			"Time spent waiting for a browser tab.",
+			tabWaitBuckets,
+		),
+		tabRejections: r.NewCounterVec(
+			"headless_tab_rejections_total",
+			"Requests rejected because no browser tab became available.",
+		),
+		navigation: r.NewHistogramVec(
+			"headless_navigation_duration_seconds",
+			"Time to navigate to a page and wait for it to be ready, by result.",
+			metrics.DefaultDurationBuckets,
+			"result",
+		),
+	}
+}
+
+// Mount GET /metrics to serve h, requiring requests to be accepted by the
+// authenticator, if any.
+func MountMetrics(mux *http.ServeMux, h http.Handler, a Authenticator) {
+	mux.Handle("GET /metrics", requireAuth(a, h))
+}
+
+// For use with browser.ObserveNavigations
+func (m *Metrics) ObserveNavigation(d time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.navigation.Observe(d.Seconds(), result)
+}
+
+func (m *Metrics) observeTabWait(d time.Duration, err error) {
+	m.tabWait.Observe(d.Seconds())
+	if err != nil {
+		m.tabRejections.Inc()
+	}
+}
+
+func (mode handlerMode) String() string {
+	switch mode {
+	case AsProxy:
+		return "proxy"
+	case AsPostHandler:
+		return "service"
+	}
+	return "unknown"
+}
+
+// Count the requests handled by next, by status, and the bytes written.
+func (m *Metrics) instrument(mode handlerMode, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		m.requests.Inc(mode.String(), strconv.Itoa(rec.status))
+		m.responseBytes.Add(float64(rec.bytes), mode.String())
+	})
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := r.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("%T doesn't support hijacking", r.ResponseWriter)
+}
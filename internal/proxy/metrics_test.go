@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efixler/headless"
+	"github.com/efixler/headless/internal/metrics"
+)
+
+type noTabs struct{}
+
+func (noTabs) AcquireTab() (headless.Browser, error) {
+	return nil, errors.New("maximum number of tabs reached")
+}
+
+func TestMetricsInstrumentation(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := NewMetrics(registry)
+	service, err := Service(&mockBrowser{}, WithMetrics(m))
+	if err != nil {
+		t.Fatalf("Service() error: %v", err)
+	}
+	proxyHandler, err := HTTPProxy(&mockBrowser{}, WithMetrics(m))
+	if err != nil {
+		t.Fatalf("HTTPProxy() error: %v", err)
+	}
+	busy, err := HTTPProxy(noTabs{}, WithMetrics(m))
+	if err != nil {
+		t.Fatalf("HTTPProxy() error: %v", err)
+	}
+
+	post := httptest.NewRequest("POST", "/", strings.NewReader(`{"url":"http://example.com"}`))
+	post.Header.Set("Content-Type", "application/json")
+	badPost := httptest.NewRequest("POST", "/", strings.NewReader(`{"url":"http://example.com"}`))
+	requests := []struct {
+		handler http.Handler
+		req     *http.Request
+	}{
+		{service, post},
+		{service, badPost},
+		{proxyHandler, httptest.NewRequest("GET", "http://example.com/", nil)},
+		{busy, httptest.NewRequest("GET", "http://example.com/", nil)},
+	}
+	var proxyBytes int
+	for i, r := range requests {
+		w := httptest.NewRecorder()
+		r.handler.ServeHTTP(w, r.req)
+		if i >= 2 {
+			proxyBytes += w.Body.Len()
+		}
+	}
+	m.ObserveNavigation(time.Second, nil)
+	m.ObserveNavigation(time.Second, errors.New("failed"))
+
+	tests := []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{"service 200", m.requests.Value("service", "200"), 1},
+		{"service 400", m.requests.Value("service", "400"), 1},
+		{"proxy 200", m.requests.Value("proxy", "200"), 1},
+		{"proxy 503", m.requests.Value("proxy", "503"), 1},
+		{"proxy bytes", m.responseBytes.Value("proxy"), float64(proxyBytes)},
+		{"tab waits", float64(m.tabWait.Count()), 3},
+		{"tab rejections", m.tabRejections.Value(), 1},
+		{"navigations ok", float64(m.navigation.Count("ok")), 1},
+		{"navigations error", float64(m.navigation.Count("error")), 1},
+	}
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("[%s] expected %v, got %v", test.name, test.expected, test.got)
+		}
+	}
+	if proxyBytes == 0 {
+		t.Error("expected proxy response bytes")
+	}
+
+	w := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`headless_requests_total{mode="service",code="200"} 1`,
+		`headless_tab_rejections_total 1`,
+		`headless_navigation_duration_seconds_count{result="ok"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Errorf("expected metrics to contain %q", line)
+		}
+	}
+}
+
+func TestMetricsKeepHijacking(t *testing.T) {
+	var rec http.ResponseWriter = &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+	if _, ok := rec.(http.Hijacker); !ok {
+		t.Fatal("responseRecorder should implement http.Hijacker")
+	}
+	if _, _, err := rec.(http.Hijacker).Hijack(); err == nil {
+		t.Error("expected an error hijacking a writer that can't be hijacked")
+	}
+}
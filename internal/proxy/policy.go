@@ -0,0 +1,291 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	nurl "net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultMaxURLLength = 8192
+	// How long URLPolicy keeps a host's resolved addresses
+	dnsCacheTTL = 30 * time.Second
+	// The cache is cleared when it gets this big
+	maxDNSCacheEntries = 4096
+	dialTimeout        = 30 * time.Second
+)
+
+var (
+	ErrForbiddenURL = errors.New("URL not allowed")
+	// Address ranges that aren't covered by the net.IP predicates used in isPrivate
+	privateNets = []*net.IPNet{
+		mustParseCIDR("0.0.0.0/8"),     // "this" network
+		mustParseCIDR("100.64.0.0/10"), // carrier-grade NAT
+		mustParseCIDR("192.0.0.0/24"),  // IETF protocol assignments
+		mustParseCIDR("198.18.0.0/15"), // benchmarking
+	}
+	// Schemes that don't reach the network; allowed for sub-resources inside the browser.
+	localSchemes = map[string]bool{"about": true, "blob": true, "data": true}
+)
+
+type resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// URLPolicy decides which URLs the service will render. Hosts are matched
+// case-insensitively; a pattern like "*.example.com" matches any subdomain
+// of example.com, but not example.com itself.
+//
+// Check resolves hosts to check their addresses, but whoever makes the
+// request resolves them again, and the answer can change in between. Dial
+// with DialContext (as EgressProxy does) to check the address that's actually
+// connected to.
+type URLPolicy struct {
+	// Allowed URL schemes
+	Schemes []string
+	// When not empty, only matching hosts are allowed
+	AllowHosts []string
+	// Matching hosts are never allowed
+	DenyHosts []string
+	// Allow hosts that are, or resolve to, loopback, private, link-local
+	// or otherwise non-public addresses
+	AllowPrivate bool
+	// Zero means no limit
+	MaxURLLength int
+	// Ports the browser can open CONNECT tunnels to through EgressProxy
+	ConnectPorts []string
+	resolver     resolver
+}
+
+// A policy that allows public http and https URLs up to DefaultMaxURLLength,
+// and CONNECT tunnels to port 443.
+func NewURLPolicy() *URLPolicy {
+	return &URLPolicy{
+		Schemes:      []string{"http", "https"},
+		MaxURLLength: DefaultMaxURLLength,
+		ConnectPorts: []string{"443"},
+		resolver:     newCachingResolver(net.DefaultResolver, dnsCacheTTL),
+	}
+}
+
+// Returns an error wrapping ErrForbiddenURL if the policy doesn't allow the URL.
+func (p *URLPolicy) Check(ctx context.Context, rawURL string) error {
+	if p.MaxURLLength > 0 && len(rawURL) > p.MaxURLLength {
+		return fmt.Errorf("%w: longer than %d characters", ErrForbiddenURL, p.MaxURLLength)
+	}
+	u, err := nurl.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrForbiddenURL, err)
+	}
+	if !p.allowsScheme(u.Scheme) {
+		return fmt.Errorf("%w: scheme %q", ErrForbiddenURL, u.Scheme)
+	}
+	host := normalizeHost(u.Hostname())
+	if err := p.checkHost(host); err != nil {
+		return err
+	}
+	if p.AllowPrivate {
+		return nil
+	}
+	return p.checkAddresses(ctx, host)
+}
+
+// Dials address, a host and port, if the policy allows the host and the
+// address connected to is public (unless AllowPrivate is set). The check is
+// made on the address being dialed, after the host is resolved, so it can't
+// be got around by a host that resolves differently the second time.
+func (p *URLPolicy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrForbiddenURL, err)
+	}
+	if err := p.checkHost(normalizeHost(host)); err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if !p.AllowPrivate {
+		dialer.Control = checkDialedAddress
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// Returns an error wrapping ErrForbiddenURL unless address, a host and port,
+// is on one of the ConnectPorts.
+func (p *URLPolicy) checkConnect(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrForbiddenURL, err)
+	}
+	if !slices.Contains(p.ConnectPorts, port) {
+		return fmt.Errorf("%w: CONNECT to port %s is not allowed", ErrForbiddenURL, port)
+	}
+	return nil
+}
+
+func (p *URLPolicy) checkHost(host string) error {
+	if host == "" {
+		return fmt.Errorf("%w: no host", ErrForbiddenURL)
+	}
+	if matchHost(p.DenyHosts, host) {
+		return fmt.Errorf("%w: host %q is denied", ErrForbiddenURL, host)
+	}
+	if len(p.AllowHosts) > 0 && !matchHost(p.AllowHosts, host) {
+		return fmt.Errorf("%w: host %q is not allowed", ErrForbiddenURL, host)
+	}
+	return nil
+}
+
+// net.Dialer.Control for DialContext; address is the resolved IP and port.
+func checkDialedAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrForbiddenURL, err)
+	}
+	ip := net.ParseIP(host)
+	if (ip == nil) || isPrivate(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrForbiddenURL, host)
+	}
+	return nil
+}
+
+// Like Check, but for requests made by the browser while rendering a page,
+// which can also use schemes that don't reach the network.
+func (p *URLPolicy) CheckBrowserRequest(ctx context.Context, rawURL string) error {
+	if scheme, _, ok := strings.Cut(rawURL, ":"); ok && localSchemes[strings.ToLower(scheme)] {
+		return nil
+	}
+	return p.Check(ctx, rawURL)
+}
+
+func (p *URLPolicy) allowsScheme(scheme string) bool {
+	for _, s := range p.Schemes {
+		if strings.EqualFold(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the host's addresses, resolving it if it's not an IP address.
+// Hosts that don't exist are let through, since the browser will fail to
+// load them anyway.
+func (p *URLPolicy) checkAddresses(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if isPrivate(ip) {
+			return fmt.Errorf("%w: %s is not a public address", ErrForbiddenURL, ip)
+		}
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s is not a public host", ErrForbiddenURL, host)
+	}
+	r := p.resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	addrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil
+		}
+		return fmt.Errorf("%w: can't resolve %s: %w", ErrForbiddenURL, host, err)
+	}
+	for _, addr := range addrs {
+		if isPrivate(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to non-public address %s", ErrForbiddenURL, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// cachingResolver keeps lookups for ttl, since the browser checks every
+// sub-resource and most of them are on the same few hosts. Failed lookups
+// aren't cached.
+type cachingResolver struct {
+	resolver resolver
+	ttl      time.Duration
+	mu       sync.Mutex
+	entries  map[string]dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	addrs   []net.IPAddr
+	expires time.Time
+}
+
+func newCachingResolver(r resolver, ttl time.Duration) *cachingResolver {
+	return &cachingResolver{resolver: r, ttl: ttl, entries: make(map[string]dnsCacheEntry)}
+}
+
+func (r *cachingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	now := time.Now()
+	r.mu.Lock()
+	entry, ok := r.entries[host]
+	r.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.addrs, nil
+	}
+	addrs, err := r.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) >= maxDNSCacheEntries {
+		clear(r.entries)
+	}
+	r.entries[host] = dnsCacheEntry{addrs: addrs, expires: now.Add(r.ttl)}
+	return addrs, nil
+}
+
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func isPrivate(ip net.IP) bool {
+	if ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if pattern == host {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
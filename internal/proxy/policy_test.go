@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockResolver map[string][]string
+
+func (r mockResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func testPolicy() *URLPolicy {
+	p := NewURLPolicy()
+	p.resolver = mockResolver{
+		"example.com":          {"93.184.215.14"},
+		"www.example.com":      {"93.184.215.14", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"},
+		"internal.example.com": {"10.1.2.3"},
+		"metadata.example.com": {"169.254.169.254"},
+		"rebind.example.com":   {"93.184.215.14", "127.0.0.1"},
+	}
+	return p
+}
+
+func TestURLPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(p *URLPolicy)
+		url     string
+		allowed bool
+	}{
+		{"public http", nil, "http://example.com/", true},
+		{"public https", nil, "https://www.example.com/path?q=1", true},
+		{"unknown host", nil, "https://nowhere.example.com/", true},
+		{"file", nil, "file:///etc/passwd", false},
+		{"chrome", nil, "chrome://settings", false},
+		{"javascript", nil, "javascript:alert(1)", false},
+		{"no host", nil, "http:///path", false},
+		{"localhost", nil, "http://localhost:8080/", false},
+		{"localhost subdomain", nil, "http://app.localhost/", false},
+		{"loopback", nil, "http://127.0.0.1/", false},
+		{"loopback v6", nil, "http://[::1]/", false},
+		{"mapped loopback", nil, "http://[::ffff:127.0.0.1]/", false},
+		{"unspecified", nil, "http://0.0.0.0/", false},
+		{"metadata ip", nil, "http://169.254.169.254/latest/meta-data/", false},
+		{"private ip", nil, "http://192.168.1.1/", false},
+		{"cgnat ip", nil, "http://100.64.0.1/", false},
+		{"resolves private", nil, "http://internal.example.com/", false},
+		{"resolves link-local", nil, "http://metadata.example.com/", false},
+		{"any address private", nil, "http://rebind.example.com/", false},
+		{"public ip", nil, "http://93.184.215.14/", true},
+		{"allow private", func(p *URLPolicy) { p.AllowPrivate = true }, "http://localhost/", true},
+		{"too long", func(p *URLPolicy) { p.MaxURLLength = 30 }, "http://example.com/" + strings.Repeat("a", 20), false},
+		{"no length limit", func(p *URLPolicy) { p.MaxURLLength = 0 }, "http://example.com/" + strings.Repeat("a", 10000), true},
+		{"denied host", func(p *URLPolicy) { p.DenyHosts = []string{"example.com"} }, "http://EXAMPLE.com/", false},
+		{"denied wildcard", func(p *URLPolicy) { p.DenyHosts = []string{"*.example.com"} }, "http://www.example.com/", false},
+		{"wildcard excludes apex", func(p *URLPolicy) { p.DenyHosts = []string{"*.example.com"} }, "http://example.com/", true},
+		{"allowed host", func(p *URLPolicy) { p.AllowHosts = []string{"*.example.com"} }, "http://www.example.com/", true},
+		{"not allowed host", func(p *URLPolicy) { p.AllowHosts = []string{"*.example.com"} }, "http://example.org/", false},
+		{"deny wins", func(p *URLPolicy) {
+			p.AllowHosts = []string{"*.example.com"}
+			p.DenyHosts = []string{"www.example.com"}
+		}, "http://www.example.com/", false},
+		{"trailing dot", func(p *URLPolicy) { p.DenyHosts = []string{"example.com"} }, "http://example.com./", false},
+		{"ftp allowed", func(p *URLPolicy) { p.Schemes = append(p.Schemes, "ftp") }, "ftp://example.com/", true},
+	}
+	for _, test := range tests {
+		p := testPolicy()
+		if test.modify != nil {
+			test.modify(p)
+		}
+		err := p.Check(context.Background(), test.url)
+		if test.allowed && err != nil {
+			t.Errorf("[%s] expected %s to be allowed, got %v", test.name, test.url, err)
+		} else if !test.allowed && !errors.Is(err, ErrForbiddenURL) {
+			t.Errorf("[%s] expected %s to be forbidden, got %v", test.name, test.url, err)
+		}
+	}
+}
+
+func TestURLPolicyCheckBrowserRequest(t *testing.T) {
+	p := testPolicy()
+	for _, url := range []string{"data:image/png;base64,AAAA", "blob:https://example.com/1234", "about:blank"} {
+		if err := p.CheckBrowserRequest(context.Background(), url); err != nil {
+			t.Errorf("expected %s to be allowed, got %v", url, err)
+		}
+		if err := p.Check(context.Background(), url); err == nil {
+			t.Errorf("expected %s to be forbidden as a page", url)
+		}
+	}
+	if err := p.CheckBrowserRequest(context.Background(), "http://127.0.0.1/"); !errors.Is(err, ErrForbiddenURL) {
+		t.Errorf("expected loopback to be forbidden, got %v", err)
+	}
+}
+
+func TestURLPolicyRejectsPayloads(t *testing.T) {
+	tf := &mockBrowser{}
+	policy := testPolicy()
+	service, err := Service(tf, WithURLPolicy(policy))
+	if err != nil {
+		t.Fatalf("Service() error: %v", err)
+	}
+	proxyHandler, err := HTTPProxy(tf, WithURLPolicy(policy))
+	if err != nil {
+		t.Fatalf("HTTPProxy() error: %v", err)
+	}
+	post := func(body string) *http.Request {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+	tests := []struct {
+		name    string
+		handler http.Handler
+		req     *http.Request
+		status  int
+	}{
+		{"service allowed", service, post(`{"url":"https://example.com/"}`), http.StatusOK},
+		{"service file", service, post(`{"url":"file:///etc/passwd"}`), http.StatusForbidden},
+		{"service metadata", service, post(`{"url":"http://169.254.169.254/"}`), http.StatusForbidden},
+		{"proxy allowed", proxyHandler, httptest.NewRequest("GET", "http://example.com/", nil), http.StatusOK},
+		{"proxy localhost", proxyHandler, httptest.NewRequest("GET", "http://localhost:9222/json", nil), http.StatusForbidden},
+	}
+	for _, test := range tests {
+		tf.url = ""
+		w := httptest.NewRecorder()
+		test.handler.ServeHTTP(w, test.req)
+		if w.Code != test.status {
+			t.Errorf("[%s] expected %d, got %d: %s", test.name, test.status, w.Code, w.Body.String())
+		}
+		if (test.status == http.StatusForbidden) && (tf.url != "") {
+			t.Errorf("[%s] browser shouldn't be called, got url %q", test.name, tf.url)
+		}
+	}
+}
+
+type countingResolver struct {
+	mockResolver
+	lookups int
+}
+
+func (r *countingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lookups++
+	return r.mockResolver.LookupIPAddr(ctx, host)
+}
+
+func TestCachingResolver(t *testing.T) {
+	r := &countingResolver{mockResolver: mockResolver{"example.com": {"93.184.215.14"}}}
+	cache := newCachingResolver(r, time.Hour)
+	for range 3 {
+		if addrs, err := cache.LookupIPAddr(context.Background(), "example.com"); err != nil || len(addrs) != 1 {
+			t.Fatalf("expected one address, got %v, %v", addrs, err)
+		}
+	}
+	if r.lookups != 1 {
+		t.Errorf("expected 1 lookup, got %d", r.lookups)
+	}
+	cache.LookupIPAddr(context.Background(), "nowhere.example.com")
+	cache.LookupIPAddr(context.Background(), "nowhere.example.com")
+	if r.lookups != 3 {
+		t.Errorf("expected failed lookups not to be cached, got %d lookups", r.lookups)
+	}
+	expired := newCachingResolver(r, -time.Second)
+	expired.LookupIPAddr(context.Background(), "example.com")
+	expired.LookupIPAddr(context.Background(), "example.com")
+	if r.lookups != 5 {
+		t.Errorf("expected expired entries to be looked up again, got %d lookups", r.lookups)
+	}
+}
+
+func TestURLPolicyDialContext(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	tests := []struct {
+		name    string
+		modify  func(p *URLPolicy)
+		address string
+		allowed bool
+	}{
+		{"loopback", nil, server.Listener.Addr().String(), false},
+		{"localhost", nil, net.JoinHostPort("localhost", port), false},
+		{"allow private", func(p *URLPolicy) { p.AllowPrivate = true }, server.Listener.Addr().String(), true},
+		{"denied host", func(p *URLPolicy) {
+			p.AllowPrivate = true
+			p.DenyHosts = []string{"localhost"}
+		}, net.JoinHostPort("localhost", port), false},
+		{"not allowed host", func(p *URLPolicy) {
+			p.AllowPrivate = true
+			p.AllowHosts = []string{"example.com"}
+		}, server.Listener.Addr().String(), false},
+	}
+	for _, test := range tests {
+		p := testPolicy()
+		if test.modify != nil {
+			test.modify(p)
+		}
+		conn, err := p.DialContext(context.Background(), "tcp", test.address)
+		if conn != nil {
+			conn.Close()
+		}
+		switch {
+		case test.allowed && (err != nil):
+			t.Errorf("[%s] expected dial to %s to be allowed, got %v", test.name, test.address, err)
+		case !test.allowed && !errors.Is(err, ErrForbiddenURL):
+			t.Errorf("[%s] expected dial to %s to be forbidden, got %v", test.name, test.address, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"net/textproto"
 	"strings"
+	"time"
 
 	"github.com/efixler/headless"
 	"github.com/efixler/headless/request"
@@ -24,12 +26,23 @@ const (
 var (
 	copyHeaders = []string{
 		textproto.CanonicalMIMEHeaderKey("User-Agent"),
+		textproto.CanonicalMIMEHeaderKey("Accept-Language"),
+		textproto.CanonicalMIMEHeaderKey("Authorization"),
+		textproto.CanonicalMIMEHeaderKey("Cookie"),
 	}
 )
 
 type requestParser func(req *http.Request) (*request.Payload, error)
 
-func New(b headless.TabFactory, mode handlerMode) (http.HandlerFunc, error) {
+func New(b headless.TabFactory, mode handlerMode, options ...Option) (http.HandlerFunc, error) {
+	conf, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	return newHandler(b, mode, conf), nil
+}
+
+func newHandler(b headless.TabFactory, mode handlerMode, conf *config) http.HandlerFunc {
 	var rp requestParser
 	switch mode {
 	case AsProxy:
@@ -41,36 +54,57 @@ func New(b headless.TabFactory, mode handlerMode) (http.HandlerFunc, error) {
 	p := func(w http.ResponseWriter, req *http.Request) {
 		slog.Debug("headless proxy request", "remote", req.RemoteAddr, "method", req.Method, "url", req.URL, "host", req.Host, "header", req.Header)
 		payload, err := rp(req)
+		if (err == nil) && (payload.CallbackURL != "") {
+			err = errors.New("callback_url is only supported for jobs")
+		}
+		if (err == nil) && (conf.policy != nil) {
+			err = conf.policy.Check(req.Context(), payload.URL)
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrForbiddenURL) {
+				status = http.StatusForbidden
+				slog.Info("headless request URL not allowed", "remote", req.RemoteAddr, "err", err)
+			}
+			http.Error(w, err.Error(), status)
 			return
 		}
+		waitStart := time.Now()
 		target, err := b.AcquireTab()
+		if conf.metrics != nil {
+			conf.metrics.observeTabWait(time.Since(waitStart), err)
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusServiceUnavailable)
 			return
 		}
 
-		passHeaders := make(http.Header)
-		for k, v := range payload.Headers {
-			passHeaders.Set(k, v)
-		}
-
-		resp, err := target.Get(payload.URL, passHeaders)
+		resp, err := headless.AsFetcher(target).FetchContext(req.Context(), payload)
 		if err != nil {
-			var httpErr *headless.HTTPError
-			if errors.As(err, &httpErr) {
-				http.Error(w, httpErr.Error(), httpErr.StatusCode)
-			} else {
-				http.Error(w, err.Error(), http.StatusBadGateway)
+			if req.Context().Err() != nil {
+				slog.Debug("headless request abandoned by client", "url", payload.URL, "err", req.Context().Err())
+				return
 			}
-			return
+			status, msg := fetchError(err)
+			if !hasBody(resp) {
+				http.Error(w, msg, status)
+				return
+			}
+			// send what was captured before the failure, like a partial HAR
+			resp.StatusCode = status
 		}
-		for k, v := range resp.Header {
-			w.Header()[k] = v
+		status := resp.StatusCode
+		if payload.Format == request.FormatJSON {
+			// the target's status and headers are in the envelope
+			w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+			status = http.StatusOK
+		} else {
+			for k, v := range resp.Header {
+				w.Header()[k] = v
+			}
 		}
 		w.Header().Set("Content-Length", fmt.Sprint(resp.ContentLength))
-		w.WriteHeader(resp.StatusCode)
+		w.WriteHeader(status)
 		buf := make([]byte, 8192)
 		for {
 			c, err := resp.Body.Read(buf)
@@ -83,7 +117,24 @@ func New(b headless.TabFactory, mode handlerMode) (http.HandlerFunc, error) {
 			w.Write(buf[:c])
 		}
 	}
-	return p, nil
+	return conf.metrics.instrument(mode, http.HandlerFunc(p)).ServeHTTP
+}
+
+// Whether resp, returned along with an error, has content worth sending.
+func hasBody(resp *http.Response) bool {
+	return (resp != nil) && (resp.Body != nil) && (resp.ContentLength > 0)
+}
+
+// The response status and message for an error returned by Fetcher.FetchContext.
+func fetchError(err error) (int, string) {
+	var httpErr *headless.HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr.StatusCode, httpErr.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, err.Error()
+	}
+	return http.StatusBadGateway, err.Error()
 }
 
 func parseProxyPayload(req *http.Request) (*request.Payload, error) {
@@ -95,6 +146,10 @@ func parseProxyPayload(req *http.Request) (*request.Payload, error) {
 		}
 	}
 	payload.URL = req.URL.String()
+	payload.Session = req.Header.Get(headless.SessionHeader)
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
 	return payload, nil
 }
 
@@ -110,5 +165,24 @@ func parsePostPayload(req *http.Request) (*request.Payload, error) {
 	if err != nil {
 		return nil, err
 	}
+	if (payload.Format == "") && acceptsJSON(req) {
+		payload.Format = request.FormatJSON
+	}
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
 	return &payload, nil
 }
+
+// Reports whether the request's Accept header lists application/json.
+func acceptsJSON(req *http.Request) bool {
+	for _, accept := range req.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, _ := strings.Cut(mediaRange, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), "application/json") {
+				return true
+			}
+		}
+	}
+	return false
+}
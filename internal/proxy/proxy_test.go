@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	nurl "net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/efixler/headless"
 	"github.com/efixler/headless/request"
@@ -25,15 +27,48 @@ type testProxy struct {
 type mockBrowser struct {
 	headers http.Header
 	url     string
+	payload *request.Payload
+	ctx     context.Context
+	err     error
+	// returned along with err, if set
+	partial string
 }
 
 func (b *mockBrowser) AcquireTab() (headless.Browser, error) {
 	return b, nil
 }
 
+func (b *mockBrowser) FetchContext(ctx context.Context, payload *request.Payload) (*http.Response, error) {
+	b.ctx = ctx
+	return b.Fetch(payload)
+}
+
+func (b *mockBrowser) GetContext(ctx context.Context, url string, headers http.Header) (*http.Response, error) {
+	b.ctx = ctx
+	return b.Get(url, headers)
+}
+
+func (b *mockBrowser) Fetch(payload *request.Payload) (*http.Response, error) {
+	b.payload = payload
+	headers := make(http.Header)
+	for k, v := range payload.Headers {
+		headers.Set(k, v)
+	}
+	return b.Get(payload.URL, headers)
+}
+
 func (b *mockBrowser) Get(url string, headers http.Header) (*http.Response, error) {
 	b.url = url
 	b.headers = headers
+	if (b.err != nil) && (b.partial != "") {
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+		resp.Header.Set("Content-Type", "application/json")
+		resp.Body = io.NopCloser(strings.NewReader(b.partial))
+		resp.ContentLength = int64(len(b.partial))
+		return resp, b.err
+	} else if b.err != nil {
+		return nil, b.err
+	}
 	resp := &http.Response{
 		StatusCode: 200,
 		Header:     http.Header{},
@@ -189,3 +224,140 @@ func TestPayloadDisallowedFields(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
 	}
 }
+
+func TestPayloadWaitStrategy(t *testing.T) {
+	tests := []struct {
+		name         string
+		payload      string
+		expectStatus int
+	}{
+		{"no wait", `{"url": "http://foo.com/"}`, 200},
+		{"network idle", `{"url": "http://foo.com/", "wait": {"type": "network-idle", "idle_time": 250}}`, 200},
+		{"selector", `{"url": "http://foo.com/", "wait": {"type": "selector", "selector": "#main", "max_wait": "5s"}}`, 200},
+		{"selector missing", `{"url": "http://foo.com/", "wait": {"type": "selector"}}`, 400},
+		{"bad type", `{"url": "http://foo.com/", "wait": {"type": "forever"}}`, 400},
+		{"bad duration", `{"url": "http://foo.com/", "wait": {"type": "load", "max_wait": "soon"}}`, 400},
+	}
+	mockBrowser := mockBrowser{}
+	headlessHandler, err := New(&mockBrowser, AsPostHandler)
+	if err != nil {
+		t.Fatalf("can't initialize proxy handler %v", err)
+	}
+	for _, test := range tests {
+		mockBrowser.payload = nil
+		req := httptest.NewRequest("POST", "/", strings.NewReader(test.payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		headlessHandler(w, req)
+		if w.Code != test.expectStatus {
+			t.Errorf("[%s] - expected status %d, got %d", test.name, test.expectStatus, w.Code)
+		}
+		if test.expectStatus != 200 {
+			continue
+		}
+		var expected request.Payload
+		json.Unmarshal([]byte(test.payload), &expected)
+		if (expected.Wait == nil) != (mockBrowser.payload.Wait == nil) {
+			t.Errorf("[%s] - expected wait %v, got %v", test.name, expected.Wait, mockBrowser.payload.Wait)
+		} else if expected.Wait != nil && *expected.Wait != *mockBrowser.payload.Wait {
+			t.Errorf("[%s] - expected wait %v, got %v", test.name, *expected.Wait, *mockBrowser.payload.Wait)
+		}
+	}
+}
+
+func TestFetchErrorStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		expectStatus int
+	}{
+		{"timeout", fmt.Errorf("navigating: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"http error", &headless.HTTPError{StatusCode: http.StatusTeapot}, http.StatusTeapot},
+		{"other", fmt.Errorf("page load error"), http.StatusBadGateway},
+	}
+	for _, test := range tests {
+		mockBrowser := mockBrowser{err: test.err}
+		headlessHandler, err := New(&mockBrowser, AsPostHandler)
+		if err != nil {
+			t.Fatalf("can't initialize proxy handler %v", err)
+		}
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"url": "http://foo.com/", "timeout": "2s"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		headlessHandler(w, req)
+		if w.Code != test.expectStatus {
+			t.Errorf("[%s] - expected status %d, got %d", test.name, test.expectStatus, w.Code)
+		}
+		if mockBrowser.ctx != req.Context() {
+			t.Errorf("[%s] - expected the inbound request context to be passed to the browser", test.name)
+		}
+		if mockBrowser.payload.Timeout.Duration() != 2*time.Second {
+			t.Errorf("[%s] - expected timeout 2s, got %s", test.name, mockBrowser.payload.Timeout.Duration())
+		}
+	}
+}
+
+func TestFetchErrorPartialBody(t *testing.T) {
+	partial := `{"log": {"comment": "page load error"}}`
+	mockBrowser := mockBrowser{err: fmt.Errorf("page load error"), partial: partial}
+	headlessHandler, err := New(&mockBrowser, AsPostHandler)
+	if err != nil {
+		t.Fatalf("can't initialize proxy handler %v", err)
+	}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"url": "http://foo.com/", "format": "har"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	headlessHandler(w, req)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d, got %d", http.StatusBadGateway, w.Code)
+	}
+	if w.Body.String() != partial {
+		t.Errorf("expected the partial body %q, got %q", partial, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected content type application/json, got %q", ct)
+	}
+}
+
+// getOnlyBrowser is a headless.Browser that isn't a headless.Fetcher.
+type getOnlyBrowser struct {
+	url string
+}
+
+func (b *getOnlyBrowser) AcquireTab() (headless.Browser, error) {
+	return b, nil
+}
+
+func (b *getOnlyBrowser) Get(url string, headers http.Header) (*http.Response, error) {
+	b.url = url
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}, nil
+}
+
+func TestGetOnlyBrowser(t *testing.T) {
+	tests := []struct {
+		name         string
+		payload      string
+		expectStatus int
+	}{
+		{"url only", `{"url": "http://foo.com/"}`, http.StatusOK},
+		{"headers", `{"url": "http://foo.com/", "headers": {"Accept-Language": "en"}}`, http.StatusOK},
+		{"settings", `{"url": "http://foo.com/", "format": "screenshot"}`, http.StatusNotImplemented},
+	}
+	for _, test := range tests {
+		b := &getOnlyBrowser{}
+		handler, err := New(b, AsPostHandler)
+		if err != nil {
+			t.Fatalf("can't initialize proxy handler %v", err)
+		}
+		req := httptest.NewRequest("POST", "/", strings.NewReader(test.payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != test.expectStatus {
+			t.Errorf("[%s] expected status %d, got %d (%s)", test.name, test.expectStatus, w.Code, w.Body)
+		}
+		if (test.expectStatus == http.StatusOK) && (b.url != "http://foo.com/") {
+			t.Errorf("[%s] expected the page to be rendered with Get, got %q", test.name, b.url)
+		}
+	}
+}
@@ -4,18 +4,101 @@ import (
 	"net/http"
 
 	"github.com/efixler/headless"
+	"github.com/efixler/headless/request"
 )
 
-func Service(c headless.TabFactory) (http.Handler, error) {
-	headlessHandler, err := New(c, AsPostHandler)
+type config struct {
+	auth    Authenticator
+	ca      *CertificateAuthority
+	policy  *URLPolicy
+	metrics *Metrics
+	jobs    *JobQueue
+}
+
+type Option func(*config) error
+
+// Require requests to be accepted by the authenticator. A nil authenticator
+// leaves the handler open.
+func WithAuthenticator(a Authenticator) Option {
+	return func(c *config) error {
+		c.auth = a
+		return nil
+	}
+}
+
+// Intercept https requests made through CONNECT with certificates minted
+// by the CA. Only used by HTTPProxy; without a CA, CONNECT isn't supported.
+func WithCA(ca *CertificateAuthority) Option {
+	return func(c *config) error {
+		c.ca = ca
+		return nil
+	}
+}
+
+// Reject requests for URLs that the policy doesn't allow with a 403. The
+// browser should also be configured to check the requests it makes while
+// rendering (see browser.CheckURLs), to cover redirects and sub-resources.
+func WithURLPolicy(p *URLPolicy) Option {
+	return func(c *config) error {
+		c.policy = p
+		return nil
+	}
+}
+
+// Record request metrics. Pass Metrics.ObserveNavigation to the browser
+// with browser.ObserveNavigations for the navigation metrics.
+func WithMetrics(m *Metrics) Option {
+	return func(c *config) error {
+		c.metrics = m
+		return nil
+	}
+}
+
+// Serve the async job API from the queue. Only used by Service.
+func WithJobs(q *JobQueue) Option {
+	return func(c *config) error {
+		c.jobs = q
+		return nil
+	}
+}
+
+func newConfig(options []Option) (*config, error) {
+	c := &config{}
+	for _, opt := range options {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func Service(c headless.TabFactory, options ...Option) (http.Handler, error) {
+	conf, err := newConfig(options)
 	if err != nil {
 		return nil, err
 	}
+	headlessHandler := newHandler(c, AsPostHandler, conf)
 	mux := http.NewServeMux()
-	mux.Handle("POST /{$}", headlessHandler)
+	mux.Handle("POST /{$}", requireAuth(conf.auth, headlessHandler))
+	if conf.jobs != nil {
+		conf.jobs.mount(mux, conf)
+	}
+	mux.HandleFunc("GET /schemas/envelope.json", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(request.EnvelopeSchema)
+	})
+	MountHealth(mux, c)
+	if sm, ok := c.(SessionManager); ok {
+		MountSessions(mux, sm, conf.auth)
+	}
 	return mux, nil
 }
 
-func HTTPProxy(c headless.TabFactory) (http.Handler, error) {
-	return New(c, AsProxy)
+func HTTPProxy(c headless.TabFactory, options ...Option) (http.Handler, error) {
+	conf, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	handler := newHandler(c, AsProxy, conf)
+	return requireAuth(conf.auth, connectHandler(conf.ca, handler)), nil
 }
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/efixler/headless/browser"
+)
+
+// SessionManager is implemented by tab factories with named sessions, like
+// browser.Chrome. Sessions belong to the browser.SessionOwner of the context.
+type SessionManager interface {
+	Sessions(ctx context.Context) []browser.SessionInfo
+	CloseSession(ctx context.Context, name string) error
+}
+
+// Mount GET /sessions, which lists the named sessions, and DELETE
+// /sessions/{name}, which closes one, discarding its cookies and storage.
+// Both require requests to be accepted by the authenticator, if any, and
+// only see the caller's own sessions when the authenticator is an Identifier.
+func MountSessions(mux *http.ServeMux, m SessionManager, a Authenticator) {
+	mux.Handle("GET /sessions", requireAuth(a, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, http.StatusOK, m.Sessions(req.Context()))
+	})))
+	mux.Handle("DELETE /sessions/{name}", requireAuth(a, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := req.PathValue("name")
+		err := m.CloseSession(req.Context(), name)
+		switch {
+		case errors.Is(err, browser.ErrSessionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, browser.ErrSessionInUse):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			slog.Info("headless session closed", "name", name, "remote", req.RemoteAddr)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})))
+}
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efixler/headless"
+	"github.com/efixler/headless/browser"
+)
+
+// sessionBrowser is a mockBrowser with named sessions.
+type sessionBrowser struct {
+	mockBrowser
+	sessions map[string]int
+	// the session owner of the last call
+	owner string
+}
+
+func (b *sessionBrowser) Sessions(ctx context.Context) []browser.SessionInfo {
+	b.owner = browser.SessionOwner(ctx)
+	var infos []browser.SessionInfo
+	for name, tabs := range b.sessions {
+		infos = append(infos, browser.SessionInfo{Name: name, Created: time.Now(), LastUsed: time.Now(), Tabs: tabs})
+	}
+	return infos
+}
+
+func (b *sessionBrowser) CloseSession(ctx context.Context, name string) error {
+	b.owner = browser.SessionOwner(ctx)
+	tabs, ok := b.sessions[name]
+	switch {
+	case !ok:
+		return browser.ErrSessionNotFound
+	case tabs > 0:
+		return browser.ErrSessionInUse
+	}
+	delete(b.sessions, name)
+	return nil
+}
+
+func TestSessionEndpoints(t *testing.T) {
+	sb := &sessionBrowser{sessions: map[string]int{"idle": 0, "busy": 1}}
+	handler, err := Service(sb)
+	if err != nil {
+		t.Fatalf("Service() error: %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/sessions", nil))
+	var infos []browser.SessionInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &infos); err != nil || len(infos) != 2 {
+		t.Errorf("expected 2 sessions, got %s (%v)", w.Body, err)
+	}
+	tests := []struct {
+		name         string
+		session      string
+		expectStatus int
+	}{
+		{"idle", "idle", http.StatusNoContent},
+		{"busy", "busy", http.StatusConflict},
+		{"unknown", "idle", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/sessions/"+test.session, nil))
+		if w.Code != test.expectStatus {
+			t.Errorf("[%s] expected status %d, got %d", test.name, test.expectStatus, w.Code)
+		}
+	}
+}
+
+func TestSessionEndpointsRequireAuth(t *testing.T) {
+	auth, _ := NewBearerAuth("secret")
+	handler, err := Service(&sessionBrowser{}, WithAuthenticator(auth))
+	if err != nil {
+		t.Fatalf("Service() error: %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/sessions", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", w.Code)
+	}
+}
+
+func TestProxySessionHeader(t *testing.T) {
+	tests := []struct {
+		name          string
+		session       string
+		expectStatus  int
+		expectSession string
+	}{
+		{"none", "", http.StatusOK, ""},
+		{"named", "alice", http.StatusOK, "alice"},
+		{"invalid", "alice smith", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		mb := &mockBrowser{}
+		handler, err := New(mb, AsProxy)
+		if err != nil {
+			t.Fatalf("can't initialize proxy handler %v", err)
+		}
+		req := httptest.NewRequest("GET", "http://foo.com/", nil)
+		if test.session != "" {
+			req.Header.Set(headless.SessionHeader, test.session)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != test.expectStatus {
+			t.Errorf("[%s] expected status %d, got %d", test.name, test.expectStatus, w.Code)
+		}
+		if (mb.payload != nil) && (mb.payload.Session != test.expectSession) {
+			t.Errorf("[%s] expected session %q, got %q", test.name, test.expectSession, mb.payload.Session)
+		}
+	}
+}
+
+func TestSessionOwners(t *testing.T) {
+	auth, _ := NewBearerAuth("first-key", "second-key")
+	sb := &sessionBrowser{}
+	handler, err := Service(sb, WithAuthenticator(auth))
+	if err != nil {
+		t.Fatalf("Service() error: %v", err)
+	}
+	owners := make(map[string]string)
+	for _, key := range []string{"first-key", "second-key"} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"url": "http://foo.com/", "session": "shop"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("[%s] expected status 200, got %d", key, w.Code)
+		}
+		owners[key] = browser.SessionOwner(sb.ctx)
+		if owners[key] == "" || strings.Contains(owners[key], key) {
+			t.Errorf("[%s] expected an owner that doesn't reveal the key, got %q", key, owners[key])
+		}
+
+		req = httptest.NewRequest("GET", "/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if sb.owner != owners[key] {
+			t.Errorf("[%s] expected sessions to be listed for %q, got %q", key, owners[key], sb.owner)
+		}
+	}
+	if owners["first-key"] == owners["second-key"] {
+		t.Errorf("expected API keys to own different sessions, got %q for both", owners["first-key"])
+	}
+}
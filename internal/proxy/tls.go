@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	selfSignedValidity = 30 * 24 * time.Hour
+)
+
+// KeyPair serves a TLS certificate loaded from files, reloading it when the
+// files change. Connections keep the certificate they were established with,
+// so a reload doesn't interrupt requests in flight.
+type KeyPair struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+func LoadKeyPair(certFile, keyFile string) (*KeyPair, error) {
+	kp := &KeyPair{certFile: certFile, keyFile: keyFile}
+	if err := kp.reload(); err != nil {
+		return nil, err
+	}
+	return kp, nil
+}
+
+// For use as tls.Config.GetCertificate
+func (kp *KeyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	kp.mu.RLock()
+	defer kp.mu.RUnlock()
+	return kp.cert, nil
+}
+
+// Check the files for changes every interval until the context is done.
+// If a changed certificate can't be loaded, the error is logged and the
+// current certificate stays in use.
+func (kp *KeyPair) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		modTime, err := kp.lastModified()
+		if err != nil {
+			slog.Error("can't check TLS certificate files", "err", err)
+			continue
+		}
+		kp.mu.RLock()
+		changed := !modTime.Equal(kp.modTime)
+		kp.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := kp.reload(); err != nil {
+			slog.Error("can't reload TLS certificate, keeping the current one", "cert", kp.certFile, "err", err)
+			continue
+		}
+		slog.Info("reloaded TLS certificate", "cert", kp.certFile)
+	}
+}
+
+func (kp *KeyPair) reload() error {
+	// read the times first, so a change made while loading is picked up next time
+	modTime, err := kp.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+	if err != nil {
+		return err
+	}
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	kp.cert = &cert
+	kp.modTime = modTime
+	return nil
+}
+
+// The later of the two files' modification times
+func (kp *KeyPair) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{kp.certFile, kp.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Generate a self-signed certificate for the hosts (DNS names or IP addresses).
+// For development only; clients won't trust it without extra configuration.
+func SelfSignedCertificate(hosts ...string) (*tls.Certificate, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts for self-signed certificate")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(selfSignedValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// SHA-256 fingerprint of the certificate, for pinning or verifying by hand.
+func Fingerprint(cert *tls.Certificate) string {
+	sum := sha256.Sum256(cert.Certificate[0])
+	return fmt.Sprintf("%X", sum)
+}
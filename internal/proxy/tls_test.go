@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKeyPair(t *testing.T, certFile, keyFile string, modTime time.Time, hosts ...string) {
+	t.Helper()
+	cert, err := SelfSignedCertificate(hosts...)
+	if err != nil {
+		t.Fatalf("SelfSignedCertificate() error: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	for name, content := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+		if err := os.WriteFile(name, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := SelfSignedCertificate("localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("SelfSignedCertificate() error: %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("localhost"); err != nil {
+		t.Errorf("expected certificate for localhost: %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("expected certificate for 127.0.0.1: %v", err)
+	}
+	if len(Fingerprint(cert)) != 64 {
+		t.Errorf("unexpected fingerprint %q", Fingerprint(cert))
+	}
+	if _, err := SelfSignedCertificate(); err == nil {
+		t.Error("expected an error without hosts")
+	}
+}
+
+func TestKeyPairReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Hour)
+	writeKeyPair(t, certFile, keyFile, start, "one.example.com")
+	kp, err := LoadKeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadKeyPair() error: %v", err)
+	}
+	first, _ := kp.GetCertificate(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go kp.Watch(ctx, 10*time.Millisecond)
+
+	// a broken certificate is ignored
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if cert, _ := kp.GetCertificate(nil); cert != first {
+		t.Error("expected the current certificate to be kept after a failed reload")
+	}
+
+	writeKeyPair(t, certFile, keyFile, start.Add(time.Minute), "two.example.com")
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		cert, _ := kp.GetCertificate(nil)
+		if cert != first {
+			x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if x509Cert.Subject.CommonName != "two.example.com" {
+				t.Errorf("expected reloaded certificate, got %s", x509Cert.Subject.CommonName)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("certificate was not reloaded")
+}
+
+func TestLoadKeyPairMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadKeyPair(filepath.Join(dir, "missing.crt"), filepath.Join(dir, "missing.key")); err == nil {
+		t.Error("expected an error for missing files")
+	}
+}
@@ -0,0 +1,166 @@
+// Package metadata extracts the structured metadata of a page: its title,
+// description and canonical URL, OpenGraph and Twitter card tags, hreflang
+// alternates, JSON-LD blocks and schema.org microdata.
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/efixler/headless/internal/htmlutil"
+	"golang.org/x/net/html"
+)
+
+// Metadata is the structured metadata of a page.
+type Metadata struct {
+	// The page's URL, which relative URLs are resolved against
+	URL         string `json:"url,omitempty"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Canonical   string `json:"canonical,omitempty"`
+	// OpenGraph properties (og:*, and the article:*, book:*, profile:*,
+	// music:* and video:* object types), keyed by property, in page order.
+	OpenGraph map[string][]string `json:"open_graph,omitempty"`
+	// Twitter card properties, keyed by name, in page order.
+	Twitter map[string][]string `json:"twitter,omitempty"`
+	// The other <meta> tags with a name or itemprop, like author or
+	// datePublished, keyed by lower case name or itemprop, in page order.
+	Meta       map[string][]string `json:"meta,omitempty"`
+	Alternates []Alternate         `json:"alternates,omitempty"`
+	// The page's application/ld+json scripts. Scripts that aren't valid JSON
+	// are skipped.
+	JSONLD []json.RawMessage `json:"json_ld,omitempty"`
+	// The page's top level microdata items
+	Microdata []*Item `json:"microdata,omitempty"`
+}
+
+// Alternate is a link to a translation of the page.
+type Alternate struct {
+	HrefLang string `json:"hreflang"`
+	URL      string `json:"url"`
+}
+
+var openGraphPrefixes = []string{"og:", "article:", "book:", "profile:", "music:", "video:"}
+
+// Extract the metadata from the HTML of the page at pageURL.
+func Extract(r io.Reader, pageURL string) (*Metadata, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return ExtractDocument(doc, pageURL)
+}
+
+// Extract the metadata from the parsed HTML of the page at pageURL, for
+// callers that work on the document themselves, like the readability
+// package. The document isn't changed.
+func ExtractDocument(doc *html.Node, pageURL string) (*Metadata, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	m := &Metadata{URL: pageURL}
+	if n := htmlutil.FindFirst(doc, "title"); n != nil {
+		m.Title = htmlutil.InnerText(n)
+	}
+	for _, n := range htmlutil.FindAll(doc, "meta", "link", "script") {
+		switch n.Data {
+		case "meta":
+			m.addMeta(n)
+		case "link":
+			m.addLink(n, base)
+		case "script":
+			m.addScript(n)
+		}
+	}
+	m.Microdata = microdata(doc, base)
+	return m, nil
+}
+
+// Extract the metadata from a response returned by a headless.Browser, using
+// the URL of its Request (the page's final URL) as the page URL. The body is
+// read but not closed.
+func FromResponse(resp *http.Response) (*Metadata, error) {
+	pageURL := ""
+	if resp.Request != nil {
+		pageURL = resp.Request.URL.String()
+	}
+	return Extract(resp.Body, pageURL)
+}
+
+func (m *Metadata) addMeta(n *html.Node) {
+	content, ok := htmlutil.AttrOK(n, "content")
+	if !ok {
+		return
+	}
+	name := strings.ToLower(htmlutil.Attr(n, "name"))
+	property := strings.ToLower(htmlutil.Attr(n, "property"))
+	itemprop := strings.ToLower(htmlutil.Attr(n, "itemprop"))
+	if (name == "description") && (m.Description == "") {
+		m.Description = strings.TrimSpace(content)
+	}
+	// Twitter tags are meant to use name, but property is common too
+	twitter := false
+	for _, key := range []string{name, property} {
+		if strings.HasPrefix(key, "twitter:") {
+			m.Twitter = appendValue(m.Twitter, key, content)
+			twitter = true
+			break
+		}
+	}
+	if (name != "") && (name != "description") && !twitter {
+		m.Meta = appendValue(m.Meta, name, content)
+	}
+	if (itemprop != "") && (itemprop != name) {
+		m.Meta = appendValue(m.Meta, itemprop, content)
+	}
+	for _, prefix := range openGraphPrefixes {
+		if strings.HasPrefix(property, prefix) {
+			m.OpenGraph = appendValue(m.OpenGraph, property, content)
+			break
+		}
+	}
+}
+
+func (m *Metadata) addLink(n *html.Node, base *url.URL) {
+	href, ok := htmlutil.AttrOK(n, "href")
+	if !ok {
+		return
+	}
+	for _, rel := range strings.Fields(strings.ToLower(htmlutil.Attr(n, "rel"))) {
+		switch rel {
+		case "canonical":
+			if m.Canonical == "" {
+				m.Canonical = htmlutil.Resolve(base, href)
+			}
+		case "alternate":
+			if lang := htmlutil.Attr(n, "hreflang"); lang != "" {
+				m.Alternates = append(m.Alternates, Alternate{HrefLang: lang, URL: htmlutil.Resolve(base, href)})
+			}
+		}
+	}
+}
+
+func (m *Metadata) addScript(n *html.Node) {
+	if !strings.EqualFold(strings.TrimSpace(htmlutil.Attr(n, "type")), "application/ld+json") {
+		return
+	}
+	data := []byte(htmlutil.TextContent(n))
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return
+	}
+	m.JSONLD = append(m.JSONLD, buf.Bytes())
+}
+
+func appendValue(values map[string][]string, key, value string) map[string][]string {
+	if values == nil {
+		values = make(map[string][]string)
+	}
+	values[key] = append(values[key], strings.TrimSpace(value))
+	return values
+}
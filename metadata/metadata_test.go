@@ -0,0 +1,100 @@
+package metadata
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const page = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<title>
+		A Page | Site
+	</title>
+	<meta name="description" content=" What the page is about. ">
+	<meta property="og:title" content="A Page">
+	<meta property="og:image" content="https://foo.com/one.png">
+	<meta property="og:image" content="https://foo.com/two.png">
+	<meta property="article:published_time" content="2024-03-05T09:30:00Z">
+	<meta name="twitter:card" content="summary_large_image">
+	<meta property="twitter:site" content="@foo">
+	<meta property="fb:app_id" content="12345">
+	<meta name="Author" content="Ann Author">
+	<meta itemprop="datePublished" content="2024-03-05">
+	<link rel="canonical" href="/page">
+	<link rel="alternate" hreflang="de" href="https://foo.com/de/page">
+	<link rel="alternate" hreflang="x-default" href="/page">
+	<link rel="alternate" type="application/rss+xml" href="/feed">
+	<script type="application/ld+json">
+		{"@context": "https://schema.org", "@type": "Article", "headline": "A Page"}
+	</script>
+	<script type="application/ld+json">{"broken": </script>
+	<script>var notJSONLD = true;</script>
+</head>
+<body></body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	m, err := Extract(strings.NewReader(page), "https://foo.com/path/page?x=1")
+	if err != nil {
+		t.Fatalf("Extract() error: %v", err)
+	}
+	if m.Title != "A Page | Site" || m.Description != "What the page is about." {
+		t.Errorf("unexpected title %q and description %q", m.Title, m.Description)
+	}
+	if m.Canonical != "https://foo.com/page" {
+		t.Errorf("unexpected canonical %q", m.Canonical)
+	}
+	if images := m.OpenGraph["og:image"]; len(images) != 2 || images[1] != "https://foo.com/two.png" {
+		t.Errorf("expected both og:image values, got %v", images)
+	}
+	if m.OpenGraph["article:published_time"] == nil || m.OpenGraph["fb:app_id"] != nil {
+		t.Errorf("unexpected OpenGraph properties %v", m.OpenGraph)
+	}
+	if m.Twitter["twitter:card"][0] != "summary_large_image" || m.Twitter["twitter:site"][0] != "@foo" {
+		t.Errorf("unexpected Twitter properties %v", m.Twitter)
+	}
+	if m.Meta["author"][0] != "Ann Author" || m.Meta["datepublished"][0] != "2024-03-05" {
+		t.Errorf("expected the author and datePublished tags, got %v", m.Meta)
+	}
+	if m.Meta["description"] != nil || m.Meta["twitter:card"] != nil {
+		t.Errorf("expected the description and Twitter tags only in their own fields, got %v", m.Meta)
+	}
+	expected := []Alternate{{"de", "https://foo.com/de/page"}, {"x-default", "https://foo.com/page"}}
+	if len(m.Alternates) != len(expected) || m.Alternates[0] != expected[0] || m.Alternates[1] != expected[1] {
+		t.Errorf("expected alternates %v, got %v", expected, m.Alternates)
+	}
+	if len(m.JSONLD) != 1 || string(m.JSONLD[0]) != `{"@context":"https://schema.org","@type":"Article","headline":"A Page"}` {
+		t.Errorf("expected one JSON-LD block, got %s", m.JSONLD)
+	}
+}
+
+func TestExtractEmpty(t *testing.T) {
+	m, err := Extract(strings.NewReader("<html></html>"), "https://foo.com/")
+	if err != nil {
+		t.Fatalf("Extract() error: %v", err)
+	}
+	data, _ := json.Marshal(m)
+	if string(data) != `{"url":"https://foo.com/","title":""}` {
+		t.Errorf("expected empty fields to be omitted, got %s", data)
+	}
+}
+
+func TestFromResponse(t *testing.T) {
+	u, _ := url.Parse("https://www.foo.com/story")
+	resp := &http.Response{
+		Body:    io.NopCloser(strings.NewReader(`<html><head><link rel="canonical" href="/canonical"></head></html>`)),
+		Request: &http.Request{URL: u},
+	}
+	m, err := FromResponse(resp)
+	if err != nil {
+		t.Fatalf("FromResponse() error: %v", err)
+	}
+	if m.URL != "https://www.foo.com/story" || m.Canonical != "https://www.foo.com/canonical" {
+		t.Errorf("expected URLs to be resolved against the request URL, got %q (%q)", m.Canonical, m.URL)
+	}
+}
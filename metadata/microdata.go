@@ -0,0 +1,122 @@
+package metadata
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/efixler/headless/internal/htmlutil"
+	"golang.org/x/net/html"
+)
+
+// Item is a microdata item, in the JSON form defined by the HTML spec.
+type Item struct {
+	Type []string `json:"type,omitempty"`
+	ID   string   `json:"id,omitempty"`
+	// Property values by name; each value is a string or an *Item.
+	Properties map[string][]any `json:"properties"`
+}
+
+// Elements whose microdata value is a URL, and the attribute it comes from
+var urlValueAttrs = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"audio":  "src",
+	"embed":  "src",
+	"iframe": "src",
+	"img":    "src",
+	"link":   "href",
+	"object": "data",
+	"source": "src",
+	"track":  "src",
+	"video":  "src",
+}
+
+// The top level items under doc: those with itemscope that aren't the value
+// of another item's property.
+func microdata(doc *html.Node, base *url.URL) []*Item {
+	ids := make(map[string]*html.Node)
+	for _, n := range htmlutil.FindAll(doc) {
+		if id := htmlutil.Attr(n, "id"); id != "" {
+			if _, ok := ids[id]; !ok {
+				ids[id] = n
+			}
+		}
+	}
+	var items []*Item
+	for _, n := range htmlutil.FindAll(doc) {
+		_, scope := htmlutil.AttrOK(n, "itemscope")
+		if _, prop := htmlutil.AttrOK(n, "itemprop"); scope && !prop {
+			items = append(items, newItem(n, base, ids, map[*html.Node]bool{}))
+		}
+	}
+	return items
+}
+
+// The item for the itemscope element n. Elements already being read are in
+// seen, so that items that refer to themselves with itemref stop there.
+func newItem(n *html.Node, base *url.URL, ids map[string]*html.Node, seen map[*html.Node]bool) *Item {
+	seen[n] = true
+	defer delete(seen, n)
+	item := &Item{
+		Type:       strings.Fields(htmlutil.Attr(n, "itemtype")),
+		Properties: make(map[string][]any),
+	}
+	if id := htmlutil.Attr(n, "itemid"); id != "" {
+		item.ID = htmlutil.Resolve(base, id)
+	}
+	// itemref can point at elements that are also children, but each
+	// element is only read once
+	visited := make(map[*html.Node]bool)
+	var visit func(*html.Node)
+	visit = func(c *html.Node) {
+		if c.Type != html.ElementNode || seen[c] || visited[c] {
+			return
+		}
+		visited[c] = true
+		_, scope := htmlutil.AttrOK(c, "itemscope")
+		if names := strings.Fields(htmlutil.Attr(c, "itemprop")); len(names) > 0 {
+			var value any
+			if scope {
+				value = newItem(c, base, ids, seen)
+			} else {
+				value = propertyValue(c, base)
+			}
+			for _, name := range names {
+				item.Properties[name] = append(item.Properties[name], value)
+			}
+		}
+		// a nested item's own properties belong to it
+		if !scope {
+			for gc := c.FirstChild; gc != nil; gc = gc.NextSibling {
+				visit(gc)
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		visit(c)
+	}
+	for _, ref := range strings.Fields(htmlutil.Attr(n, "itemref")) {
+		if r, ok := ids[ref]; ok {
+			visit(r)
+		}
+	}
+	return item
+}
+
+// The value of a property element without itemscope.
+func propertyValue(n *html.Node, base *url.URL) string {
+	if key, ok := urlValueAttrs[n.Data]; ok {
+		return htmlutil.Resolve(base, htmlutil.Attr(n, key))
+	}
+	switch n.Data {
+	case "meta":
+		return htmlutil.Attr(n, "content")
+	case "data", "meter":
+		return htmlutil.Attr(n, "value")
+	case "time":
+		if dt, ok := htmlutil.AttrOK(n, "datetime"); ok {
+			return dt
+		}
+	}
+	return htmlutil.InnerText(n)
+}
@@ -0,0 +1,51 @@
+package metadata
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMicrodata(t *testing.T) {
+	page := `<html><body>
+		<div itemscope itemtype="https://schema.org/Product" itemid="/products/1" itemref="reviews">
+			<h1 itemprop="name">  Widget
+				Deluxe </h1>
+			<img itemprop="image" src="/widget.png">
+			<a itemprop="url sameAs" href="/widget">Widget page</a>
+			<meta itemprop="sku" content="W-1">
+			<data itemprop="weight" value="1.5">1.5 kg</data>
+			<time itemprop="releaseDate" datetime="2024-01-01">New Year's Day</time>
+			<div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+				<span itemprop="price">9.99</span>
+			</div>
+			<div itemscope itemtype="https://schema.org/Thing"><span itemprop="name">Unrelated</span></div>
+		</div>
+		<div id="reviews">
+			<span itemprop="reviewCount">12</span>
+		</div>
+		<p itemscope itemtype="https://schema.org/Person" itemref="self"><span id="self" itemprop="name">Loop</span></p>
+	</body></html>`
+	m, err := Extract(strings.NewReader(page), "https://foo.com/shop/")
+	if err != nil {
+		t.Fatalf("Extract() error: %v", err)
+	}
+	data, _ := json.Marshal(m.Microdata)
+	expected := `[` +
+		`{"type":["https://schema.org/Product"],"id":"https://foo.com/products/1","properties":{` +
+		`"image":["https://foo.com/widget.png"],` +
+		`"name":["Widget Deluxe"],` +
+		`"offers":[{"type":["https://schema.org/Offer"],"properties":{"price":["9.99"]}}],` +
+		`"releaseDate":["2024-01-01"],` +
+		`"reviewCount":["12"],` +
+		`"sameAs":["https://foo.com/widget"],` +
+		`"sku":["W-1"],` +
+		`"url":["https://foo.com/widget"],` +
+		`"weight":["1.5"]}},` +
+		`{"type":["https://schema.org/Thing"],"properties":{"name":["Unrelated"]}},` +
+		`{"type":["https://schema.org/Person"],"properties":{"name":["Loop"]}}` +
+		`]`
+	if string(data) != expected {
+		t.Errorf("unexpected microdata\nexpected: %s\n     got: %s", expected, data)
+	}
+}
@@ -0,0 +1,372 @@
+package readability
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/efixler/headless/internal/htmlutil"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	// Elements that are never part of an article
+	junkTags = map[string]bool{
+		"button":   true,
+		"canvas":   true,
+		"dialog":   true,
+		"embed":    true,
+		"footer":   true,
+		"form":     true,
+		"iframe":   true,
+		"input":    true,
+		"link":     true,
+		"meta":     true,
+		"nav":      true,
+		"noscript": true,
+		"object":   true,
+		"script":   true,
+		"select":   true,
+		"style":    true,
+		"svg":      true,
+		"template": true,
+		"textarea": true,
+	}
+	// ARIA roles of elements that are never part of an article
+	junkRoles = map[string]bool{
+		"alert":         true,
+		"alertdialog":   true,
+		"complementary": true,
+		"dialog":        true,
+		"menu":          true,
+		"menubar":       true,
+		"navigation":    true,
+	}
+	// Elements that stop a div from being scored like a paragraph
+	blockTags = []string{
+		"article", "blockquote", "div", "dl", "figure", "h1", "h2", "h3", "h4", "h5",
+		"h6", "header", "img", "ol", "p", "pre", "section", "table", "ul",
+	}
+	// Attributes kept in the cleaned HTML
+	keptAttrs = map[string]bool{
+		"alt":      true,
+		"colspan":  true,
+		"datetime": true,
+		"href":     true,
+		"rowspan":  true,
+		"src":      true,
+		"title":    true,
+	}
+	// URL schemes that links and images in the cleaned HTML may have; others,
+	// like javascript:, data: and vbscript:, are dropped
+	safeSchemes = map[string]bool{
+		"http":   true,
+		"https":  true,
+		"mailto": true,
+	}
+	hiddenStyle = regexp.MustCompile(`(?i)display\s*:\s*none|visibility\s*:\s*hidden`)
+	unlikely    = regexp.MustCompile(`(?i)-ad-|ai2html|banner|breadcrumbs|combx|comment|community|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|newsletter|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|yom-remote`)
+	maybe       = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positive    = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+	negative    = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|footer|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|widget`)
+	bylineClass = regexp.MustCompile(`(?i)byline|author|dateline|writtenby|p-author`)
+	endSentence = regexp.MustCompile(`\.( |$)`)
+)
+
+// Remove everything under body that can't be part of the article, returning
+// the text of the first byline found, which is removed too.
+func prepare(body *html.Node) (byline string) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			switch {
+			case c.Type == html.CommentNode:
+				remove(c)
+			case c.Type != html.ElementNode:
+			case junkTags[c.Data] || junkRoles[htmlutil.Attr(c, "role")] || isHidden(c):
+				remove(c)
+			case byline == "" && isByline(c):
+				byline = cleanByline(htmlutil.InnerText(c))
+				remove(c)
+			case isUnlikely(c):
+				remove(c)
+			default:
+				walk(c)
+			}
+			c = next
+		}
+	}
+	walk(body)
+	return byline
+}
+
+func isHidden(n *html.Node) bool {
+	if _, ok := htmlutil.AttrOK(n, "hidden"); ok {
+		return true
+	}
+	return htmlutil.Attr(n, "aria-hidden") == "true" || hiddenStyle.MatchString(htmlutil.Attr(n, "style"))
+}
+
+func isByline(n *html.Node) bool {
+	if htmlutil.Attr(n, "rel") != "author" && !strings.Contains(htmlutil.Attr(n, "itemprop"), "author") &&
+		!bylineClass.MatchString(htmlutil.Attr(n, "class")+" "+htmlutil.Attr(n, "id")) {
+		return false
+	}
+	length := len(htmlutil.InnerText(n))
+	return length > 0 && length < 100
+}
+
+func isUnlikely(n *html.Node) bool {
+	if htmlutil.IsElement(n, "body", "article", "main") {
+		return false
+	}
+	match := htmlutil.Attr(n, "class") + " " + htmlutil.Attr(n, "id")
+	return unlikely.MatchString(match) && !maybe.MatchString(match)
+}
+
+// Score the elements under body by the paragraphs they contain, and return a
+// div holding the best scoring one and any of its siblings that look like
+// part of the same article.
+func grabArticle(body *html.Node) *html.Node {
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	for _, n := range htmlutil.FindAll(body, "p", "pre", "td", "div", "section") {
+		if htmlutil.IsElement(n, "div", "section") && len(htmlutil.FindAll(n, blockTags...)) > 0 {
+			continue
+		}
+		text := htmlutil.InnerText(n)
+		if len(text) < 25 {
+			continue
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text)/100), 3)
+		// the parent gets the full score, the grandparent half, and the
+		// great-grandparent a sixth
+		level := 0
+		for a := n.Parent; a != nil && level < 3 && htmlutil.IsElement(a) && a.Data != "html"; a = a.Parent {
+			if _, ok := scores[a]; !ok {
+				scores[a] = initialScore(a)
+				candidates = append(candidates, a)
+			}
+			divider := 1.0
+			if level > 0 {
+				divider = float64(level) * 2
+				if level > 1 {
+					divider = float64(level) * 3
+				}
+			}
+			scores[a] += score / divider
+			level++
+		}
+	}
+
+	var top *html.Node
+	var topScore float64
+	for _, n := range candidates {
+		scores[n] *= 1 - linkDensity(n)
+		if top == nil || scores[n] > topScore {
+			top, topScore = n, scores[n]
+		}
+	}
+
+	container := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	if top == nil || top == body {
+		for c := body.FirstChild; c != nil; c = body.FirstChild {
+			body.RemoveChild(c)
+			container.AppendChild(c)
+		}
+		return container
+	}
+	// an only child is just a wrapper: the article is its parent
+	for top.Parent != body && onlyElementChild(top) {
+		top = top.Parent
+	}
+
+	threshold := max(10, topScore*0.2)
+	var siblings []*html.Node
+	for s := top.Parent.FirstChild; s != nil; s = s.NextSibling {
+		siblings = append(siblings, s)
+	}
+	for _, s := range siblings {
+		if s == top || isRelatedSibling(s, top, topScore, threshold, scores) {
+			remove(s)
+			container.AppendChild(s)
+		}
+	}
+	return container
+}
+
+func onlyElementChild(n *html.Node) bool {
+	for c := n.Parent.FirstChild; c != nil; c = c.NextSibling {
+		if c != n && (htmlutil.IsElement(c) || strings.TrimSpace(htmlutil.TextContent(c)) != "") {
+			return false
+		}
+	}
+	return true
+}
+
+func isRelatedSibling(s, top *html.Node, topScore, threshold float64, scores map[*html.Node]float64) bool {
+	if !htmlutil.IsElement(s) {
+		return false
+	}
+	bonus := 0.0
+	if class := htmlutil.Attr(top, "class"); class != "" && htmlutil.Attr(s, "class") == class {
+		bonus = topScore * 0.2
+	}
+	if score, ok := scores[s]; ok && score+bonus >= threshold {
+		return true
+	}
+	if !htmlutil.IsElement(s, "p") {
+		return false
+	}
+	text := htmlutil.InnerText(s)
+	density := linkDensity(s)
+	switch {
+	case len(text) > 80:
+		return density < 0.25
+	case len(text) > 0:
+		return density == 0 && endSentence.MatchString(text)
+	}
+	return false
+}
+
+func initialScore(n *html.Node) float64 {
+	score := float64(classWeight(n))
+	switch n.Data {
+	case "div":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+	return score
+}
+
+func classWeight(n *html.Node) int {
+	weight := 0
+	for _, s := range []string{htmlutil.Attr(n, "class"), htmlutil.Attr(n, "id")} {
+		if s == "" {
+			continue
+		}
+		if negative.MatchString(s) {
+			weight -= 25
+		}
+		if positive.MatchString(s) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// Remove boilerplate from the article content and reduce its markup to what's
+// needed to display it, with links and images resolved against base.
+func clean(content *html.Node, base *url.URL, title string) {
+	containers := htmlutil.FindAll(content, "div", "section", "table", "ul", "ol")
+	// inner elements first, so an outer one is judged on what's left
+	for i := len(containers) - 1; i >= 0; i-- {
+		if isBoilerplate(containers[i]) {
+			remove(containers[i])
+		}
+	}
+	for _, n := range htmlutil.FindAll(content, "h1", "h2") {
+		if strings.EqualFold(htmlutil.InnerText(n), title) {
+			remove(n)
+		}
+	}
+	for _, n := range htmlutil.FindAll(content) {
+		switch n.Data {
+		case "img":
+			if htmlutil.Attr(n, "src") == "" {
+				if lazy := htmlutil.Attr(n, "data-src"); lazy != "" {
+					setAttr(n, "src", lazy)
+				} else {
+					remove(n)
+					continue
+				}
+			}
+			if _, ok := safeURL(base, htmlutil.Attr(n, "src")); !ok {
+				remove(n)
+				continue
+			}
+		case "a":
+			// keep the text of links that go nowhere safe
+			if href, ok := htmlutil.AttrOK(n, "href"); ok {
+				if _, safe := safeURL(base, href); !safe {
+					unwrap(n)
+					continue
+				}
+			}
+		case "p":
+			if htmlutil.InnerText(n) == "" && len(htmlutil.FindAll(n, "img")) == 0 {
+				remove(n)
+				continue
+			}
+		}
+		kept := n.Attr[:0]
+		for _, a := range n.Attr {
+			if !keptAttrs[a.Key] || a.Namespace != "" {
+				continue
+			}
+			if a.Key == "href" || a.Key == "src" {
+				var ok bool
+				if a.Val, ok = safeURL(base, a.Val); !ok {
+					continue
+				}
+			}
+			kept = append(kept, a)
+		}
+		n.Attr = kept
+	}
+}
+
+// The URL resolved against base, and whether it can be kept in the cleaned
+// HTML: it must parse, and have an http, https or mailto scheme, or no
+// scheme if there's no base.
+func safeURL(base *url.URL, ref string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	return u.String(), (u.Scheme == "") || safeSchemes[strings.ToLower(u.Scheme)]
+}
+
+// Whether a container looks like boilerplate rather than part of the
+// article, from its class and id and its mix of text, links, images and
+// list items.
+func isBoilerplate(n *html.Node) bool {
+	weight := classWeight(n)
+	if weight < 0 {
+		return true
+	}
+	text := htmlutil.InnerText(n)
+	if strings.Count(text, ",") >= 10 {
+		return false
+	}
+	p := float64(len(htmlutil.FindAll(n, "p")))
+	img := float64(len(htmlutil.FindAll(n, "img")))
+	li := float64(len(htmlutil.FindAll(n, "li"))) - 100
+	input := float64(len(htmlutil.FindAll(n, "input")))
+	density := linkDensity(n)
+	switch {
+	case img > 1 && p/img < 0.5:
+		return true
+	case !htmlutil.IsElement(n, "ul", "ol") && li > p:
+		return true
+	case input > p/3:
+		return true
+	case len(text) < 25 && (img == 0 || img > 2):
+		return true
+	case weight < 25 && density > 0.2:
+		return true
+	case weight >= 25 && density > 0.5:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package readability
+
+import (
+	"github.com/efixler/headless/internal/htmlutil"
+	"golang.org/x/net/html"
+)
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func remove(n *html.Node) {
+	if n.Parent != nil {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+// Replace n with its children.
+func unwrap(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = n.FirstChild {
+		n.RemoveChild(c)
+		n.Parent.InsertBefore(c, n)
+	}
+	remove(n)
+}
+
+// The proportion of n's text that's inside links.
+func linkDensity(n *html.Node) float64 {
+	length := len(htmlutil.InnerText(n))
+	if length == 0 {
+		return 0
+	}
+	linkLength := 0
+	for _, a := range htmlutil.FindAll(n, "a") {
+		linkLength += len(htmlutil.InnerText(a))
+	}
+	return float64(linkLength) / float64(length)
+}
@@ -0,0 +1,157 @@
+package readability
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/efixler/headless/internal/htmlutil"
+	"github.com/efixler/headless/metadata"
+	"golang.org/x/net/html"
+)
+
+var (
+	// Separators between an article's title and the site name in <title>
+	titleSeparator = regexp.MustCompile(`\s+(?:\||-|–|—|::|/|·)\s+`)
+	byPrefix       = regexp.MustCompile(`(?i)^by\s+`)
+	// Layouts tried, in order, for publication dates
+	dateLayouts = []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+		time.RFC1123Z,
+		time.RFC1123,
+		"January 2, 2006",
+		"Jan 2, 2006",
+	}
+)
+
+// The first non-empty value of the first of keys that the page has, from its
+// OpenGraph, Twitter or other <meta> tags. Keys are lower case.
+func firstMeta(meta *metadata.Metadata, keys ...string) string {
+	for _, key := range keys {
+		for _, tags := range []map[string][]string{meta.OpenGraph, meta.Twitter, meta.Meta} {
+			for _, v := range tags[key] {
+				if v != "" {
+					return v
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// The Open Graph or Twitter title if there is one, since they don't include
+// the site name, or else the page's <title> without the site name, or else
+// its first h1.
+func title(doc *html.Node, meta *metadata.Metadata) string {
+	if t := firstMeta(meta, "og:title", "twitter:title"); t != "" {
+		return t
+	}
+	if t := cleanTitle(meta.Title); t != "" {
+		return t
+	}
+	if n := htmlutil.FindFirst(doc, "h1"); n != nil {
+		return htmlutil.InnerText(n)
+	}
+	return ""
+}
+
+// Remove the site name from a title like "Article Title | Site Name", as long
+// as enough of a title is left.
+func cleanTitle(t string) string {
+	locs := titleSeparator.FindAllStringIndex(t, -1)
+	if len(locs) == 0 {
+		return t
+	}
+	last := locs[len(locs)-1]
+	if head := t[:last[0]]; len(strings.Fields(head)) >= 3 {
+		return head
+	}
+	// the site name may come first instead: "Site Name | Article Title"
+	if tail := t[locs[0][1]:]; len(strings.Fields(tail)) >= 3 {
+		return tail
+	}
+	return t
+}
+
+// The page's description, or its OpenGraph or Twitter one.
+func description(meta *metadata.Metadata) string {
+	if meta.Description != "" {
+		return meta.Description
+	}
+	return firstMeta(meta, "og:description", "twitter:description")
+}
+
+func metaByline(meta *metadata.Metadata) string {
+	for _, key := range []string{"author", "article:author", "dc.creator", "parsely-author", "sailthru.author"} {
+		v := firstMeta(meta, key)
+		// article:author is often a profile URL
+		if v == "" || strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") {
+			continue
+		}
+		return cleanByline(v)
+	}
+	return ""
+}
+
+func cleanByline(b string) string {
+	return byPrefix.ReplaceAllString(strings.Join(strings.Fields(b), " "), "")
+}
+
+// The publication date from the page's metadata, or from the first <time>
+// element, or nil if there isn't one that can be parsed.
+func published(doc *html.Node, meta *metadata.Metadata) *time.Time {
+	candidates := []string{firstMeta(meta,
+		"article:published_time",
+		"datepublished",
+		"og:published_time",
+		"publishdate",
+		"pubdate",
+		"date",
+		"dc.date.issued",
+		"dc.date",
+		"sailthru.date",
+		"parsely-pub-date",
+	)}
+	for _, n := range htmlutil.FindAll(doc, "time") {
+		if _, ok := htmlutil.AttrOK(n, "pubdate"); ok {
+			candidates = append([]string{htmlutil.Attr(n, "datetime")}, candidates...)
+		} else {
+			candidates = append(candidates, htmlutil.Attr(n, "datetime"))
+		}
+	}
+	for _, candidate := range candidates {
+		if t := parseDate(candidate); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+func parseDate(s string) *time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+func leadImage(doc *html.Node, meta *metadata.Metadata) string {
+	if img := firstMeta(meta, "og:image", "og:image:url", "og:image:secure_url", "twitter:image", "twitter:image:src"); img != "" {
+		return img
+	}
+	for _, n := range htmlutil.FindAll(doc, "link") {
+		if strings.EqualFold(htmlutil.Attr(n, "rel"), "image_src") {
+			return htmlutil.Attr(n, "href")
+		}
+	}
+	return ""
+}
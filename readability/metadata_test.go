@@ -0,0 +1,103 @@
+package readability
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/efixler/headless/metadata"
+	"golang.org/x/net/html"
+)
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		title    string
+		expected string
+	}{
+		{"A Story About Things", "A Story About Things"},
+		{"A Story About Things | Site Name", "A Story About Things"},
+		{"A Story - About Things - Site", "A Story - About Things"},
+		{"Site Name :: A Story About Things", "A Story About Things"},
+		{"Short - Site", "Short - Site"},
+		{"Well-known hyphenated words", "Well-known hyphenated words"},
+	}
+	for _, test := range tests {
+		if got := cleanTitle(test.title); got != test.expected {
+			t.Errorf("cleanTitle(%q): expected %q, got %q", test.title, test.expected, got)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	tests := []struct {
+		name              string
+		head              string
+		body              string
+		expectTitle       string
+		expectDescription string
+		expectByline      string
+		expectPublished   string
+		expectImage       string
+	}{
+		{
+			name:              "open graph",
+			head:              `<title>Page | Site</title><meta property="og:title" content="OG Title"><meta property="og:description" content="OG Description"><meta property="og:image" content="https://img.com/a.png"><meta name="author" content="by  Ann Author">`,
+			expectTitle:       "OG Title",
+			expectDescription: "OG Description",
+			expectByline:      "Ann Author",
+			expectImage:       "https://img.com/a.png",
+			expectPublished:   "",
+		},
+		{
+			name:              "author url",
+			head:              `<meta property="article:author" content="https://foo.com/ann"><meta name="dc.creator" content="Ann Author"><meta name="description" content="Page Description"><meta property="og:description" content="OG Description">`,
+			expectDescription: "Page Description",
+			body:              `<h1>Heading Title</h1>`,
+			expectTitle:       "Heading Title",
+			expectByline:      "Ann Author",
+		},
+		{
+			name:            "time elements",
+			body:            `<time datetime="2020-01-01">Jan 1</time><time pubdate datetime="2021-06-15T10:00:00Z">June 15</time>`,
+			expectPublished: "2021-06-15T10:00:00Z",
+		},
+		{
+			name:            "date only",
+			head:            `<meta itemprop="datePublished" content="2022-02-02"><link rel="image_src" href="/lead.png">`,
+			expectPublished: "2022-02-02T00:00:00Z",
+			expectImage:     "/lead.png",
+		},
+		{
+			name: "unparseable date",
+			head: `<meta name="date" content="last Tuesday">`,
+		},
+	}
+	for _, test := range tests {
+		doc, err := html.Parse(strings.NewReader("<html><head>" + test.head + "</head><body>" + test.body + "</body></html>"))
+		if err != nil {
+			t.Fatalf("[%s] can't parse page: %v", test.name, err)
+		}
+		meta, err := metadata.ExtractDocument(doc, "https://foo.com/")
+		if err != nil {
+			t.Fatalf("[%s] can't extract metadata: %v", test.name, err)
+		}
+		if got := title(doc, meta); got != test.expectTitle {
+			t.Errorf("[%s] expected title %q, got %q", test.name, test.expectTitle, got)
+		}
+		if got := description(meta); got != test.expectDescription {
+			t.Errorf("[%s] expected description %q, got %q", test.name, test.expectDescription, got)
+		}
+		if got := metaByline(meta); got != test.expectByline {
+			t.Errorf("[%s] expected byline %q, got %q", test.name, test.expectByline, got)
+		}
+		got := ""
+		if p := published(doc, meta); p != nil {
+			got = p.Format("2006-01-02T15:04:05Z07:00")
+		}
+		if got != test.expectPublished {
+			t.Errorf("[%s] expected published %q, got %q", test.name, test.expectPublished, got)
+		}
+		if got := leadImage(doc, meta); got != test.expectImage {
+			t.Errorf("[%s] expected image %q, got %q", test.name, test.expectImage, got)
+		}
+	}
+}
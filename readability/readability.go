@@ -0,0 +1,103 @@
+// Package readability extracts the main article from a rendered page: its
+// title, description, byline, publication date and lead image, and the article content as
+// cleaned HTML and plain text. It's based on the approach of Mozilla's
+// Readability.js: paragraphs score the elements that contain them, the best
+// scoring element (with any related siblings) is taken as the article, and
+// anything in it that looks like boilerplate is removed.
+package readability
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/efixler/headless/internal/htmlutil"
+	"github.com/efixler/headless/metadata"
+	"golang.org/x/net/html"
+)
+
+var (
+	ErrNoContent = errors.New("no article content found")
+)
+
+// Article is the main content of a page.
+type Article struct {
+	// The page's URL, which relative links in the HTML are resolved against
+	URL   string `json:"url,omitempty"`
+	Title string `json:"title"`
+	// The page's summary of itself, from its <meta> tags
+	Description string     `json:"description,omitempty"`
+	Byline      string     `json:"byline,omitempty"`
+	Published   *time.Time `json:"published,omitempty"`
+	// URL of the page's lead image
+	Image string `json:"image,omitempty"`
+	// The article content, without scripts, styles, navigation, ads and the
+	// like, and with only the attributes needed to display it
+	HTML string `json:"html"`
+	// The article content as text, with blank lines between paragraphs
+	Text string `json:"text"`
+}
+
+// Extract the article from the HTML of the page at pageURL. Returns
+// ErrNoContent if the page doesn't have any text content.
+func Extract(r io.Reader, pageURL string) (*Article, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	// before the document is changed
+	meta, err := metadata.ExtractDocument(doc, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	article := &Article{
+		URL:         pageURL,
+		Title:       title(doc, meta),
+		Description: description(meta),
+		Byline:      metaByline(meta),
+		Published:   published(doc, meta),
+		Image:       htmlutil.Resolve(base, leadImage(doc, meta)),
+	}
+	body := htmlutil.FindFirst(doc, "body")
+	if body == nil {
+		return nil, ErrNoContent
+	}
+	if byline := prepare(body); article.Byline == "" {
+		article.Byline = byline
+	}
+	content := grabArticle(body)
+	clean(content, base, article.Title)
+	article.Text = plainText(content)
+	if article.Text == "" {
+		return nil, ErrNoContent
+	}
+	if article.Image == "" {
+		if img := htmlutil.FindFirst(content, "img"); img != nil {
+			article.Image = htmlutil.Attr(img, "src")
+		}
+	}
+	var buf bytes.Buffer
+	if err := html.Render(&buf, content); err != nil {
+		return nil, err
+	}
+	article.HTML = buf.String()
+	return article, nil
+}
+
+// Extract the article from a response returned by a headless.Browser, using
+// the URL of its Request (the page's final URL) as the page URL. The body
+// is read but not closed.
+func FromResponse(resp *http.Response) (*Article, error) {
+	pageURL := ""
+	if resp.Request != nil {
+		pageURL = resp.Request.URL.String()
+	}
+	return Extract(resp.Body, pageURL)
+}
@@ -0,0 +1,175 @@
+package readability
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const articlePage = `<!DOCTYPE html>
+<html>
+<head>
+	<title>Why Cats Knock Things Off Tables | The Daily Feline</title>
+	<meta property="article:published_time" content="2024-03-05T09:30:00Z">
+	<meta property="og:image" content="/images/cat.jpg">
+	<script>trackPageView();</script>
+	<style>body { color: black; }</style>
+</head>
+<body>
+	<nav><a href="/">Home</a> <a href="/news">News</a> <a href="/about">About</a></nav>
+	<div class="header">Subscribe to The Daily Feline for more stories like this one, delivered daily.</div>
+	<div id="main">
+		<div class="article-body">
+			<h1>Why Cats Knock Things Off Tables</h1>
+			<p class="byline">By Jane Whiskers</p>
+			<p>Cats knock things off tables for many reasons, and researchers have spent years trying to work out which of them matters most.</p>
+			<p>Some of it is play, some of it is hunting practice, and some of it, according to a <a href="/studies/attention">recent study</a>, is simply a bid for attention from their owners.</p>
+			<p style="display:none">This paragraph is hidden from readers, so it shouldn't turn up in the article.</p>
+			<p>Whatever the reason, keeping breakables away from the edges of tables, shelves and counters is still the best advice for cat owners.</p>
+			<img data-src="/images/table.jpg" alt="A cat on a table" class="lazy">
+			<div class="share-widget"><a href="https://social.example/share">Share</a> <a href="https://mail.example/share">Email</a></div>
+		</div>
+	</div>
+	<div class="sidebar">
+		<ul>
+			<li><a href="/one">Ten facts about dogs that will surprise you</a></li>
+			<li><a href="/two">The best cat toys of the year, reviewed</a></li>
+		</ul>
+	</div>
+	<footer>Copyright The Daily Feline. All rights reserved, everywhere, forever.</footer>
+</body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	a, err := Extract(strings.NewReader(articlePage), "https://feline.example/news/cats-tables")
+	if err != nil {
+		t.Fatalf("Extract() error: %v", err)
+	}
+	if a.Title != "Why Cats Knock Things Off Tables" {
+		t.Errorf("unexpected title %q", a.Title)
+	}
+	if a.Byline != "Jane Whiskers" {
+		t.Errorf("unexpected byline %q", a.Byline)
+	}
+	if expected := time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC); a.Published == nil || !a.Published.Equal(expected) {
+		t.Errorf("expected published %v, got %v", expected, a.Published)
+	}
+	if a.Image != "https://feline.example/images/cat.jpg" {
+		t.Errorf("unexpected image %q", a.Image)
+	}
+	for _, expected := range []string{
+		`<a href="https://feline.example/studies/attention">recent study</a>`,
+		`<img alt="A cat on a table" src="https://feline.example/images/table.jpg"/>`,
+	} {
+		if !strings.Contains(a.HTML, expected) {
+			t.Errorf("expected HTML to contain %q, got %s", expected, a.HTML)
+		}
+	}
+	for _, unexpected := range []string{
+		"trackPageView", "Home", "Subscribe", "<h1>", "Jane Whiskers", "hidden from readers",
+		"Share", "Ten facts", "Copyright", "class=",
+	} {
+		if strings.Contains(a.HTML, unexpected) || strings.Contains(a.Text, unexpected) {
+			t.Errorf("expected %q to be removed, got %s", unexpected, a.HTML)
+		}
+	}
+	paragraphs := strings.Split(a.Text, "\n\n")
+	if len(paragraphs) != 3 || !strings.HasPrefix(paragraphs[0], "Cats knock things") ||
+		!strings.Contains(paragraphs[1], "a recent study, is") {
+		t.Errorf("unexpected text %q", a.Text)
+	}
+}
+
+func TestExtractSiblings(t *testing.T) {
+	page := `<html><body>
+		<div class="post">
+			<p>The first part of the story has a good amount of text, enough to make it the top candidate, with commas, too.</p>
+			<p>And a second paragraph, so that this part of the story clearly scores best on the page, which it should.</p>
+		</div>
+		<p>A short note that ends the story.</p>
+		<p>A short note that doesn't end with a stop</p>
+		<div class="post">
+			<p>The rest of the story, which shares a class with the first part, so it's included in the article.</p>
+		</div>
+		<div class="other">
+			<p>Something else entirely, after the story, with just enough text to be scored on its own.</p>
+		</div>
+	</body></html>`
+	a, err := Extract(strings.NewReader(page), "https://foo.com/")
+	if err != nil {
+		t.Fatalf("Extract() error: %v", err)
+	}
+	for _, expected := range []string{"The first part", "A short note that ends", "The rest of the story"} {
+		if !strings.Contains(a.Text, expected) {
+			t.Errorf("expected text to contain %q, got %q", expected, a.Text)
+		}
+	}
+	for _, unexpected := range []string{"doesn't end with a stop", "Something else"} {
+		if strings.Contains(a.Text, unexpected) {
+			t.Errorf("expected text not to contain %q, got %q", unexpected, a.Text)
+		}
+	}
+}
+
+func TestExtractURLSchemes(t *testing.T) {
+	tests := []struct {
+		name       string
+		element    string
+		expected   string
+		unexpected string
+	}{
+		{"relative", `<a href="/more">more</a>`, `<a href="https://foo.com/more">more</a>`, ""},
+		{"mailto", `<a href="MAILTO:editor@foo.com">more</a>`, `<a href="mailto:editor@foo.com">more</a>`, ""},
+		{"javascript", `<a href="javascript:alert(1)">more</a>`, "more", "alert"},
+		{"javascript uppercase", `<a href="JAVASCRIPT:alert(document.cookie)">more</a>`, "more", "alert"},
+		{"javascript spaced", `<a href=" JavaScript:alert(1)">more</a>`, "more", "alert"},
+		{"javascript control", "<a href=\"java\tscript:alert(1)\">more</a>", "more", "alert"},
+		{"vbscript", `<a href="vbscript:msgbox(1)">more</a>`, "more", "msgbox"},
+		{"data link", `<a href="data:text/html,<script>alert(1)</script>">more</a>`, "more", "data:"},
+		{"data image", `<img src="DATA:image/svg+xml,<svg onload=alert(1)>" alt="chart">`, "", "<img"},
+		{"lazy javascript image", `<img data-src="javascript:alert(1)" alt="chart">`, "", "<img"},
+		{"image", `<img src="/chart.png" alt="chart">`, `<img src="https://foo.com/chart.png" alt="chart"/>`, ""},
+	}
+	for _, test := range tests {
+		page := `<html><body><div class="post">
+			<p>The first part of the story has a good amount of text, enough to make it the top candidate, with commas, too.</p>
+			<p>And a second paragraph, with a link to read ` + test.element + `, so that this part of the story scores best.</p>
+		</div></body></html>`
+		a, err := Extract(strings.NewReader(page), "https://foo.com/story")
+		if err != nil {
+			t.Fatalf("[%s] Extract() error: %v", test.name, err)
+		}
+		if !strings.Contains(a.HTML, test.expected) {
+			t.Errorf("[%s] expected HTML to contain %q, got %s", test.name, test.expected, a.HTML)
+		}
+		if (test.unexpected != "") && strings.Contains(a.HTML, test.unexpected) {
+			t.Errorf("[%s] expected %q to be removed, got %s", test.name, test.unexpected, a.HTML)
+		}
+	}
+}
+
+func TestExtractNoContent(t *testing.T) {
+	_, err := Extract(strings.NewReader(`<html><head><title>Empty</title></head><body><script>x()</script></body></html>`), "https://foo.com/")
+	if !errors.Is(err, ErrNoContent) {
+		t.Errorf("expected ErrNoContent, got %v", err)
+	}
+}
+
+func TestFromResponse(t *testing.T) {
+	u, _ := url.Parse("https://www.foo.com/story")
+	resp := &http.Response{
+		Body:    io.NopCloser(strings.NewReader(`<html><body><p>Some text with a <a href="more">link</a>.</p></body></html>`)),
+		Request: &http.Request{URL: u},
+	}
+	a, err := FromResponse(resp)
+	if err != nil {
+		t.Fatalf("FromResponse() error: %v", err)
+	}
+	if a.URL != "https://www.foo.com/story" || !strings.Contains(a.HTML, `href="https://www.foo.com/more"`) {
+		t.Errorf("expected links to be resolved against the request URL, got %s (%s)", a.HTML, a.URL)
+	}
+}
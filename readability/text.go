@@ -0,0 +1,86 @@
+package readability
+
+import (
+	"strings"
+
+	"github.com/efixler/headless/internal/htmlutil"
+	"golang.org/x/net/html"
+)
+
+// Elements that start a new paragraph in plain text
+var paragraphTags = map[string]bool{
+	"address":    true,
+	"article":    true,
+	"aside":      true,
+	"blockquote": true,
+	"dd":         true,
+	"details":    true,
+	"div":        true,
+	"dl":         true,
+	"dt":         true,
+	"figcaption": true,
+	"figure":     true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"header":     true,
+	"hr":         true,
+	"li":         true,
+	"main":       true,
+	"ol":         true,
+	"p":          true,
+	"pre":        true,
+	"section":    true,
+	"table":      true,
+	"tr":         true,
+	"ul":         true,
+}
+
+// The text under n, with a blank line between paragraphs and a line break
+// for each <br>.
+func plainText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case htmlutil.IsElement(n, "br"):
+			b.WriteString("\n")
+			return
+		case htmlutil.IsElement(n, "td", "th"):
+			b.WriteString(" ")
+		}
+		paragraph := n.Type == html.ElementNode && paragraphTags[n.Data]
+		if paragraph {
+			b.WriteString("\n\n")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if paragraph {
+			b.WriteString("\n\n")
+		}
+	}
+	walk(n)
+
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(b.String(), "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
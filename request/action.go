@@ -0,0 +1,117 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+type ActionType string
+
+const (
+	// Click the first element matching Selector.
+	ActionClick ActionType = "click"
+	// Type Text into the first element matching Selector.
+	ActionTypeText ActionType = "type"
+	// Press Key, focusing the first element matching Selector first if it's set.
+	ActionPress ActionType = "press"
+	// Scroll to the bottom of the page Times times, pausing for Delay after each scroll.
+	ActionScroll ActionType = "scroll"
+	// Wait for Selector to be present (or visible, if Visible is true), or if
+	// there's no Selector, wait for Delay.
+	ActionWait ActionType = "wait"
+	// Set the value of the select element matching Selector to Value.
+	ActionSelect ActionType = "select"
+	// Move the mouse over the first element matching Selector.
+	ActionHover ActionType = "hover"
+)
+
+const (
+	// How long an action waits for its Selector to match, unless it sets a Timeout.
+	DefaultActionTimeout = 10 * time.Second
+	DefaultScrollDelay   = 500 * time.Millisecond
+)
+
+var (
+	ErrInvalidActionType = errors.New("invalid action type")
+	// Names of the non-character keys that can be used with ActionPress.
+	KeyNames = []string{
+		"Backspace", "Tab", "Enter", "Escape", "Delete", "Space",
+		"ArrowDown", "ArrowLeft", "ArrowRight", "ArrowUp",
+		"End", "Home", "PageDown", "PageUp",
+	}
+)
+
+// Action is a step in a declarative sequence of page interactions, performed
+// in order once the page is ready and before its content is captured.
+type Action struct {
+	Type     ActionType `json:"type"`
+	Selector string     `json:"selector,omitempty"`
+	Text     string     `json:"text,omitempty"`
+	Key      string     `json:"key,omitempty"`
+	Value    string     `json:"value,omitempty"`
+	Visible  bool       `json:"visible,omitempty"`
+	Times    int        `json:"times,omitempty"`
+	Delay    Duration   `json:"delay,omitempty"`
+	Timeout  Duration   `json:"timeout,omitempty"`
+}
+
+func (a Action) Validate() error {
+	needsSelector := false
+	switch a.Type {
+	case ActionClick, ActionSelect, ActionHover:
+		needsSelector = true
+	case ActionTypeText:
+		needsSelector = true
+		if a.Text == "" {
+			return fmt.Errorf("action %q requires text", a.Type)
+		}
+	case ActionPress:
+		if !isKey(a.Key) {
+			return fmt.Errorf("action %q requires a single character or one of %v as the key, got %q", a.Type, KeyNames, a.Key)
+		}
+	case ActionWait:
+		if a.Selector == "" && a.Delay == 0 {
+			return fmt.Errorf("action %q requires a selector or a delay", a.Type)
+		}
+	case ActionScroll:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidActionType, a.Type)
+	}
+	if needsSelector && a.Selector == "" {
+		return fmt.Errorf("action %q requires a selector", a.Type)
+	}
+	if a.Times < 0 || a.Delay < 0 || a.Timeout < 0 {
+		return fmt.Errorf("values for action %q can't be negative", a.Type)
+	}
+	return nil
+}
+
+// Returns a copy of the Action with zero values replaced by defaults.
+func (a Action) WithDefaults() Action {
+	if a.Timeout == 0 {
+		a.Timeout = Duration(DefaultActionTimeout)
+	}
+	if a.Type == ActionScroll {
+		if a.Times == 0 {
+			a.Times = 1
+		}
+		if a.Delay == 0 {
+			a.Delay = Duration(DefaultScrollDelay)
+		}
+	}
+	return a
+}
+
+func isKey(key string) bool {
+	if utf8.RuneCountInString(key) == 1 {
+		return true
+	}
+	for _, name := range KeyNames {
+		if key == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestActionValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		action    Action
+		expectErr bool
+	}{
+		{"click", Action{Type: ActionClick, Selector: "#go"}, false},
+		{"click no selector", Action{Type: ActionClick}, true},
+		{"type", Action{Type: ActionTypeText, Selector: "#q", Text: "hello"}, false},
+		{"type no text", Action{Type: ActionTypeText, Selector: "#q"}, true},
+		{"press named key", Action{Type: ActionPress, Key: "Enter"}, false},
+		{"press character", Action{Type: ActionPress, Key: "é"}, false},
+		{"press unknown key", Action{Type: ActionPress, Key: "Hyperspace"}, true},
+		{"scroll", Action{Type: ActionScroll, Times: 3}, false},
+		{"scroll negative", Action{Type: ActionScroll, Times: -1}, true},
+		{"wait selector", Action{Type: ActionWait, Selector: ".results"}, false},
+		{"wait delay", Action{Type: ActionWait, Delay: Duration(DefaultScrollDelay)}, false},
+		{"wait nothing", Action{Type: ActionWait}, true},
+		{"select", Action{Type: ActionSelect, Selector: "select", Value: "2"}, false},
+		{"hover", Action{Type: ActionHover, Selector: "nav"}, false},
+		{"unknown", Action{Type: "dance"}, true},
+	}
+	for _, test := range tests {
+		err := test.action.Validate()
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.name, test.expectErr, err)
+		}
+	}
+	if err := (Action{Type: "dance"}).Validate(); !errors.Is(err, ErrInvalidActionType) {
+		t.Errorf("expected ErrInvalidActionType, got %v", err)
+	}
+}
+
+func TestActionDefaults(t *testing.T) {
+	a := Action{Type: ActionScroll}.WithDefaults()
+	if a.Times != 1 || a.Delay.Duration() != DefaultScrollDelay || a.Timeout.Duration() != DefaultActionTimeout {
+		t.Errorf("unexpected scroll defaults %+v", a)
+	}
+	a = Action{Type: ActionClick, Selector: "a"}.WithDefaults()
+	if a.Times != 0 || a.Delay != 0 {
+		t.Errorf("unexpected click defaults %+v", a)
+	}
+}
+
+func TestPayloadActions(t *testing.T) {
+	data := `{"url": "http://foo.com/", "actions": [
+		{"type": "type", "selector": "#user", "text": "me"},
+		{"type": "press", "key": "Enter"},
+		{"type": "click"}
+	]}`
+	var p Payload
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(p.Actions) != 3 {
+		t.Fatalf("expected 3 actions, got %d", len(p.Actions))
+	}
+	err := p.Validate()
+	if err == nil || !strings.HasPrefix(err.Error(), "action 2:") {
+		t.Errorf("expected an error for action 2, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package request
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Resource types that can be listed in BlockOptions.ResourceTypes.
+	BlockableResourceTypes = []string{"image", "media", "font", "stylesheet", "script"}
+)
+
+// BlockOptions describes sub-resource requests that the browser should fail
+// instead of sending. The page's own document is never blocked.
+type BlockOptions struct {
+	// Any of BlockableResourceTypes.
+	ResourceTypes []string `json:"resource_types,omitempty"`
+	// URL patterns to block. A pattern wrapped in slashes is a regular expression
+	// that can match anywhere in the URL (e.g. /doubleclick\.net/); otherwise '*'
+	// matches any sequence of characters and the pattern must match the whole URL
+	// (e.g. *://*.google-analytics.com/*).
+	URLPatterns []string `json:"url_patterns,omitempty"`
+}
+
+func (b BlockOptions) IsEmpty() bool {
+	return len(b.ResourceTypes) == 0 && len(b.URLPatterns) == 0
+}
+
+func (b BlockOptions) Validate() error {
+	for _, rt := range b.ResourceTypes {
+		if !isBlockable(rt) {
+			return fmt.Errorf("can't block resource type %q, must be one of %v", rt, BlockableResourceTypes)
+		}
+	}
+	for _, pattern := range b.URLPatterns {
+		if _, err := CompileURLPattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isBlockable(resourceType string) bool {
+	for _, rt := range BlockableResourceTypes {
+		if strings.EqualFold(rt, resourceType) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompileURLPattern converts a BlockOptions URL pattern into a regular expression.
+func CompileURLPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty URL pattern")
+	}
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL pattern %q: %w", pattern, err)
+		}
+		return re, nil
+	}
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+}
@@ -0,0 +1,54 @@
+package request
+
+import "testing"
+
+func TestCompileURLPattern(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		url       string
+		expect    bool
+		expectErr bool
+	}{
+		{"*://*.google-analytics.com/*", "https://www.google-analytics.com/analytics.js", true, false},
+		{"*://*.google-analytics.com/*", "https://google-analytics.com.evil.org/x", false, false},
+		{"*.png", "https://example.com/logo.png", true, false},
+		{"*.png", "https://example.com/logo.png?x=1", false, false},
+		{"https://example.com/a+b", "https://example.com/a+b", true, false},
+		{"/doubleclick\\.net/", "https://ad.doubleclick.net/ddm/x", true, false},
+		{"/doubleclick\\.net/", "https://doubleclickxnet.com/", false, false},
+		{"/[/", "", false, true},
+		{"", "", false, true},
+	}
+	for _, test := range tests {
+		re, err := CompileURLPattern(test.pattern)
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.pattern, test.expectErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		if re.MatchString(test.url) != test.expect {
+			t.Errorf("[%s] expected match %t for %s", test.pattern, test.expect, test.url)
+		}
+	}
+}
+
+func TestBlockOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      BlockOptions
+		expectErr bool
+	}{
+		{"empty", BlockOptions{}, false},
+		{"types", BlockOptions{ResourceTypes: []string{"image", "Font"}}, false},
+		{"bad type", BlockOptions{ResourceTypes: []string{"document"}}, true},
+		{"patterns", BlockOptions{URLPatterns: []string{"*.gif", "/ads?/"}}, false},
+		{"bad pattern", BlockOptions{URLPatterns: []string{"/(/"}}, true},
+	}
+	for _, test := range tests {
+		err := test.opts.Validate()
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.name, test.expectErr, err)
+		}
+	}
+}
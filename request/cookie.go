@@ -0,0 +1,49 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// Values allowed for Cookie.SameSite, besides empty.
+	SameSiteValues = []string{"Strict", "Lax", "None"}
+)
+
+// Cookie is a browser cookie. Cookies in a Payload are set before the page
+// is loaded; the cookies in the browser once it's loaded are returned the
+// same way.
+type Cookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Cookies with a leading period in the domain (.example.com) are sent to
+	// the domain and its subdomains; without one they're host-only. In a
+	// payload, omit the domain to set a host-only cookie for the page's URL.
+	Domain string `json:"domain,omitempty"`
+	Path   string `json:"path,omitempty"`
+	// Unix time the cookie expires; omit it for a session cookie.
+	Expires  int64 `json:"expires,omitempty"`
+	HTTPOnly bool  `json:"http_only,omitempty"`
+	Secure   bool  `json:"secure,omitempty"`
+	// One of SameSiteValues; omit it for the browser's default.
+	SameSite string `json:"same_site,omitempty"`
+}
+
+func (c Cookie) Validate() error {
+	if c.Name == "" {
+		return errors.New("cookie name is required")
+	}
+	switch c.SameSite {
+	case "", "Strict", "Lax", "None":
+	default:
+		return fmt.Errorf("cookie %q: same_site must be one of %v", c.Name, SameSiteValues)
+	}
+	return nil
+}
+
+// Reports whether the cookie has an expiry time before now. Session cookies
+// don't expire.
+func (c Cookie) Expired(now time.Time) bool {
+	return (c.Expires > 0) && (c.Expires <= now.Unix())
+}
@@ -0,0 +1,53 @@
+package request
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+var (
+	// JSON Schema (draft 2020-12) for Envelope.
+	//go:embed envelope.schema.json
+	EnvelopeSchema []byte
+)
+
+// Envelope is the content returned for FormatJSON: the rendered page, with
+// the target's response kept apart from the service's own headers, and
+// details of how the page was loaded.
+type Envelope struct {
+	// The requested URL
+	URL string `json:"url"`
+	// The URL of the page after any redirects
+	FinalURL string `json:"final_url"`
+	// The status code and headers of the final document response
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers"`
+	HTML    string      `json:"html"`
+	Title   string      `json:"title"`
+	Timings Timings     `json:"timings"`
+	// The responses that led to the final document, oldest first
+	Redirects []Redirect `json:"redirects"`
+	// Things that went wrong without failing the request, like scripts that
+	// threw or a page that wasn't ready before the wait strategy's max wait.
+	Warnings        []string       `json:"warnings"`
+	ScriptResults   []ScriptResult `json:"script_results,omitempty"`
+	BlockedRequests map[string]int `json:"blocked_requests,omitempty"`
+	// The cookies the browser would send to the final URL once the page loaded
+	Cookies []Cookie `json:"cookies,omitempty"`
+}
+
+// Timings in milliseconds.
+type Timings struct {
+	// Time to navigate to the page and wait for it to be ready
+	NavigationMS int64 `json:"navigation_ms"`
+	// Time for the whole request, including actions, scripts and capturing
+	// the content
+	TotalMS int64 `json:"total_ms"`
+}
+
+// Redirect is a response that led to another document, either an HTTP
+// redirect or a document replaced by a client-side navigation.
+type Redirect struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+}
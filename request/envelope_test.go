@@ -0,0 +1,37 @@
+package request
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The schema should describe every field of the envelope, and require the
+// ones that are always present.
+func TestEnvelopeSchema(t *testing.T) {
+	var schema struct {
+		Required   []string                   `json:"required"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(EnvelopeSchema, &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	required := make(map[string]bool)
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	envelope := reflect.TypeOf(Envelope{})
+	for i := 0; i < envelope.NumField(); i++ {
+		name, options, _ := strings.Cut(envelope.Field(i).Tag.Get("json"), ",")
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("schema has no property for %s", name)
+		}
+		if omitEmpty := options == "omitempty"; omitEmpty == required[name] {
+			t.Errorf("expected %s to be required: %t", name, !omitEmpty)
+		}
+	}
+	if len(schema.Properties) != envelope.NumField() {
+		t.Errorf("expected %d properties, got %d", envelope.NumField(), len(schema.Properties))
+	}
+}
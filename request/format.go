@@ -0,0 +1,149 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Format is the kind of content returned for a request.
+type Format string
+
+const (
+	// The rendered HTML of the page (the default).
+	FormatHTML Format = "html"
+	// An image of the rendered page.
+	FormatScreenshot Format = "screenshot"
+	// The page printed to PDF.
+	FormatPDF Format = "pdf"
+	// A HAR 1.2 document with the network activity for the page load.
+	FormatHAR Format = "har"
+	// An Envelope with the rendered HTML and details of the page load.
+	FormatJSON Format = "json"
+	// The page's main article, extracted with the readability package, as
+	// JSON.
+	FormatArticle Format = "article"
+	// The page's structured metadata, extracted with the metadata package, as
+	// JSON.
+	FormatMeta Format = "meta"
+)
+
+// NeedsImages reports whether the format needs the page's images:
+// screenshots and PDFs show them, and HARs record their requests.
+func (f Format) NeedsImages() bool {
+	switch f {
+	case FormatScreenshot, FormatPDF, FormatHAR:
+		return true
+	}
+	return false
+}
+
+type ImageType string
+
+const (
+	ImagePNG  ImageType = "png"
+	ImageJPEG ImageType = "jpeg"
+)
+
+var (
+	ErrInvalidFormat = errors.New("invalid format")
+)
+
+type ScreenshotOptions struct {
+	// Capture the entire page instead of just the viewport.
+	FullPage bool `json:"full_page,omitempty"`
+	// Image type, png (the default) or jpeg.
+	Type ImageType `json:"type,omitempty"`
+	// Compression quality [0..100], jpeg only.
+	Quality int `json:"quality,omitempty"`
+	// Clip the screenshot to the first element matching this selector.
+	Selector string `json:"selector,omitempty"`
+}
+
+func (s ScreenshotOptions) Validate() error {
+	switch s.Type {
+	case "", ImagePNG, ImageJPEG:
+	default:
+		return fmt.Errorf("invalid screenshot type %q", s.Type)
+	}
+	if s.Quality < 0 || s.Quality > 100 {
+		return fmt.Errorf("screenshot quality must be between 0 and 100, got %d", s.Quality)
+	}
+	if s.Quality != 0 && s.Type != ImageJPEG {
+		return errors.New("screenshot quality can only be set for jpeg images")
+	}
+	if s.FullPage && s.Selector != "" {
+		return errors.New("screenshot can't be both full page and clipped to a selector")
+	}
+	return nil
+}
+
+func (s ScreenshotOptions) ContentType() string {
+	if s.Type == ImageJPEG {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// Paper dimensions in inches, keyed by lower case paper name.
+var PaperSizes = map[string][2]float64{
+	"letter":  {8.5, 11},
+	"legal":   {8.5, 14},
+	"tabloid": {11, 17},
+	"a3":      {11.69, 16.54},
+	"a4":      {8.27, 11.69},
+	"a5":      {5.83, 8.27},
+}
+
+// Margins in inches.
+type Margins struct {
+	Top    float64 `json:"top"`
+	Right  float64 `json:"right"`
+	Bottom float64 `json:"bottom"`
+	Left   float64 `json:"left"`
+}
+
+type PDFOptions struct {
+	// One of the keys in PaperSizes. Ignored if Width and Height are set.
+	PaperSize string `json:"paper_size,omitempty"`
+	// Paper width and height in inches.
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+	// Omit to use Chrome's default margins.
+	Margins         *Margins `json:"margins,omitempty"`
+	Landscape       bool     `json:"landscape,omitempty"`
+	PrintBackground bool     `json:"print_background,omitempty"`
+	// HTML templates for the page header and footer. Elements with the classes
+	// date, title, url, pageNumber and totalPages are filled in by Chrome.
+	HeaderTemplate string `json:"header_template,omitempty"`
+	FooterTemplate string `json:"footer_template,omitempty"`
+}
+
+func (p PDFOptions) Validate() error {
+	if p.PaperSize != "" {
+		if _, ok := PaperSizes[strings.ToLower(p.PaperSize)]; !ok {
+			return fmt.Errorf("unknown paper size %q", p.PaperSize)
+		}
+	}
+	if p.Width < 0 || p.Height < 0 {
+		return errors.New("paper dimensions can't be negative")
+	}
+	if (p.Width == 0) != (p.Height == 0) {
+		return errors.New("paper width and height must be set together")
+	}
+	if m := p.Margins; m != nil && (m.Top < 0 || m.Right < 0 || m.Bottom < 0 || m.Left < 0) {
+		return errors.New("margins can't be negative")
+	}
+	return nil
+}
+
+// Paper width and height in inches; zeros mean use Chrome's default.
+func (p PDFOptions) Dimensions() (width, height float64) {
+	if p.Width > 0 && p.Height > 0 {
+		return p.Width, p.Height
+	}
+	if size, ok := PaperSizes[strings.ToLower(p.PaperSize)]; ok {
+		return size[0], size[1]
+	}
+	return 0, 0
+}
@@ -0,0 +1,85 @@
+package request
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScreenshotOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      ScreenshotOptions
+		expectErr bool
+	}{
+		{"defaults", ScreenshotOptions{}, false},
+		{"jpeg with quality", ScreenshotOptions{Type: ImageJPEG, Quality: 80}, false},
+		{"png with quality", ScreenshotOptions{Type: ImagePNG, Quality: 80}, true},
+		{"quality out of range", ScreenshotOptions{Type: ImageJPEG, Quality: 101}, true},
+		{"bad type", ScreenshotOptions{Type: "gif"}, true},
+		{"selector", ScreenshotOptions{Selector: "#main"}, false},
+		{"full page and selector", ScreenshotOptions{FullPage: true, Selector: "#main"}, true},
+	}
+	for _, test := range tests {
+		err := test.opts.Validate()
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.name, test.expectErr, err)
+		}
+	}
+}
+
+func TestPayloadFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   Payload
+		expectErr bool
+	}{
+		{"default", Payload{URL: "http://foo.com/"}, false},
+		{"html", Payload{URL: "http://foo.com/", Format: FormatHTML}, false},
+		{"screenshot", Payload{URL: "http://foo.com/", Format: FormatScreenshot}, false},
+		{"bad screenshot", Payload{URL: "http://foo.com/", Format: FormatScreenshot, Screenshot: &ScreenshotOptions{Type: "gif"}}, true},
+		{"pdf", Payload{URL: "http://foo.com/", Format: FormatPDF, PDF: &PDFOptions{PaperSize: "A4"}}, false},
+		{"bad pdf", Payload{URL: "http://foo.com/", Format: FormatPDF, PDF: &PDFOptions{PaperSize: "napkin"}}, true},
+		{"unknown", Payload{URL: "http://foo.com/", Format: "mp4"}, true},
+	}
+	for _, test := range tests {
+		err := test.payload.Validate()
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.name, test.expectErr, err)
+		}
+	}
+	err := Payload{Format: "mp4"}.Validate()
+	if !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("expected ErrInvalidFormat, got %v", err)
+	}
+}
+
+func TestPDFOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         PDFOptions
+		expectErr    bool
+		expectWidth  float64
+		expectHeight float64
+	}{
+		{"defaults", PDFOptions{}, false, 0, 0},
+		{"named", PDFOptions{PaperSize: "Letter"}, false, 8.5, 11},
+		{"dimensions", PDFOptions{Width: 5, Height: 7}, false, 5, 7},
+		{"dimensions win", PDFOptions{PaperSize: "a4", Width: 5, Height: 7}, false, 5, 7},
+		{"unknown paper", PDFOptions{PaperSize: "napkin"}, true, 0, 0},
+		{"width only", PDFOptions{Width: 5}, true, 5, 0},
+		{"negative margin", PDFOptions{Margins: &Margins{Top: -1}}, true, 0, 0},
+	}
+	for _, test := range tests {
+		err := test.opts.Validate()
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.name, test.expectErr, err)
+		}
+		if test.expectErr {
+			continue
+		}
+		width, height := test.opts.Dimensions()
+		if width != test.expectWidth || height != test.expectHeight {
+			t.Errorf("[%s] expected %vx%v, got %vx%v", test.name, test.expectWidth, test.expectHeight, width, height)
+		}
+	}
+}
@@ -1,7 +1,115 @@
 package request
 
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	MaxSessionNameLength = 64
+)
+
+var (
+	sessionName = regexp.MustCompile(fmt.Sprintf(`^[A-Za-z0-9._-]{1,%d}$`, MaxSessionNameLength))
+)
+
 type Payload struct {
 	// URL to fetch
 	URL     string            `json:"url"`
 	Headers map[string]string `json:"headers,omitempty"`
+	// How to decide when the page is ready. Omit to use the browser's default.
+	Wait *WaitStrategy `json:"wait,omitempty"`
+	// Maximum time to spend on the request. Omit to use the browser's default.
+	Timeout Duration `json:"timeout,omitempty"`
+	// What to return for the page. Defaults to FormatHTML.
+	Format Format `json:"format,omitempty"`
+	// Screenshot settings, used when Format is FormatScreenshot.
+	Screenshot *ScreenshotOptions `json:"screenshot,omitempty"`
+	// PDF settings, used when Format is FormatPDF.
+	PDF *PDFOptions `json:"pdf,omitempty"`
+	// Sub-resource requests to block. Omit to use the browser's default.
+	Block *BlockOptions `json:"block,omitempty"`
+	// Interactions performed in order once the page is ready.
+	Actions []Action `json:"actions,omitempty"`
+	// JavaScript expressions evaluated in order after the Actions, before
+	// the page content is captured. Promises are awaited.
+	Scripts []string `json:"scripts,omitempty"`
+	// Cookies to set in the browser before the page is loaded.
+	Cookies []Cookie `json:"cookies,omitempty"`
+	// Requests with the same session name share cookies and storage. Omit it
+	// to load the page in a fresh context that's discarded afterwards.
+	Session string `json:"session,omitempty"`
+	// http(s) URL that the result of an async job is posted to when it's
+	// done. Only used for jobs.
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// HasSettings reports whether the payload has any per-request settings besides
+// its URL and headers (the callback URL isn't a setting for the browser).
+func (p Payload) HasSettings() bool {
+	return (p.Wait != nil) || (p.Timeout != 0) || ((p.Format != "") && (p.Format != FormatHTML)) ||
+		(p.Screenshot != nil) || (p.PDF != nil) || (p.Block != nil) || (len(p.Actions) > 0) ||
+		(len(p.Scripts) > 0) || (len(p.Cookies) > 0) || (p.Session != "")
+}
+
+func (p Payload) Validate() error {
+	if p.Timeout < 0 {
+		return errors.New("timeout can't be negative")
+	}
+	switch p.Format {
+	case "", FormatHTML, FormatScreenshot, FormatPDF, FormatHAR, FormatJSON, FormatArticle, FormatMeta:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidFormat, p.Format)
+	}
+	if p.Screenshot != nil {
+		if err := p.Screenshot.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.PDF != nil {
+		if err := p.PDF.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.Block != nil {
+		if err := p.Block.Validate(); err != nil {
+			return err
+		}
+	}
+	for i, action := range p.Actions {
+		if err := action.Validate(); err != nil {
+			return fmt.Errorf("action %d: %w", i, err)
+		}
+	}
+	for i, script := range p.Scripts {
+		if strings.TrimSpace(script) == "" {
+			return fmt.Errorf("script %d is empty", i)
+		}
+	}
+	for i, cookie := range p.Cookies {
+		if err := cookie.Validate(); err != nil {
+			return fmt.Errorf("cookie %d: %w", i, err)
+		}
+	}
+	if p.Wait != nil {
+		if err := p.Wait.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.Session != "" && !sessionName.MatchString(p.Session) {
+		return fmt.Errorf("session must be 1 to %d letters, digits, '.', '_' or '-': %q", MaxSessionNameLength, p.Session)
+	}
+	if p.CallbackURL != "" {
+		u, err := url.Parse(p.CallbackURL)
+		if err != nil {
+			return fmt.Errorf("callback_url: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || (u.Host == "") {
+			return fmt.Errorf("callback_url must be an absolute http(s) URL: %q", p.CallbackURL)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,125 @@
+package request
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPayloadScripts(t *testing.T) {
+	tests := []struct {
+		name      string
+		scripts   []string
+		expectErr bool
+	}{
+		{"none", nil, false},
+		{"one", []string{"document.title"}, false},
+		{"empty", []string{"document.title", "  "}, true},
+	}
+	for _, test := range tests {
+		err := Payload{URL: "http://foo.com/", Scripts: test.scripts}.Validate()
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.name, test.expectErr, err)
+		}
+	}
+}
+
+func TestPayloadCallbackURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		expectErr bool
+	}{
+		{"none", "", false},
+		{"https", "https://hooks.example.com/done", false},
+		{"http", "http://hooks.example.com:8080/done?job=1", false},
+		{"relative", "/done", true},
+		{"no host", "http:///done", true},
+		{"bad scheme", "ftp://hooks.example.com/done", true},
+	}
+	for _, test := range tests {
+		err := Payload{URL: "http://foo.com/", CallbackURL: test.url}.Validate()
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.name, test.expectErr, err)
+		}
+	}
+}
+
+func TestPayloadCookies(t *testing.T) {
+	tests := []struct {
+		name      string
+		cookies   []Cookie
+		expectErr bool
+	}{
+		{"none", nil, false},
+		{"host only", []Cookie{{Name: "session", Value: "abc"}}, false},
+		{"domain", []Cookie{{Name: "session", Value: "abc", Domain: ".foo.com", Path: "/", SameSite: "Lax"}}, false},
+		{"no name", []Cookie{{Value: "abc"}}, true},
+		{"bad same site", []Cookie{{Name: "session", SameSite: "lenient"}}, true},
+	}
+	for _, test := range tests {
+		err := Payload{URL: "http://foo.com/", Cookies: test.cookies}.Validate()
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.name, test.expectErr, err)
+		}
+	}
+}
+
+func TestPayloadSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		session   string
+		expectErr bool
+	}{
+		{"none", "", false},
+		{"simple", "alice", false},
+		{"punctuation", "team-a.user_1", false},
+		{"space", "alice smith", true},
+		{"slash", "a/b", true},
+		{"too long", strings.Repeat("a", MaxSessionNameLength+1), true},
+	}
+	for _, test := range tests {
+		err := Payload{URL: "http://foo.com/", Session: test.session}.Validate()
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.name, test.expectErr, err)
+		}
+	}
+}
+
+func TestPayloadHasSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload Payload
+		expect  bool
+	}{
+		{"url only", Payload{URL: "http://foo.com/"}, false},
+		{"headers and callback", Payload{URL: "http://foo.com/", Headers: map[string]string{"A": "b"}, CallbackURL: "http://bar.com/"}, false},
+		{"html format", Payload{URL: "http://foo.com/", Format: FormatHTML}, false},
+		{"json format", Payload{URL: "http://foo.com/", Format: FormatJSON}, true},
+		{"timeout", Payload{URL: "http://foo.com/", Timeout: Duration(time.Second)}, true},
+		{"scripts", Payload{URL: "http://foo.com/", Scripts: []string{"1"}}, true},
+		{"session", Payload{URL: "http://foo.com/", Session: "alice"}, true},
+	}
+	for _, test := range tests {
+		if got := test.payload.HasSettings(); got != test.expect {
+			t.Errorf("[%s] expected %t, got %t", test.name, test.expect, got)
+		}
+	}
+}
+
+func TestScriptResultJSON(t *testing.T) {
+	results := []ScriptResult{
+		{Value: json.RawMessage(`{"a":1}`)},
+		{Value: json.RawMessage(`null`)},
+		{Error: "ReferenceError: foo is not defined"},
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := `[{"value":{"a":1}},{"value":null},{"error":"ReferenceError: foo is not defined"}]`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
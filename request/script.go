@@ -0,0 +1,11 @@
+package request
+
+import "encoding/json"
+
+// ScriptResult is the outcome of one of the Payload's scripts. Value is the
+// JSON-serialized return value of the script (null if it returned nothing);
+// if the script threw an exception, Error holds its message instead.
+type ScriptResult struct {
+	Value json.RawMessage `json:"value,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
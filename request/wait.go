@@ -0,0 +1,82 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type WaitType string
+
+const (
+	// Wait until there are no more than MaxInflight network requests
+	// in progress for at least IdleTime.
+	WaitNetworkIdle WaitType = "network-idle"
+	// Wait for the DOMContentLoaded event.
+	WaitDOMContentLoaded WaitType = "dom-content-loaded"
+	// Wait for the page's load event.
+	WaitLoad WaitType = "load"
+	// Wait for Selector to be present in the DOM (or visible, if Visible is true).
+	WaitSelector WaitType = "selector"
+	// Wait for Expression to evaluate to a truthy value in the page.
+	WaitExpression WaitType = "expression"
+	// Wait for the page's load event, and then for Delay.
+	WaitDelay WaitType = "delay"
+)
+
+const (
+	DefaultMaxWait  = 10 * time.Second
+	DefaultIdleTime = 500 * time.Millisecond
+	DefaultDelay    = 1 * time.Second
+)
+
+var (
+	ErrInvalidWaitType = errors.New("invalid wait type")
+)
+
+// WaitStrategy determines when a page is considered ready for content capture.
+// If the page isn't ready after MaxWait, the content is captured anyway.
+type WaitStrategy struct {
+	Type        WaitType `json:"type"`
+	Selector    string   `json:"selector,omitempty"`
+	Visible     bool     `json:"visible,omitempty"`
+	Expression  string   `json:"expression,omitempty"`
+	MaxInflight int      `json:"max_inflight,omitempty"`
+	IdleTime    Duration `json:"idle_time,omitempty"`
+	Delay       Duration `json:"delay,omitempty"`
+	MaxWait     Duration `json:"max_wait,omitempty"`
+}
+
+func (w WaitStrategy) Validate() error {
+	switch w.Type {
+	case WaitNetworkIdle, WaitDOMContentLoaded, WaitLoad, WaitDelay:
+	case WaitSelector:
+		if w.Selector == "" {
+			return fmt.Errorf("wait type %q requires a selector", w.Type)
+		}
+	case WaitExpression:
+		if w.Expression == "" {
+			return fmt.Errorf("wait type %q requires an expression", w.Type)
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidWaitType, w.Type)
+	}
+	if w.MaxInflight < 0 || w.IdleTime < 0 || w.Delay < 0 || w.MaxWait < 0 {
+		return fmt.Errorf("wait values for %q can't be negative", w.Type)
+	}
+	return nil
+}
+
+// Returns a copy of the WaitStrategy with zero values replaced by defaults.
+func (w WaitStrategy) WithDefaults() WaitStrategy {
+	if w.MaxWait == 0 {
+		w.MaxWait = Duration(DefaultMaxWait)
+	}
+	if w.IdleTime == 0 {
+		w.IdleTime = Duration(DefaultIdleTime)
+	}
+	if (w.Type == WaitDelay) && (w.Delay == 0) {
+		w.Delay = Duration(DefaultDelay)
+	}
+	return w
+}
@@ -0,0 +1,76 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDurationUnmarshal(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		expected  time.Duration
+		expectErr bool
+	}{
+		{"milliseconds", `250`, 250 * time.Millisecond, false},
+		{"string", `"1.5s"`, 1500 * time.Millisecond, false},
+		{"bad string", `"soon"`, 0, true},
+		{"bool", `true`, 0, true},
+	}
+	for _, test := range tests {
+		var d Duration
+		err := json.Unmarshal([]byte(test.in), &d)
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.name, test.expectErr, err)
+		}
+		if d.Duration() != test.expected {
+			t.Errorf("[%s] expected %s, got %s", test.name, test.expected, d.Duration())
+		}
+	}
+}
+
+func TestWaitStrategyValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		ws        WaitStrategy
+		expectErr bool
+	}{
+		{"load", WaitStrategy{Type: WaitLoad}, false},
+		{"empty type", WaitStrategy{}, true},
+		{"unknown type", WaitStrategy{Type: "whenever"}, true},
+		{"selector", WaitStrategy{Type: WaitSelector, Selector: "body"}, false},
+		{"no selector", WaitStrategy{Type: WaitSelector}, true},
+		{"expression", WaitStrategy{Type: WaitExpression, Expression: "window.ready"}, false},
+		{"no expression", WaitStrategy{Type: WaitExpression}, true},
+		{"negative", WaitStrategy{Type: WaitNetworkIdle, MaxInflight: -1}, true},
+	}
+	for _, test := range tests {
+		err := test.ws.Validate()
+		if (err != nil) != test.expectErr {
+			t.Errorf("[%s] expected error %t, got %v", test.name, test.expectErr, err)
+		}
+	}
+	err := WaitStrategy{Type: "whenever"}.Validate()
+	if !errors.Is(err, ErrInvalidWaitType) {
+		t.Errorf("expected ErrInvalidWaitType, got %v", err)
+	}
+}
+
+func TestWaitStrategyDefaults(t *testing.T) {
+	ws := WaitStrategy{Type: WaitDelay}.WithDefaults()
+	if ws.MaxWait.Duration() != DefaultMaxWait {
+		t.Errorf("expected max wait %s, got %s", DefaultMaxWait, ws.MaxWait.Duration())
+	}
+	if ws.Delay.Duration() != DefaultDelay {
+		t.Errorf("expected delay %s, got %s", DefaultDelay, ws.Delay.Duration())
+	}
+	ws = WaitStrategy{Type: WaitLoad, MaxWait: Duration(time.Second)}.WithDefaults()
+	if ws.MaxWait.Duration() != time.Second {
+		t.Errorf("expected max wait %s, got %s", time.Second, ws.MaxWait.Duration())
+	}
+	if ws.Delay != 0 {
+		t.Errorf("expected no delay for %q, got %s", ws.Type, ws.Delay.Duration())
+	}
+}
@@ -1,15 +1,92 @@
 package headless
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/efixler/headless/request"
+)
+
+const (
+	// Response header holding the JSON array of request.ScriptResult values
+	// for the scripts in the request payload.
+	ScriptResultsHeader = "X-Headless-Script-Results"
+	// Response header holding a JSON object with the number of requests blocked
+	// for the page, by resource type.
+	BlockedRequestsHeader = "X-Headless-Blocked-Requests"
+	// Response header holding the URL of the page after any redirects. The
+	// response's Request also has this URL, and its Request.Response links
+	// to the chain of redirect responses that led to it.
+	FinalURLHeader = "X-Headless-Final-URL"
+	// Response header holding the JSON array of request.Cookie values that
+	// the browser would send to the page's final URL once it has loaded,
+	// including cookies from the request. Cookies for other sites, like the
+	// rest of the cookie jar or session, aren't included.
+	CookiesHeader = "X-Headless-Cookies"
+	// Response header explaining each metadata header that was left out of
+	// the response because it was too large. The full values are in the body
+	// for request.FormatJSON.
+	WarningHeader = "X-Headless-Warning"
+	// Request header naming the session for requests made through the proxy,
+	// like the session in a request.Payload.
+	SessionHeader = "X-Headless-Session"
 )
 
 type Browser interface {
 	Get(url string, headers http.Header) (*http.Response, error)
 }
 
+// Fetcher is a Browser that can abandon requests and apply the per-request
+// settings in a request.Payload. Use AsFetcher to get one from a Browser.
+type Fetcher interface {
+	Browser
+	// GetContext is like Get, but abandons the request when ctx is done.
+	GetContext(ctx context.Context, url string, headers http.Header) (*http.Response, error)
+	// Fetch is like Get, but also applies the per-request settings in the payload.
+	Fetch(payload *request.Payload) (*http.Response, error)
+	// FetchContext is like Fetch, but abandons the request when ctx is done.
+	// When the page fails to load, the response may come back along with the
+	// error, carrying what was captured up to the failure (like the partial
+	// HAR for request.FormatHAR).
+	FetchContext(ctx context.Context, payload *request.Payload) (*http.Response, error)
+}
+
+// AsFetcher returns b if it's a Fetcher. Otherwise it wraps b in a Fetcher
+// that renders payloads with just a URL and headers using Get. The wrapper
+// can't abandon requests, and fails payloads with other settings with a 501
+// HTTPError.
+func AsFetcher(b Browser) Fetcher {
+	if f, ok := b.(Fetcher); ok {
+		return f
+	}
+	return getFetcher{b}
+}
+
+type getFetcher struct {
+	Browser
+}
+
+func (g getFetcher) GetContext(ctx context.Context, url string, headers http.Header) (*http.Response, error) {
+	return g.Get(url, headers)
+}
+
+func (g getFetcher) Fetch(payload *request.Payload) (*http.Response, error) {
+	return g.FetchContext(context.Background(), payload)
+}
+
+func (g getFetcher) FetchContext(ctx context.Context, payload *request.Payload) (*http.Response, error) {
+	if payload.HasSettings() {
+		return nil, &HTTPError{StatusCode: http.StatusNotImplemented, Message: "the browser can't apply the request's settings"}
+	}
+	headers := make(http.Header)
+	for k, v := range payload.Headers {
+		headers.Set(k, v)
+	}
+	return g.Get(payload.URL, headers)
+}
+
 type TabFactory interface {
 	AcquireTab() (Browser, error)
 }